@@ -0,0 +1,325 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+	log "github.com/sirupsen/logrus"
+)
+
+// title of the slides without a title placeholder, as written by PowerPoint
+const untitledSlide = "PowerPoint Presentation"
+
+// heading of the slide titles in the HeadingPairs, as written by an english PowerPoint
+const slideTitlesHeading = "Slide Titles"
+
+type titlesGroup struct {
+	name   string
+	titles []string
+}
+
+func (p *PowerpointDoc) themeName(theme string) string {
+	doc, err := p.ReadPart(theme)
+	if err != nil {
+		p.Problem(err)
+	}
+	if doc != nil && doc.Root() != nil {
+		return doc.Root().SelectAttrValue("name", "")
+	}
+	return ""
+}
+
+// masterThemeNames returns the names of the themes of the remaining masters
+func (p *PowerpointDoc) masterThemeNames() []string {
+	names := []string{}
+	for i, rels := range p.slideMasterRels {
+		if p.IsMasterRemoved(i) {
+			continue
+		}
+		for _, rel := range rels.Relationship {
+			if rel.Is("theme") && rel.TargetMode != "External" {
+				names = append(names, p.themeName(resolveTarget(partName("slideMaster", i), rel.Target)))
+				break
+			}
+		}
+	}
+	return names
+}
+
+// readSlide returns the slide as edited, or as in the source file, nil when it cannot be read
+func (p *PowerpointDoc) readSlide(i int) *etree.Document {
+	if doc, ok := p.parts[partName("slide", i)]; ok {
+		return doc
+	}
+	doc, err := p.ReadPart(partName("slide", i))
+	if err != nil {
+		p.Problem(err)
+	}
+	return doc
+}
+
+// slideTitle returns the text of the title placeholder of a slide
+func (p *PowerpointDoc) slideTitle(i int) string {
+	doc := p.readSlide(i)
+	if doc == nil {
+		return untitledSlide
+	}
+	for _, sp := range doc.FindElements("//p:sp") {
+		ph := sp.FindElement("p:nvSpPr/p:nvPr/p:ph")
+		if ph == nil || (ph.SelectAttrValue("type", "") != "title" && ph.SelectAttrValue("type", "") != "ctrTitle") {
+			continue
+		}
+		text := []string{}
+		for _, para := range sp.FindElements(".//a:p") {
+			line := ""
+			for _, t := range para.FindElements(".//a:t") {
+				line += t.Text()
+			}
+			text = append(text, line)
+		}
+		if title := strings.TrimSpace(strings.Join(text, " ")); title != "" {
+			return title
+		}
+	}
+	return untitledSlide
+}
+
+// childElements returns the child elements with a tag, whatever the prefix of their namespace
+func childElements(e *etree.Element, tag string) []*etree.Element {
+	var children []*etree.Element
+	for _, c := range e.ChildElements() {
+		if c.Tag == tag {
+			children = append(children, c)
+		}
+	}
+	return children
+}
+
+func childElement(e *etree.Element, tag string) *etree.Element {
+	if children := childElements(e, tag); len(children) > 0 {
+		return children[0]
+	}
+	return nil
+}
+
+// qualifiedTag returns a tag with the prefix of an existing element, so that new elements use the same declaration
+func qualifiedTag(like *etree.Element, tag string) string {
+	if like.Space == "" {
+		return tag
+	}
+	return like.Space + ":" + tag
+}
+
+func countSlides(order []int, match func(i int) bool) int {
+	n := 0
+	for _, i := range order {
+		if match(i) {
+			n++
+		}
+	}
+	return n
+}
+
+func (p *PowerpointDoc) slideHasNotes(i int) bool {
+	if i >= len(p.slideRels) {
+		return false
+	}
+	for _, rel := range p.slideRels[i].Relationship {
+		if rel.Is("notesSlide") && rel.TargetMode != "External" {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *PowerpointDoc) isSlideHidden(i int) bool {
+	doc := p.readSlide(i)
+	return doc != nil && doc.Root() != nil && doc.Root().SelectAttrValue("show", "1") == "0"
+}
+
+func readTitlesGroups(headingPairs *etree.Element, titlesOfParts *etree.Element) ([]titlesGroup, bool) {
+	pairs := childElements(headingPairs, "variant")
+	titles := childElements(titlesOfParts, "lpstr")
+	if len(pairs) != len(headingPairs.ChildElements()) || len(titles) != len(titlesOfParts.ChildElements()) {
+		return nil, false // such as lpwstr titles
+	}
+	groups := []titlesGroup{}
+	for j := 0; j+1 < len(pairs); j += 2 {
+		name, count := childElement(pairs[j], "lpstr"), childElement(pairs[j+1], "i4")
+		if name == nil || count == nil {
+			return nil, false
+		}
+		n, err := strconv.Atoi(count.Text())
+		if err != nil || n < 0 || n > len(titles) {
+			return nil, false
+		}
+		group := titlesGroup{name: name.Text()}
+		for _, t := range titles[:n] {
+			group.titles = append(group.titles, t.Text())
+		}
+		titles = titles[n:]
+		groups = append(groups, group)
+	}
+	return groups, len(titles) == 0
+}
+
+// resizeVector keeps the first n elements of a vt:vector, adding new ones if needed, and updates its size attribute.
+// Existing elements are reused so that their prefix and the formatting around them are kept.
+func resizeVector(vector *etree.Element, tag string, n int) []*etree.Element {
+	items := childElements(vector, tag)
+	for len(items) > n {
+		last := items[len(items)-1]
+		// with the indentation before it
+		if i := last.Index(); i > 0 {
+			if ws, ok := vector.Child[i-1].(*etree.CharData); ok && ws.IsWhitespace() {
+				vector.RemoveChildAt(i - 1)
+			}
+		}
+		vector.RemoveChild(last)
+		items = items[:len(items)-1]
+	}
+	for len(items) < n {
+		items = append(items, vector.CreateElement(qualifiedTag(vector, tag)))
+	}
+	if size := strconv.Itoa(n); vector.SelectAttrValue("size", "") != size {
+		vector.CreateAttr("size", size)
+	}
+	return items
+}
+
+// setText only touches the text of an element when it changes
+func setText(e *etree.Element, text string) {
+	if e.Text() != text {
+		e.SetText(text)
+	}
+}
+
+// setVariant sets the value of a vt:variant, replacing its content if it holds another type
+func setVariant(variant *etree.Element, tag string, value string) {
+	e := childElement(variant, tag)
+	if e == nil {
+		for _, c := range variant.ChildElements() {
+			variant.RemoveChild(c)
+		}
+		e = variant.CreateElement(qualifiedTag(variant, tag))
+	}
+	setText(e, value)
+}
+
+func writeTitlesGroups(headingPairs *etree.Element, titlesOfParts *etree.Element, groups []titlesGroup) {
+	variants := resizeVector(headingPairs, "variant", 2*len(groups))
+	var all []string
+	for j, g := range groups {
+		setVariant(variants[2*j], "lpstr", g.name)
+		setVariant(variants[2*j+1], "i4", strconv.Itoa(len(g.titles)))
+		all = append(all, g.titles...)
+	}
+	for j, e := range resizeVector(titlesOfParts, "lpstr", len(all)) {
+		setText(e, all[j])
+	}
+}
+
+// inputSlideCount returns the number of slides of the input, including those removed since
+func (p *PowerpointDoc) inputSlideCount() int {
+	n := len(p.SlideOrder())
+	for _, removed := range p.removedSlides {
+		if removed {
+			n++
+		}
+	}
+	return n
+}
+
+// findSlideTitlesGroup returns the last group headed by the slide titles heading, or else the last one with
+// one title per slide of the input, or -1 if there is none, such as in the properties of a localized PowerPoint
+// with slides removed outside of it
+func findSlideTitlesGroup(groups []titlesGroup, slides []int) int {
+	for j := len(groups) - 1; j >= 0; j-- {
+		if groups[j].name == slideTitlesHeading {
+			return j
+		}
+	}
+	for j := len(groups) - 1; j >= 0; j-- {
+		for _, n := range slides {
+			if len(groups[j].titles) == n {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// UpdateAppProperties recomputes the slide count, and the theme and slide titles listed in the
+// HeadingPairs and TitlesOfParts of the application properties, after slides, masters or themes were removed.
+// The theme group is recognized by its titles being theme names, the slide titles group by its heading or by
+// its number of titles matching the slide count of the input, other groups such as the fonts are kept.
+func (p *PowerpointDoc) UpdateAppProperties() {
+	if p.xmlLocked("update application properties") {
+		return
+	}
+	doc := p.LoadDocProps(AppProperties)
+	if doc == nil || doc.Root() == nil {
+		return
+	}
+	order := p.SlideOrder()
+	// slide counts the titles may match, that of the input and the one recorded with them
+	slides := []int{p.inputSlideCount()}
+	if e := doc.Root().SelectElement("Slides"); e != nil {
+		if n, err := strconv.Atoi(strings.TrimSpace(e.Text())); err == nil {
+			slides = append(slides, n)
+		}
+		setText(e, strconv.Itoa(len(order)))
+	}
+	if e := doc.Root().SelectElement("Notes"); e != nil {
+		setText(e, strconv.Itoa(countSlides(order, p.slideHasNotes)))
+	}
+	if e := doc.Root().SelectElement("HiddenSlides"); e != nil {
+		setText(e, strconv.Itoa(countSlides(order, p.isSlideHidden)))
+	}
+
+	var headingPairs, titlesOfParts *etree.Element
+	if e := doc.Root().SelectElement("HeadingPairs"); e != nil {
+		headingPairs = childElement(e, "vector")
+	}
+	if e := doc.Root().SelectElement("TitlesOfParts"); e != nil {
+		titlesOfParts = childElement(e, "vector")
+	}
+	if headingPairs == nil || titlesOfParts == nil {
+		return
+	}
+	groups, ok := readTitlesGroups(headingPairs, titlesOfParts)
+	if !ok {
+		log.Warnln("inconsistent HeadingPairs and TitlesOfParts in application properties, leave them untouched")
+		return
+	}
+	slideGroup := findSlideTitlesGroup(groups, slides)
+	if slideGroup < 0 {
+		log.Warnln("no slide titles found in the HeadingPairs of application properties, leave them untouched")
+		return
+	}
+
+	themes := make(map[string]bool)
+	for _, f := range p.sourceFileReader.File {
+		if reThemePart.MatchString(f.Name) {
+			themes[p.themeName(f.Name)] = true
+		}
+	}
+	for j, g := range groups {
+		isTheme := j != slideGroup && len(g.titles) > 0
+		for _, t := range g.titles {
+			isTheme = isTheme && themes[t]
+		}
+		if isTheme {
+			groups[j].titles = p.masterThemeNames()
+			break
+		}
+	}
+	titles := []string{}
+	for _, i := range order {
+		titles = append(titles, p.slideTitle(i))
+	}
+	groups[slideGroup].titles = titles
+	writeTitlesGroups(headingPairs, titlesOfParts, groups)
+	log.Debugln("updated application properties,", len(order), "slides")
+}
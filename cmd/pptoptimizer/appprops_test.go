@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// application properties as written by PowerPoint, indented in part as by some tools, the header being added by the test deck
+const testAppProperties = `<Properties xmlns="http://schemas.openxmlformats.org/officeDocument/2006/extended-properties" xmlns:vt="http://schemas.openxmlformats.org/officeDocument/2006/docPropsVTypes">` +
+	`<TotalTime>12</TotalTime><Words>6</Words><Application>Microsoft Office PowerPoint</Application><PresentationFormat>On-screen Show (4:3)</PresentationFormat>` +
+	`<Paragraphs>3</Paragraphs><Slides>3</Slides><Notes>0</Notes><HiddenSlides>0</HiddenSlides><MMClips>0</MMClips><ScaleCrop>false</ScaleCrop>
+  <HeadingPairs>
+    <vt:vector size="6" baseType="variant">
+      <vt:variant><vt:lpstr>Fonts Used</vt:lpstr></vt:variant>
+      <vt:variant><vt:i4>1</vt:i4></vt:variant>
+      <vt:variant><vt:lpstr>Theme</vt:lpstr></vt:variant>
+      <vt:variant><vt:i4>1</vt:i4></vt:variant>
+      <vt:variant><vt:lpstr>Slide Titles</vt:lpstr></vt:variant>
+      <vt:variant><vt:i4>3</vt:i4></vt:variant>
+    </vt:vector>
+  </HeadingPairs>
+  <TitlesOfParts>
+    <vt:vector size="5" baseType="lpstr">
+      <vt:lpstr>Calibri</vt:lpstr>
+      <vt:lpstr>Office</vt:lpstr>
+      <vt:lpstr>Title 1</vt:lpstr>
+      <vt:lpstr>Title 2</vt:lpstr>
+      <vt:lpstr>Title 3</vt:lpstr>
+    </vt:vector>
+  </TitlesOfParts>` +
+	`<LinksUpToDate>false</LinksUpToDate><SharedDoc>false</SharedDoc><HyperlinksChanged>false</HyperlinksChanged><AppVersion>16.0000</AppVersion></Properties>`
+
+// appProperties adds application properties, and a title to each slide
+func (d *testDeck) appProperties(slides int, content string) {
+	d.add("docProps/app.xml", "application/vnd.openxmlformats-officedocument.extended-properties+xml", content)
+	d.rel("", "extended-properties", "docProps/app.xml")
+	for i := 1; i <= slides; i++ {
+		name := fmt.Sprintf("ppt/slides/slide%d.xml", i)
+		d.shapes[name] = append(d.shapes[name], fmt.Sprintf(`<p:sp><p:nvSpPr><p:cNvPr id="2" name="Title"/><p:cNvSpPr/><p:nvPr><p:ph type="title"/></p:nvPr></p:nvSpPr>`+
+			`<p:spPr/><p:txBody><a:bodyPr/><a:p><a:r><a:t>Title %d</a:t></a:r></a:p></p:txBody></p:sp>`, i))
+	}
+}
+
+func TestUpdateAppPropertiesKeepsFormatting(t *testing.T) {
+	d := newTestDeck(3)
+	d.appProperties(3, testAppProperties)
+	p := d.parse(t)
+	p.UpdateAppProperties()
+	_, parts := saveTestFile(t, p)
+	if got := string(parts["docProps/app.xml"]); got != xmlHeader+testAppProperties {
+		t.Errorf("unchanged application properties rewritten:\n%s\nwant:\n%s%s", got, xmlHeader, testAppProperties)
+	}
+
+	d = newTestDeck(3)
+	d.appProperties(3, testAppProperties)
+	p = d.parse(t)
+	p.RemoveSlide(1)
+	p.UpdateAppProperties()
+	_, parts = saveTestFile(t, p)
+	want := xmlHeader + strings.NewReplacer(
+		"<Slides>3</Slides>", "<Slides>2</Slides>",
+		"<vt:i4>3</vt:i4>", "<vt:i4>2</vt:i4>",
+		`<vt:vector size="5" baseType="lpstr">`, `<vt:vector size="4" baseType="lpstr">`,
+		"\n      <vt:lpstr>Title 2</vt:lpstr>", "",
+	).Replace(testAppProperties)
+	if got := string(parts["docProps/app.xml"]); got != want {
+		t.Errorf("application properties after removing a slide:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestUpdateAppPropertiesFindsSlideTitles(t *testing.T) {
+	customShows := strings.NewReplacer(
+		`<vt:vector size="6" baseType="variant">`, `<vt:vector size="8" baseType="variant">`,
+		"      <vt:variant><vt:i4>3</vt:i4></vt:variant>\n", "      <vt:variant><vt:i4>3</vt:i4></vt:variant>\n      <vt:variant><vt:lpstr>Custom Shows</vt:lpstr></vt:variant>\n      <vt:variant><vt:i4>1</vt:i4></vt:variant>\n",
+		`<vt:vector size="5" baseType="lpstr">`, `<vt:vector size="6" baseType="lpstr">`,
+		"      <vt:lpstr>Title 3</vt:lpstr>\n", "      <vt:lpstr>Title 3</vt:lpstr>\n      <vt:lpstr>Short</vt:lpstr>\n",
+	)
+	removed := strings.NewReplacer(
+		"<Slides>3</Slides>", "<Slides>2</Slides>",
+		"<vt:i4>3</vt:i4>", "<vt:i4>2</vt:i4>",
+		`<vt:vector size="5" baseType="lpstr">`, `<vt:vector size="4" baseType="lpstr">`,
+		`<vt:vector size="6" baseType="lpstr">`, `<vt:vector size="5" baseType="lpstr">`,
+		"\n      <vt:lpstr>Title 2</vt:lpstr>", "",
+	)
+	// a localized group not matching the slide count is no slide titles group, only the count is updated
+	unknown := strings.NewReplacer(
+		"Slide Titles", "Diapositives",
+		"<vt:i4>3</vt:i4>", "<vt:i4>2</vt:i4>",
+		"<vt:lpstr>Calibri</vt:lpstr>", "<vt:lpstr>Calibri</vt:lpstr>\n      <vt:lpstr>Title 0</vt:lpstr>",
+		`<vt:vector size="5" baseType="lpstr">`, `<vt:vector size="4" baseType="lpstr">`,
+		`<vt:variant><vt:i4>1</vt:i4></vt:variant>
+      <vt:variant><vt:lpstr>Theme`, `<vt:variant><vt:i4>2</vt:i4></vt:variant>
+      <vt:variant><vt:lpstr>Theme`,
+		"\n      <vt:lpstr>Title 3</vt:lpstr>", "",
+	).Replace(testAppProperties)
+	tests := []struct {
+		name string
+		app  string
+		want string
+	}{
+		{"heading", customShows.Replace(testAppProperties), removed.Replace(customShows.Replace(testAppProperties))},
+		{"localized heading", strings.Replace(testAppProperties, "Slide Titles", "Titres des diapositives", 1),
+			removed.Replace(strings.Replace(testAppProperties, "Slide Titles", "Titres des diapositives", 1))},
+		{"localized heading and custom shows", strings.Replace(customShows.Replace(testAppProperties), "Slide Titles", "Titres des diapositives", 1),
+			removed.Replace(strings.Replace(customShows.Replace(testAppProperties), "Slide Titles", "Titres des diapositives", 1))},
+		{"unknown", unknown, strings.Replace(unknown, "<Slides>3</Slides>", "<Slides>2</Slides>", 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDeck(3)
+			d.appProperties(3, tt.app)
+			p := d.parse(t)
+			p.RemoveSlide(1)
+			p.UpdateAppProperties()
+			_, parts := saveTestFile(t, p)
+			if got := string(parts["docProps/app.xml"]); got != xmlHeader+tt.want {
+				t.Errorf("application properties after removing a slide:\n%s\nwant:\n%s%s", got, xmlHeader, tt.want)
+			}
+		})
+	}
+}
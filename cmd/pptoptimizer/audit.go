@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image"
+)
+
+const auditPartName = "pptoptimizer/audit.xml"
+const auditContentType = "application/vnd.pptoptimizer.audit+xml"
+const auditRelationshipType = "https://github.com/gillesgagniard/pptoptimizer/relationships/audit"
+
+type AuditPicture struct {
+	Name   string `xml:"name,attr"`
+	Format string `xml:"format,attr,omitempty"`
+	Width  int    `xml:"width,attr,omitempty"`
+	Height int    `xml:"height,attr,omitempty"`
+	Size   uint64 `xml:"size,attr"`
+}
+
+type AuditEntry struct {
+	Original   AuditPicture  `xml:"original"`
+	Optimized  *AuditPicture `xml:"optimized,omitempty"`
+	Operations []string      `xml:"operation"`
+}
+
+type Audit struct {
+	XMLName xml.Name      `xml:"urn:pptoptimizer:audit optimizations"`
+	Medias  []*AuditEntry `xml:"media"`
+}
+
+func (p *PowerpointDoc) SetAudit(audit bool) {
+	p.auditEnabled = audit
+}
+
+func (p *PowerpointDoc) auditPicture(name string) AuditPicture {
+	info := AuditPicture{Name: name, Size: p.medias[name].size}
+	data, err := p.ReadMedia(name)
+	if err != nil {
+		p.Problem(err)
+	}
+	if cfg, format, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		info.Format, info.Width, info.Height = format, cfg.Width, cfg.Height
+	} else {
+		info.Format = mediaExtension(name)
+	}
+	return info
+}
+
+// auditMedia records an operation changing a media, before it is applied. newname is empty when the media is removed.
+func (p *PowerpointDoc) auditMedia(name string, newname string, operation string) {
+	if !p.auditEnabled && !p.keepOriginals {
+		return
+	}
+	entry, ok := p.audit[name]
+	if !ok {
+		entry = &AuditEntry{Original: p.auditPicture(name)}
+		p.auditOrder = append(p.auditOrder, entry)
+	}
+	entry.Operations = append(entry.Operations, operation)
+	delete(p.audit, name)
+	if newname != "" {
+		p.audit[newname] = entry
+	}
+}
+
+// ReplaceMedia updates the content of a media
+func (p *PowerpointDoc) ReplaceMedia(name string, data []byte, operation string) {
+	p.auditMedia(name, name, operation)
+	p.decoded.remove(name)
+	p.medias[name] = p.newMedia(data)
+}
+
+func (p *PowerpointDoc) saveAudit(outz *packageWriter) error {
+	if !p.auditEnabled || len(p.auditOrder) == 0 {
+		return nil
+	}
+	for name, entry := range p.audit {
+		optimized := p.auditPicture(name)
+		entry.Optimized = &optimized
+	}
+	fo, err := outz.Create(auditPartName)
+	if err != nil {
+		return err
+	}
+	xmlout, _ := xml.Marshal(Audit{Medias: p.auditOrder})
+	if _, err := fo.Write(append([]byte(xmlHeader), xmlout...)); err != nil {
+		return err
+	}
+
+	p.contentTypes.RemoveOverride(auditPartName)
+	p.contentTypes.Override = append(p.contentTypes.Override, TypeOverride{PartName: "/" + auditPartName, ContentType: auditContentType})
+	for _, rel := range p.packageRels.Relationship {
+		if rel.Type == auditRelationshipType {
+			return nil
+		}
+	}
+	p.packageRels.Relationship = append(p.packageRels.Relationship, Relationship{Id: p.packageRels.NewId(), Type: auditRelationshipType, Target: auditPartName})
+	return nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// BatchResult is the outcome of the optimization of one file of a batch
+type BatchResult struct {
+	File   string
+	Report *Report // nil when the file was skipped or failed
+	Err    string
+}
+
+// batchFiles expands the directories to the presentations and templates they contain, leaving out the outputs
+// of previous runs, and returns the files sorted by name
+func batchFiles(paths []string) ([]string, error) {
+	files := []string{}
+	for _, root := range paths {
+		err := filepath.Walk(root, func(name string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			ext := strings.ToLower(filepath.Ext(name))
+			if name == root || ((ext == ".pptx" || ext == ".potx") && !strings.HasSuffix(strings.ToLower(name), ".new.pptx")) {
+				files = append(files, name)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// optimize flags batch sets itself for each file
+var batchSetFlags = map[string]bool{"f": true, "reportformat": true, "reportfile": true}
+
+// flagName returns the name of a flag argument such as -f, --reportformat=json, or "" for a value
+func flagName(arg string) string {
+	if !strings.HasPrefix(arg, "-") {
+		return ""
+	}
+	name := strings.TrimLeft(arg, "-")
+	if i := strings.Index(name, "="); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+var reLogMessage = regexp.MustCompile(`msg=("(?:[^"\\]|\\.)*")`)
+
+// lastMessage returns the message of the last log line of a command, usually the fatal error
+func lastMessage(out []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	last := lines[len(lines)-1]
+	if m := reLogMessage.FindStringSubmatch(last); m != nil {
+		if msg, err := strconv.Unquote(m[1]); err == nil {
+			return msg
+		}
+	}
+	return last
+}
+
+// runBatch optimizes each file in its own process, so that a file failing or exhausting memory does not stop
+// the others, with up to parallel files at once
+func runBatch(files []string, optimizeArgs []string, parallel int) []BatchResult {
+	self, err := os.Executable()
+	if err != nil {
+		exitWith(exitFailure, "cannot find the pptoptimizer executable:", err)
+	}
+	results := make([]BatchResult, len(files))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				// each worker only writes the results of its files
+				results[i] = optimizeInProcess(self, files[i], optimizeArgs)
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+func optimizeInProcess(self string, file string, optimizeArgs []string) BatchResult {
+	result := BatchResult{File: file}
+	// the report goes to its own file, since flags such as -diff or -summaryonly print on stdout
+	reportf, err := ioutil.TempFile("", "pptoptimizer-report-*.json")
+	if err != nil {
+		result.Err = err.Error()
+		return result
+	}
+	reportf.Close()
+	defer os.Remove(reportf.Name())
+	args := append([]string{"optimize", "-f", file}, optimizeArgs...)
+	args = append(args, "-reportformat", "json", "-reportfile", reportf.Name())
+	cmd := exec.Command(self, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	log.Debugln("optimize", file)
+	runErr := cmd.Run()
+	// the report is written before the problems and warnings exits, so it is read whatever the exit code
+	report, err := readBatchReport(reportf.Name())
+	if err != nil {
+		result.Err = err.Error()
+		return result
+	}
+	result.Report = report
+	if runErr != nil {
+		if exitErr, ok := runErr.(*exec.ExitError); ok && exitErr.ExitCode() == exitNoSavings {
+			// not smaller with -nobloat, no output written
+			result.Report = nil
+			log.Infoln("skipped", file, ":", lastMessage(stderr.Bytes()))
+			return result
+		}
+		result.Err = runErr.Error()
+		if stderr.Len() > 0 {
+			result.Err = lastMessage(stderr.Bytes())
+		}
+		log.Warnln("cannot optimize", file, ":", result.Err)
+		return result
+	}
+	log.Infoln("optimized", file)
+	return result
+}
+
+// readBatchReport reads the json report of one file, nil when none was written
+func readBatchReport(name string) (*Report, error) {
+	out, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read report: %w", err)
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	var report Report
+	if err := json.Unmarshal(out, &report); err != nil {
+		return nil, fmt.Errorf("invalid report: %w", err)
+	}
+	return &report, nil
+}
+
+// printBatchSummary prints the result of each file, in the order of the file names, and the totals
+func printBatchSummary(w io.Writer, results []BatchResult) {
+	var before, after int64
+	failed, skipped := 0, 0
+	for _, r := range results {
+		switch {
+		case r.Err != "" && r.Report != nil:
+			// written, but with problems or with warnings under -failonwarn
+			failed++
+			before += r.Report.SizeBefore
+			after += r.Report.SizeAfter
+			fmt.Fprintf(w, "%s, %d warnings, failed: %s\n", summaryLine(r.File, r.Report.SizeBefore, r.Report.SizeAfter), r.Report.Warnings, r.Err)
+		case r.Err != "":
+			failed++
+			fmt.Fprintf(w, "%s: failed: %s\n", r.File, r.Err)
+		case r.Report == nil:
+			skipped++
+			fmt.Fprintf(w, "%s: skipped\n", r.File)
+		default:
+			before += r.Report.SizeBefore
+			after += r.Report.SizeAfter
+			fmt.Fprintf(w, "%s, %d warnings\n", summaryLine(r.File, r.Report.SizeBefore, r.Report.SizeAfter), r.Report.Warnings)
+		}
+	}
+	fmt.Fprintf(w, "%d files, %d optimized, %d skipped, %d failed, %d -> %d bytes, saved %.1f%%\n",
+		len(results), len(results)-failed-skipped, skipped, failed, before, after, savedPercent(before, after))
+}
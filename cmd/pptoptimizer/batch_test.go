@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestBatchSetFlags(t *testing.T) {
+	tests := []struct {
+		arg string
+		set bool
+	}{
+		{"-f", true},
+		{"-f=deck.pptx", true},
+		{"--f", true},
+		{"-reportformat", true},
+		{"--reportformat=csv", true},
+		{"-reportfile=out.json", true},
+		{"-o", false},
+		{"-diff", false},
+		{"-summaryonly", false},
+		{"-formats", false},
+		{"deck.pptx", false},
+		{"json", false},
+	}
+	for _, tt := range tests {
+		if set := batchSetFlags[flagName(tt.arg)]; set != tt.set {
+			t.Errorf("%s set by batch: %v, want %v", tt.arg, set, tt.set)
+		}
+	}
+}
+
+func TestPrintBatchSummary(t *testing.T) {
+	results := []BatchResult{
+		{File: "a.pptx", Report: &Report{SizeBefore: 1000, SizeAfter: 500}},
+		{File: "b.pptx"},
+		{File: "c.pptx", Report: &Report{SizeBefore: 1000, SizeAfter: 900, Warnings: 2}, Err: "exit status 5"},
+		{File: "d.pptx", Err: "zip: not a valid zip file"},
+	}
+	var out bytes.Buffer
+	printBatchSummary(&out, results)
+	want := `a.pptx: 1000 -> 500 bytes, saved 50.0%, 0 warnings
+b.pptx: skipped
+c.pptx: 1000 -> 900 bytes, saved 10.0%, 2 warnings, failed: exit status 5
+d.pptx: failed: zip: not a valid zip file
+4 files, 1 optimized, 1 skipped, 2 failed, 2000 -> 1400 bytes, saved 30.0%
+`
+	if out.String() != want {
+		t.Errorf("summary:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestReadBatchReport(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty.json")
+	if err := ioutil.WriteFile(empty, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := readBatchReport(empty); r != nil || err != nil {
+		t.Errorf("empty report: %v, %v, want nil, nil", r, err)
+	}
+	written := filepath.Join(dir, "written.json")
+	if err := ioutil.WriteFile(written, []byte(`{"sizeBefore": 1000, "sizeAfter": 500}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := readBatchReport(written); err != nil || r == nil || r.SizeAfter != 500 {
+		t.Errorf("written report: %v, %v, want a size after of 500", r, err)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"github.com/beevik/etree"
+)
+
+func (r Relationships) clone() Relationships {
+	r.Relationship = append([]Relationship(nil), r.Relationship...)
+	return r
+}
+
+func cloneRelationships(rels []Relationships) []Relationships {
+	if rels == nil {
+		return nil
+	}
+	out := make([]Relationships, len(rels))
+	for i, r := range rels {
+		out[i] = r.clone()
+	}
+	return out
+}
+
+func cloneDocument(doc *etree.Document) *etree.Document {
+	if doc == nil {
+		return nil
+	}
+	return doc.Copy()
+}
+
+// Clone returns an independent copy of a parsed document, so that different optimizations can be applied to each copy,
+// possibly in parallel. A PowerpointDoc is not safe for concurrent use, but clones do not share any mutable state:
+// each one opens its own reader on the source file and must be closed. Documents parsed with ParseReader share their reader.
+// Media contents in memory are shared, they are never modified in place, only replaced.
+func (p *PowerpointDoc) Clone() (*PowerpointDoc, error) {
+	c := *p
+	if p.sourceCloser != nil {
+		r, file, err := openZipFile(p.sourceFileName)
+		if err != nil {
+			return nil, err
+		}
+		c.sourceFileReader = r
+		c.sourceCloser = file
+		c.sourceAt = file
+		renameSourceParts(c.sourceFileReader, p.renamedParts)
+	}
+
+	c.parts = make(map[string]*etree.Document, len(p.parts))
+	for name, doc := range p.parts {
+		c.parts[name] = cloneDocument(doc)
+	}
+	c.medias = make(map[string]Media, len(p.medias))
+	c.spilled = nil
+	if p.decoded != nil {
+		c.decoded = newDecodeCache(p.decoded.limit)
+	}
+	for name, m := range p.medias {
+		if m.file != "" {
+			file, err := c.copySpilled(m.file)
+			if err != nil {
+				c.Close()
+				return nil, err
+			}
+			m.file = file
+		}
+		c.medias[name] = m
+	}
+	c.slideRels = cloneRelationships(p.slideRels)
+	c.slideLayoutRels = cloneRelationships(p.slideLayoutRels)
+	c.slideMasterRels = cloneRelationships(p.slideMasterRels)
+	c.presentationRels = p.presentationRels.clone()
+	c.packageRels = p.packageRels.clone()
+	c.otherRels = make(map[string]Relationships, len(p.otherRels))
+	for name, r := range p.otherRels {
+		c.otherRels[name] = r.clone()
+	}
+	c.keptLayouts = append([]string(nil), p.keptLayouts...)
+	c.removedSlides = append([]bool(nil), p.removedSlides...)
+	c.removedLayouts = append([]bool(nil), p.removedLayouts...)
+	c.removedMasters = append([]bool(nil), p.removedMasters...)
+	c.removedParts = make(map[string]bool, len(p.removedParts))
+	for name := range p.removedParts {
+		c.removedParts[name] = true
+	}
+	if p.mediaFormats != nil {
+		c.mediaFormats = make(map[string]MediaFormat, len(p.mediaFormats))
+		for name, f := range p.mediaFormats {
+			c.mediaFormats[name] = f
+		}
+	}
+	c.convertedFormats = make(map[string]MediaFormat, len(p.convertedFormats))
+	for name, f := range p.convertedFormats {
+		c.convertedFormats[name] = f
+	}
+	if p.mediaTail != nil {
+		c.mediaTail = make(map[string]bool, len(p.mediaTail))
+		for name := range p.mediaTail {
+			c.mediaTail[name] = true
+		}
+	}
+	c.replacedParts = make(map[string][]byte, len(p.replacedParts))
+	for name, data := range p.replacedParts {
+		c.replacedParts[name] = data
+	}
+
+	// audit entries are shared between the map and the ordered list
+	copies := make(map[*AuditEntry]*AuditEntry, len(p.auditOrder))
+	c.auditOrder = make([]*AuditEntry, len(p.auditOrder))
+	for i, entry := range p.auditOrder {
+		e := *entry
+		e.Operations = append([]string(nil), entry.Operations...)
+		copies[entry] = &e
+		c.auditOrder[i] = &e
+	}
+	c.audit = make(map[string]*AuditEntry, len(p.audit))
+	for name, entry := range p.audit {
+		c.audit[name] = copies[entry]
+	}
+
+	c.manifest = append([]ManifestEntry(nil), p.manifest...)
+	c.problems = append([]error(nil), p.problems...)
+	c.mediaErrors = append([]error(nil), p.mediaErrors...)
+	c.skippedTiffs = append([]string(nil), p.skippedTiffs...)
+	c.signatures = append([]string(nil), p.signatures...)
+	c.slideMasters = make([]*etree.Document, len(p.slideMasters))
+	for i, doc := range p.slideMasters {
+		c.slideMasters[i] = cloneDocument(doc)
+	}
+	c.presentation = cloneDocument(p.presentation)
+	c.contentTypes.Default = append([]TypeDefault(nil), p.contentTypes.Default...)
+	c.contentTypes.Override = append([]TypeOverride(nil), p.contentTypes.Override...)
+	return &c, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestCloneDoesNotShareState(t *testing.T) {
+	d := newTestDeck(2)
+	d.image("ppt/slides/slide1.xml", "ppt/media/image1.png", testPNG(40, 30))
+	d.image("ppt/slides/slide2.xml", "ppt/media/image2.png", testPNG(30, 40))
+	p := d.parse(t)
+	p.SetMediaFormats(map[string]MediaFormat{"image1.png": {Format: "jpeg"}, "image2.png": {Format: "jpeg", Quality: 50}})
+	p.skippedTiffs = make([]string, 0, 4)
+	p.mediaErrors = make([]error, 0, 4)
+
+	clones := make([]*PowerpointDoc, 4)
+	for i := range clones {
+		c, err := p.Clone()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		clones[i] = c
+	}
+	// clones converting at once must not write any shared map
+	var wg sync.WaitGroup
+	for _, c := range clones {
+		wg.Add(1)
+		go func(c *PowerpointDoc) {
+			defer wg.Done()
+			c.ConvertMediaFormats()
+		}(c)
+	}
+	wg.Wait()
+
+	for _, c := range clones {
+		if _, ok := c.medias["ppt/media/image1.jpeg"]; !ok {
+			t.Errorf("clone medias %v, want image1.jpeg", c.MediaNames())
+		}
+	}
+	if _, ok := p.medias["ppt/media/image1.png"]; !ok {
+		t.Errorf("original medias %v, want image1.png", p.MediaNames())
+	}
+	if len(p.convertedFormats) != 0 || len(p.mediaFormats) != 2 {
+		t.Errorf("original formats changed by the clones: %v %v", p.convertedFormats, p.mediaFormats)
+	}
+
+	c := clones[0]
+	c.skippedTiffs = append(c.skippedTiffs, "clone")
+	p.skippedTiffs = append(p.skippedTiffs, "original")
+	c.signatures = append(c.signatures, "clone")
+	c.mediaErrors = append(c.mediaErrors, ErrMediaDecode)
+	p.mediaErrors = append(p.mediaErrors, ErrEncrypted)
+	if c.skippedTiffs[0] != "clone" || c.mediaErrors[0] != ErrMediaDecode || len(p.signatures) != 0 {
+		t.Errorf("clone slices share the original ones: %v %v %v", c.skippedTiffs, c.mediaErrors, p.signatures)
+	}
+}
+
+func TestConvertedFormatFollowsOnlyItsMedia(t *testing.T) {
+	d := newTestDeck(1)
+	d.image("ppt/slides/slide1.xml", "ppt/media/image1.png", testPNG(40, 30))
+	d.image("ppt/slides/slide1.xml", "ppt/pictures/image1.jpeg", testPNG(30, 40))
+	p := d.parse(t)
+	p.SetMediaFormats(map[string]MediaFormat{"image1.png": {Format: "jpeg", Quality: 40}})
+	p.ConvertMediaFormats()
+
+	if f, ok := p.mediaFormat("ppt/media/image1.jpeg"); !ok || f.Quality != 40 {
+		t.Errorf("converted media format %v %v, want jpeg 40", f, ok)
+	}
+	if f, ok := p.mediaFormat("ppt/pictures/image1.jpeg"); ok {
+		t.Errorf("media of the same base name in another folder has the format %v", f)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// isCMYKJPEG tells whether a jpeg is stored in the CMYK color space, as written by print oriented tools
+func isCMYKJPEG(data []byte) bool {
+	config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	return err == nil && config.ColorModel == color.CMYKModel
+}
+
+// ConvertCMYKJPEGs converts CMYK jpegs to RGB, which some viewers render with wrong colors.
+// The conversion ignores any embedded color profile, the CMYK profile is then dropped.
+func (p *PowerpointDoc) ConvertCMYKJPEGs() {
+	for _, name := range p.MediaNames() {
+		data, format := p.readMediaOfFormat(name, "jpeg")
+		if format == "" || !isCMYKJPEG(data) {
+			continue
+		}
+		img, err := p.decodeMedia(name, "jpeg", data)
+		if err != nil {
+			p.mediaDecodeFailed(name, err)
+			continue
+		}
+		rgb := image.NewRGBA(img.Bounds())
+		draw.Draw(rgb, rgb.Bounds(), img, img.Bounds().Min, draw.Src)
+		out, err := encodeImage(rgb, "jpeg", p.jpegQuality(name))
+		if err != nil {
+			log.Warnln("cannot encode jpeg", name, ":", err)
+			continue
+		}
+		log.Infoln("converted cmyk jpeg", name, "to rgb", len(data), "->", len(out))
+		p.ReplaceMedia(name, out, "converted from CMYK to RGB")
+	}
+}
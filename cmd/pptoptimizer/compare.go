@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// MediaChange describes a media which differs between two documents, with an empty name on the side it is missing
+type MediaChange struct {
+	Before MediaInfo
+	After  MediaInfo
+}
+
+// Comparison is the structural difference between an original document and its optimized version
+type Comparison struct {
+	Medias       []MediaChange
+	RemovedParts []string
+	AddedParts   []string
+	SizeBefore   uint64 // compressed size of all parts
+	SizeAfter    uint64
+	SlidesBefore int
+	SlidesAfter  int
+}
+
+func (p *PowerpointDoc) partNames() map[string]bool {
+	names := make(map[string]bool)
+	for _, f := range p.sourceFileReader.File {
+		if !p.mediaParts[f.Name] && !strings.HasSuffix(f.Name, "/") {
+			names[f.Name] = true
+		}
+	}
+	return names
+}
+
+func (p *PowerpointDoc) compressedSize() uint64 {
+	size := uint64(0)
+	for _, f := range p.sourceFileReader.File {
+		size += f.CompressedSize64
+	}
+	return size
+}
+
+// Compare lists the medias whose size or format changed, the medias and parts removed or added, and the sizes
+// of both documents. A media whose extension changed, such as image1.tiff converted to image1.png, is paired.
+func Compare(a *PowerpointDoc, b *PowerpointDoc) Comparison {
+	c := Comparison{SizeBefore: a.compressedSize(), SizeAfter: b.compressedSize(), SlidesBefore: a.SlideCount(), SlidesAfter: b.SlideCount()}
+
+	after := make(map[string]MediaInfo)
+	for _, m := range b.ListMedia() {
+		after[m.Name] = m
+	}
+	for _, m := range a.ListMedia() {
+		n, ok := after[m.Name]
+		if !ok {
+			for name, info := range after {
+				if strings.TrimSuffix(name, "."+info.Format) == strings.TrimSuffix(m.Name, "."+m.Format) &&
+					!a.hasSourcePart(name) {
+					n, ok = info, true
+					break
+				}
+			}
+		}
+		if ok {
+			delete(after, n.Name)
+			if n.Size == m.Size && n.Format == m.Format && n.Name == m.Name {
+				continue
+			}
+		}
+		c.Medias = append(c.Medias, MediaChange{Before: m, After: n})
+	}
+	for _, n := range after {
+		c.Medias = append(c.Medias, MediaChange{After: n})
+	}
+	sort.SliceStable(c.Medias, func(i, j int) bool {
+		return c.Medias[i].Before.Name+c.Medias[i].After.Name < c.Medias[j].Before.Name+c.Medias[j].After.Name
+	})
+
+	partsBefore, partsAfter := a.partNames(), b.partNames()
+	for name := range partsBefore {
+		if !partsAfter[name] {
+			c.RemovedParts = append(c.RemovedParts, name)
+		}
+	}
+	for name := range partsAfter {
+		if !partsBefore[name] {
+			c.AddedParts = append(c.AddedParts, name)
+		}
+	}
+	sort.Strings(c.RemovedParts)
+	sort.Strings(c.AddedParts)
+	return c
+}
+
+// Print writes the comparison in a readable form
+func (c Comparison) Print(w io.Writer) {
+	fmt.Fprintln(w, "medias:")
+	for _, m := range c.Medias {
+		switch {
+		case m.After.Name == "":
+			fmt.Fprintf(w, "  - %-30s %10d %s\n", m.Before.Name, m.Before.Size, m.Before.Format)
+		case m.Before.Name == "":
+			fmt.Fprintf(w, "  + %-30s %10d %s\n", m.After.Name, m.After.Size, m.After.Format)
+		default:
+			fmt.Fprintf(w, "  ~ %-30s %10d %s -> %s %d %s\n", m.Before.Name, m.Before.Size, m.Before.Format, m.After.Name, m.After.Size, m.After.Format)
+		}
+	}
+	fmt.Fprintln(w, "parts:")
+	for _, name := range c.RemovedParts {
+		fmt.Fprintln(w, "  -", name)
+	}
+	for _, name := range c.AddedParts {
+		fmt.Fprintln(w, "  +", name)
+	}
+	if c.SlidesBefore != c.SlidesAfter {
+		fmt.Fprintln(w, "slide count changed:", c.SlidesBefore, "->", c.SlidesAfter)
+	} else {
+		fmt.Fprintln(w, "slides:", c.SlidesBefore)
+	}
+	saved := int64(c.SizeBefore) - int64(c.SizeAfter)
+	percent := 0.0
+	if c.SizeBefore > 0 {
+		percent = float64(saved) * 100 / float64(c.SizeBefore)
+	}
+	fmt.Fprintf(w, "size: %d -> %d, saved %d bytes (%.1f%%)\n", c.SizeBefore, c.SizeAfter, saved, percent)
+}
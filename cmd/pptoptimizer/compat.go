@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PowerPoint versions, by release year, Microsoft 365 being the latest
+var officeVersions = []string{"2007", "2010", "2013", "2016", "2019", "2021", "2024", "365"}
+
+// minimum PowerPoint version displaying each picture format
+var formatMinVersion = map[string]string{
+	"png": "2007", "jpeg": "2007", "gif": "2007", "bmp": "2007", "tiff": "2007",
+	"svg":  "2016",
+	"webp": "365",
+}
+
+// minimum PowerPoint version opening strict OOXML files
+const strictMinVersion = "2013"
+
+func versionRank(version string) int {
+	for i, v := range officeVersions {
+		if v == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// ParseOfficeVersion checks a PowerPoint version such as 2010 or 365
+func ParseOfficeVersion(version string) (string, error) {
+	if versionRank(version) < 0 {
+		return "", fmt.Errorf("unknown PowerPoint version %s, expected one of %s", version, strings.Join(officeVersions, ", "))
+	}
+	return version, nil
+}
+
+// SetMinVersion sets the oldest PowerPoint version which must be able to display the output, "" for no constraint
+func (p *PowerpointDoc) SetMinVersion(version string) {
+	p.minVersion = version
+}
+
+// supports tells whether a feature available since a PowerPoint version is supported by the minimum version
+func (p *PowerpointDoc) supports(since string) bool {
+	return p.minVersion == "" || versionRank(since) <= versionRank(p.minVersion)
+}
+
+// formatSupported tells whether a pass may write pictures of a format, warning otherwise
+func (p *PowerpointDoc) formatSupported(name string, format string) bool {
+	if since, ok := formatMinVersion[format]; ok && !p.supports(since) {
+		log.Warnln("cannot convert", name, "to", format, ", not supported before PowerPoint", since)
+		return false
+	}
+	return true
+}
+
+func (p *PowerpointDoc) isStrict() bool {
+	for _, rel := range append(p.packageRels.Relationship, p.presentationRels.Relationship...) {
+		if strings.HasPrefix(rel.Type, relTypeStrict) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckCompatibility warns about the medias and package format of the output which the minimum
+// PowerPoint version cannot display
+func (p *PowerpointDoc) CheckCompatibility() {
+	if p.minVersion == "" {
+		return
+	}
+	if p.isStrict() && !p.supports(strictMinVersion) {
+		log.Warnln("strict OOXML files cannot be opened before PowerPoint", strictMinVersion)
+	}
+	for _, name := range p.MediaNames() {
+		format, err := p.SniffMedia(name)
+		if err != nil {
+			p.Problem(err)
+		}
+		if format == "" {
+			format = mediaExtension(name)
+		}
+		if since, ok := formatMinVersion[format]; ok && !p.supports(since) {
+			log.Warnln("media", name, "is a", format, "picture, not displayed before PowerPoint", since)
+		}
+	}
+	log.Debugln("checked compatibility with PowerPoint", p.minVersion)
+}
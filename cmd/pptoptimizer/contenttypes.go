@@ -0,0 +1,169 @@
+package main
+
+import (
+	"path"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// content types of parts which are usually declared by extension
+var defaultContentTypes = map[string]string{
+	"rels":    "application/vnd.openxmlformats-package.relationships+xml",
+	"xml":     "application/xml",
+	"mp4":     "video/mp4",
+	"m4v":     "video/mp4",
+	"mov":     "video/quicktime",
+	"wmv":     "video/x-ms-wmv",
+	"avi":     "video/avi",
+	"mp3":     "audio/mpeg",
+	"m4a":     "audio/mp4",
+	"wav":     "audio/wav",
+	"wma":     "audio/x-ms-wma",
+	"wdp":     "image/vnd.ms-photo",
+	"fntdata": "application/x-fontdata",
+	"bin":     "application/vnd.openxmlformats-officedocument.oleObject",
+	"vml":     "application/vnd.openxmlformats-officedocument.vmlDrawing",
+	"xlsx":    "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"docx":    "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+}
+
+func defaultContentType(ext string) string {
+	ext = strings.ToLower(ext)
+	if ct, ok := imageContentTypes[ext]; ok {
+		return ct
+	}
+	return defaultContentTypes[ext]
+}
+
+// Normalize removes duplicate defaults and overrides, drops overrides of parts not in the package,
+// and adds missing defaults for parts which would not have a content type
+func (t *Types) Normalize(parts []string) {
+	present := make(map[string]bool)
+	for _, part := range parts {
+		present["/"+part] = true
+	}
+
+	defaults := []TypeDefault{}
+	seenDefaults := make(map[string]bool)
+	for _, d := range t.Default {
+		if ext := strings.ToLower(d.Extension); seenDefaults[ext] {
+			log.Infoln("remove duplicate content type for extension", d.Extension)
+		} else {
+			seenDefaults[ext] = true
+			defaults = append(defaults, d)
+		}
+	}
+	t.Default = defaults
+
+	overrides := []TypeOverride{}
+	seenOverrides := make(map[string]bool)
+	for _, o := range t.Override {
+		if !present[o.PartName] {
+			log.Infoln("remove content type of missing part", o.PartName)
+		} else if seenOverrides[o.PartName] {
+			log.Infoln("remove duplicate content type of part", o.PartName)
+		} else {
+			seenOverrides[o.PartName] = true
+			overrides = append(overrides, o)
+		}
+	}
+	t.Override = overrides
+
+	for _, part := range parts {
+		if part == "[Content_Types].xml" || seenOverrides["/"+part] {
+			continue
+		}
+		ext := strings.TrimPrefix(path.Ext(part), ".")
+		if seenDefaults[strings.ToLower(ext)] {
+			continue
+		}
+		if ct := defaultContentType(ext); ct != "" {
+			log.Infoln("add missing content type", ct, "for extension", ext)
+			t.AddDefault(ext, ct)
+			seenDefaults[strings.ToLower(ext)] = true
+		} else {
+			log.Warnln("part", part, "has no content type")
+		}
+	}
+}
+
+const presentationMLType = "application/vnd.openxmlformats-officedocument.presentationml."
+
+// content types of the main part, by extension of the file
+var mainContentTypes = map[string]string{
+	".pptx": presentationMLType + "presentation.main+xml",
+	".potx": presentationMLType + "template.main+xml",
+	".ppsx": presentationMLType + "slideshow.main+xml",
+	".pptm": "application/vnd.ms-powerpoint.presentation.macroEnabled.main+xml",
+}
+
+// content types of the parts, by the last segment of the type of the relationships to them
+var relationshipContentTypes = map[string]string{
+	"slide":               presentationMLType + "slide+xml",
+	"slideLayout":         presentationMLType + "slideLayout+xml",
+	"slideMaster":         presentationMLType + "slideMaster+xml",
+	"notesSlide":          presentationMLType + "notesSlide+xml",
+	"notesMaster":         presentationMLType + "notesMaster+xml",
+	"handoutMaster":       presentationMLType + "handoutMaster+xml",
+	"presProps":           presentationMLType + "presProps+xml",
+	"viewProps":           presentationMLType + "viewProps+xml",
+	"tableStyles":         presentationMLType + "tableStyles+xml",
+	"commentAuthors":      presentationMLType + "commentAuthors+xml",
+	"comments":            presentationMLType + "comments+xml",
+	"tags":                presentationMLType + "tags+xml",
+	"theme":               "application/vnd.openxmlformats-officedocument.theme+xml",
+	"chart":               "application/vnd.openxmlformats-officedocument.drawingml.chart+xml",
+	"chartUserShapes":     "application/vnd.openxmlformats-officedocument.drawingml.chartshapes+xml",
+	"diagramData":         "application/vnd.openxmlformats-officedocument.drawingml.diagramData+xml",
+	"diagramLayout":       "application/vnd.openxmlformats-officedocument.drawingml.diagramLayout+xml",
+	"diagramColors":       "application/vnd.openxmlformats-officedocument.drawingml.diagramColors+xml",
+	"diagramQuickStyle":   "application/vnd.openxmlformats-officedocument.drawingml.diagramStyle+xml",
+	"diagramDrawing":      "application/vnd.ms-office.drawingml.diagramDrawing+xml",
+	"core-properties":     "application/vnd.openxmlformats-package.core-properties+xml",
+	"extended-properties": "application/vnd.openxmlformats-officedocument.extended-properties+xml",
+	"custom-properties":   "application/vnd.openxmlformats-officedocument.custom-properties+xml",
+	"customXmlProps":      "application/vnd.openxmlformats-officedocument.customXmlProperties+xml",
+	"vbaProject":          "application/vnd.ms-office.vbaProject",
+}
+
+// rebuildContentTypes declares the content types of a package whose [Content_Types].xml is missing or empty,
+// from the relationships to its parts and the extensions of the others
+func (p *PowerpointDoc) rebuildContentTypes() {
+	p.contentTypes = Types{}
+	present := make(map[string]bool, len(p.sourceFileReader.File))
+	names := make([]string, 0, len(p.sourceFileReader.File))
+	for _, f := range p.sourceFileReader.File {
+		present[f.Name] = true
+		names = append(names, f.Name)
+	}
+	mainType, ok := mainContentTypes[strings.ToLower(path.Ext(p.sourceFileName))]
+	if !ok {
+		mainType = mainContentTypes[".pptx"]
+	}
+	for _, f := range p.sourceFileReader.File {
+		if path.Ext(f.Name) != ".rels" {
+			continue
+		}
+		rels, err := parseRelationships(f)
+		if err != nil {
+			log.Warnln(err, ", content types of the parts it references unknown")
+			continue
+		}
+		source := relsSourcePart(f.Name)
+		for _, rel := range rels.Relationship {
+			target := resolveTarget(source, rel.Target)
+			if rel.TargetMode == "External" || !present[target] || p.contentTypes.ContentTypeOf(target) != "" {
+				continue
+			}
+			contentType := relationshipContentTypes[path.Base(rel.Type)]
+			if rel.Is("officeDocument") {
+				contentType = mainType
+			}
+			if contentType != "" {
+				p.contentTypes.Override = append(p.contentTypes.Override, TypeOverride{PartName: "/" + target, ContentType: contentType})
+			}
+		}
+	}
+	p.contentTypes.Normalize(names)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// withContentTypes writes a package with its [Content_Types].xml replaced, or left out if nil
+func withContentTypes(t *testing.T, data []byte, contentTypes []byte) string {
+	t.Helper()
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := bytes.NewBuffer(nil)
+	z := zip.NewWriter(buf)
+	for _, f := range r.File {
+		part := contentTypes
+		if f.Name != "[Content_Types].xml" {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			part, err = ioutil.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+		} else if contentTypes == nil {
+			continue
+		}
+		w, err := z.Create(f.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(part); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(t.TempDir(), "deck.pptx")
+	if err := ioutil.WriteFile(name, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestRebuildContentTypes(t *testing.T) {
+	d := newTestDeck(2)
+	d.layout(false)
+	d.image("ppt/slides/slide1.xml", "ppt/media/image1.png", testPNG(10, 10))
+	d.image("ppt/slideMasters/slideMaster1.xml", "ppt/media/image2.jpeg", testPNG(10, 12))
+	d.notes(1, "ppt/theme/theme1.xml")
+	d.appProperties(0, testAppProperties)
+	data := d.bytes(t)
+
+	for _, tt := range []struct {
+		name         string
+		contentTypes []byte
+	}{
+		{"missing", nil},
+		{"empty", []byte{}},
+		{"blank", []byte(" \n")},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parseTestFile(t, withContentTypes(t, data, tt.contentTypes))
+			_, parts := saveTestFile(t, p)
+			types := Types{}
+			if err := xml.Unmarshal(parts["[Content_Types].xml"], &types); err != nil {
+				t.Fatal(err)
+			}
+			for name := range parts {
+				if name == "[Content_Types].xml" {
+					continue
+				}
+				if got, want := types.ContentTypeOf(name), d.types.ContentTypeOf(name); got != want {
+					t.Errorf("content type of %s is %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
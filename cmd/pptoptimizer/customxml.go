@@ -0,0 +1,96 @@
+package main
+
+import (
+	"path"
+	"regexp"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var reCustomXMLItem = regexp.MustCompile(`^customXml/item[0-9]+\.xml$`)
+
+// referencedParts returns the parts targeted by the relationships of the package, from the rels kept in memory
+// and those copied verbatim, except the rels of the parts for which skip returns true
+func (p *PowerpointDoc) referencedParts(skip func(source string) bool) map[string]bool {
+	referenced := make(map[string]bool)
+	add := func(source string, rels *Relationships) {
+		if skip(source) {
+			return
+		}
+		for _, rel := range rels.Relationship {
+			if rel.TargetMode != "External" {
+				referenced[resolveTarget(source, rel.Target)] = true
+			}
+		}
+	}
+	add("", &p.packageRels)
+	add("ppt/presentation.xml", &p.presentationRels)
+	p.forEachPartRels(add)
+	p.forEachCopiedRels(add, func(source string, err error) {
+		log.Warnln(err, ", keep the parts it may reference")
+		referenced[source] = true
+	})
+	return referenced
+}
+
+// FindUnusedCustomXML returns the custom xml items, added by add-ins and document management systems,
+// which no part other than the custom xml ones references
+func (p *PowerpointDoc) FindUnusedCustomXML() []string {
+	referenced := p.referencedParts(func(source string) bool { return path.Dir(source) == "customXml" })
+	unused := []string{}
+	for _, f := range p.sourceFileReader.File {
+		if reCustomXMLItem.MatchString(f.Name) && !p.removedParts[f.Name] && !referenced[f.Name] {
+			unused = append(unused, f.Name)
+		}
+	}
+	sort.Strings(unused)
+	return unused
+}
+
+// RemoveUnusedCustomXML removes the unused custom xml items, with their properties and relationships,
+// it returns the names of the removed items
+func (p *PowerpointDoc) RemoveUnusedCustomXML() []string {
+	if p.xmlLocked("remove unused custom xml") {
+		return nil
+	}
+	unused := p.FindUnusedCustomXML()
+	if len(unused) == 0 {
+		return unused
+	}
+	// properties are only referenced from their item, unless another item or part still uses them
+	referenced := p.referencedParts(func(source string) bool {
+		for _, item := range unused {
+			if source == item {
+				return true
+			}
+		}
+		return false
+	})
+	for _, item := range unused {
+		p.removeCustomXMLPart(item)
+		for _, f := range p.sourceFileReader.File {
+			if f.Name != relsPartName(item) {
+				continue
+			}
+			rels, err := parseRelationships(f)
+			if err != nil {
+				log.Warnln(err, ", keep the properties of", item)
+				break
+			}
+			for _, rel := range rels.Relationship {
+				target := resolveTarget(item, rel.Target)
+				if rel.TargetMode != "External" && path.Dir(target) == "customXml" && !referenced[target] {
+					p.removeCustomXMLPart(target)
+				}
+			}
+		}
+	}
+	return unused
+}
+
+func (p *PowerpointDoc) removeCustomXMLPart(name string) {
+	log.Infoln("remove unused custom xml", name)
+	p.removedParts[name] = true
+	p.contentTypes.RemoveOverride(name)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"image"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// default size of the decoded pictures kept between passes, decoded pictures take about 4 bytes per pixel
+const defaultDecodeCacheSize = 256 << 20
+
+type decodedImage struct {
+	media Media // content the picture was decoded from
+	img   image.Image
+	size  int64
+}
+
+// decodeCache keeps the pictures decoded by a pass for the next ones, such as -dpi then -recompress,
+// the oldest ones being evicted beyond its limit. Passes must not modify the pictures it returns.
+type decodeCache struct {
+	mu      sync.Mutex
+	limit   int64
+	size    int64
+	entries map[string]*decodedImage // by media name
+	order   []string                 // oldest first
+}
+
+func newDecodeCache(limit int64) *decodeCache {
+	return &decodeCache{limit: limit, entries: make(map[string]*decodedImage)}
+}
+
+// sameContent tells whether two states of a media have the same content, a replaced content being a new
+// slice or temporary file
+func (m Media) sameContent(o Media) bool {
+	if m.size != o.size || m.file != o.file || len(m.data) != len(o.data) {
+		return false
+	}
+	return len(m.data) == 0 || &m.data[0] == &o.data[0]
+}
+
+// imageSize estimates the memory used by a decoded picture
+func imageSize(img image.Image) int64 {
+	switch m := img.(type) {
+	case *image.RGBA:
+		return int64(len(m.Pix))
+	case *image.NRGBA:
+		return int64(len(m.Pix))
+	case *image.RGBA64:
+		return int64(len(m.Pix))
+	case *image.NRGBA64:
+		return int64(len(m.Pix))
+	case *image.Gray:
+		return int64(len(m.Pix))
+	case *image.Gray16:
+		return int64(len(m.Pix))
+	case *image.CMYK:
+		return int64(len(m.Pix))
+	case *image.Paletted:
+		return int64(len(m.Pix))
+	case *image.YCbCr:
+		return int64(len(m.Y) + len(m.Cb) + len(m.Cr))
+	}
+	b := img.Bounds()
+	return int64(b.Dx()) * int64(b.Dy()) * 4
+}
+
+func (c *decodeCache) get(name string, m Media) image.Image {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[name]; ok && e.media.sameContent(m) {
+		return e.img
+	}
+	return nil
+}
+
+func (c *decodeCache) put(name string, m Media, img image.Image) {
+	if c == nil {
+		return
+	}
+	size := imageSize(img)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeLocked(name)
+	if size > c.limit {
+		return
+	}
+	for c.size+size > c.limit && len(c.order) > 0 {
+		c.removeLocked(c.order[0])
+	}
+	c.entries[name] = &decodedImage{media: m, img: img, size: size}
+	c.order = append(c.order, name)
+	c.size += size
+}
+
+// remove drops the picture of a media whose content changed
+func (c *decodeCache) remove(name string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeLocked(name)
+}
+
+func (c *decodeCache) removeLocked(name string) {
+	e, ok := c.entries[name]
+	if !ok {
+		return
+	}
+	delete(c.entries, name)
+	c.size -= e.size
+	for i, n := range c.order {
+		if n == name {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// SetDecodeCache sets the size of the decoded pictures kept between passes, 0 to decode them in every pass.
+// It is also bounded by the memory budget.
+func (p *PowerpointDoc) SetDecodeCache(limit int64) {
+	if p.memBudget > 0 && limit > p.memBudget {
+		limit = p.memBudget
+	}
+	p.decoded = newDecodeCache(limit)
+}
+
+// decodeMedia decodes the data of a media in the given format, or returns the picture decoded by an earlier pass
+// from the same content
+func (p *PowerpointDoc) decodeMedia(name string, format string, data []byte) (image.Image, error) {
+	m := p.medias[name]
+	if img := p.decoded.get(name, m); img != nil {
+		log.Debugln("decoded", name, "from cache")
+		return img, nil
+	}
+	img, err := decodeImage(data, format)
+	if err != nil {
+		return nil, err
+	}
+	p.decoded.put(name, m, img)
+	return img, nil
+}
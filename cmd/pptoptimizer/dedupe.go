@@ -0,0 +1,272 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func (p *PowerpointDoc) HashMedia(name string) (string, error) {
+	mf, err := p.OpenMedia(name)
+	if err != nil {
+		return "", p.mediaReadError(name, err)
+	}
+	defer mf.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, mf); err != nil {
+		return "", p.mediaReadError(name, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// HashMedias groups the medias by hash, medias which cannot be read being reported as problems and left out
+func (p *PowerpointDoc) HashMedias() map[string][]string {
+	hashes := make(map[string][]string)
+	for k := range p.medias {
+		h, err := p.HashMedia(k)
+		if err != nil {
+			p.Problem(err)
+			continue
+		}
+		hashes[h] = append(hashes[h], k)
+	}
+	return hashes
+}
+
+// FindDuplicateMedias returns groups of byte-identical medias, each group sorted by name
+func (p *PowerpointDoc) FindDuplicateMedias() [][]string {
+	groups := [][]string{}
+	for _, names := range p.HashMedias() {
+		if len(names) > 1 {
+			sort.Strings(names)
+			groups = append(groups, names)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i][0] < groups[j][0] })
+	return groups
+}
+
+func (p *PowerpointDoc) ReportDuplicateMedias() {
+	reclaimable := uint64(0)
+	for _, group := range p.FindDuplicateMedias() {
+		size := p.medias[group[0]].size
+		fmt.Printf("%d identical medias of %d bytes:\n", len(group), size)
+		for _, name := range group {
+			fmt.Println("  ", name)
+		}
+		reclaimable += size * uint64(len(group)-1)
+	}
+	fmt.Println("bytes reclaimable by keeping one media of each group:", reclaimable)
+}
+
+// DeduplicateMedias points the slides, layouts, masters and other parts to a single copy of byte-identical
+// medias, the first by name, and removes the others, it returns the number of bytes reclaimed
+func (p *PowerpointDoc) DeduplicateMedias() uint64 {
+	reclaimed := uint64(0)
+	for _, group := range p.FindDuplicateMedias() {
+		// rather keep a media with a standard name, the others may only be reachable through a form of target
+		keep := group[0]
+		for _, name := range group {
+			if path.Dir(name) == "ppt/media" && path.Clean(name) == name {
+				keep = name
+				break
+			}
+		}
+		dups := make(map[string]bool)
+		for _, name := range group {
+			if name != keep {
+				dups[name] = true
+			}
+		}
+		if p.copiedRelsTargeting(dups) {
+			log.Warnln("duplicates of", keep, "are referenced by parts left untouched, keep them")
+			continue
+		}
+		for _, dup := range group {
+			if !dups[dup] {
+				continue
+			}
+			// also repoints a slide and a layout sharing the survivor
+			log.Infoln("remove media", dup, "identical to", keep)
+			p.auditMedia(dup, "", "removed duplicate of "+keep)
+			reclaimed += p.medias[dup].size
+			p.RenameMedia(dup, keep, p.medias[keep])
+		}
+	}
+	if reclaimed > 0 {
+		log.Infoln("deduplicated medias, reclaimed", reclaimed, "bytes")
+	}
+	return reclaimed
+}
+
+// ImportMedia copies the medias of another document which are not already present, and returns the name
+// of each of them in this document. Medias identical to existing ones are mapped to them instead of being copied.
+// Imported medias are not referenced yet, so they would be removed by RemoveUnusedMedias.
+func (p *PowerpointDoc) ImportMedia(other *PowerpointDoc) (map[string]string, error) {
+	existing := make(map[string]string)
+	for hash, names := range p.HashMedias() {
+		sort.Strings(names)
+		existing[hash] = names[0]
+	}
+	mapping := make(map[string]string)
+	for _, name := range other.MediaNames() {
+		hash, err := other.HashMedia(name)
+		if err != nil {
+			return nil, err
+		}
+		if newname, ok := existing[hash]; ok {
+			log.Debugln("media", name, "already present as", newname)
+			mapping[name] = newname
+			continue
+		}
+		ext := mediaExtension(name)
+		newname := p.newMediaName(ext)
+		data, err := other.ReadMedia(name)
+		if err != nil {
+			return nil, err
+		}
+		p.medias[newname] = p.newMedia(data)
+		if ct := defaultContentType(ext); ct != "" {
+			p.contentTypes.AddDefault(ext, ct)
+		}
+		log.Infoln("imported media", name, "as", newname)
+		existing[hash] = newname
+		mapping[name] = newname
+	}
+	return mapping, nil
+}
+
+// embeddingNames returns the embedded documents, such as chart workbooks and ole objects, which are not removed
+func (p *PowerpointDoc) embeddingNames() []string {
+	names := []string{}
+	for _, f := range p.sourceFileReader.File {
+		if strings.HasPrefix(f.Name, "ppt/embeddings/") && !strings.HasSuffix(f.Name, "/") && !p.removedParts[f.Name] {
+			names = append(names, f.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (p *PowerpointDoc) readEmbedding(name string) ([]byte, error) {
+	if data, ok := p.replacedParts[name]; ok {
+		return data, nil
+	}
+	for _, f := range p.sourceFileReader.File {
+		if f.Name == name {
+			fi, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer fi.Close()
+			return readLimited(fi, int64(f.UncompressedSize64))
+		}
+	}
+	return nil, fmt.Errorf("no embedding %s", name)
+}
+
+// FindDuplicateEmbeddings returns groups of byte-identical embedded documents, each group sorted by name
+func (p *PowerpointDoc) FindDuplicateEmbeddings() [][]string {
+	hashes := make(map[string][]string)
+	for _, name := range p.embeddingNames() {
+		data, err := p.readEmbedding(name)
+		if err != nil {
+			log.Warnln("cannot read embedding", name, ":", err)
+			continue
+		}
+		h := sha256.Sum256(data)
+		key := hex.EncodeToString(h[:])
+		hashes[key] = append(hashes[key], name)
+	}
+	groups := [][]string{}
+	for _, names := range hashes {
+		if len(names) > 1 {
+			groups = append(groups, names)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i][0] < groups[j][0] })
+	return groups
+}
+
+func (p *PowerpointDoc) ReportDuplicateEmbeddings() {
+	reclaimable := 0
+	for _, group := range p.FindDuplicateEmbeddings() {
+		data, _ := p.readEmbedding(group[0])
+		fmt.Printf("%d identical embeddings of %d bytes:\n", len(group), len(data))
+		for _, name := range group {
+			fmt.Println("  ", name)
+		}
+		reclaimable += len(data) * (len(group) - 1)
+	}
+	fmt.Println("bytes reclaimable by keeping one embedding of each group:", reclaimable)
+}
+
+// copiedRelsTargeting tells whether a rels file which is copied verbatim targets one of the parts
+func (p *PowerpointDoc) copiedRelsTargeting(parts map[string]bool) bool {
+	for _, f := range p.sourceFileReader.File {
+		if path.Ext(f.Name) != ".rels" || isParsedRels(f.Name) || p.removedParts[relsSourcePart(f.Name)] {
+			continue
+		}
+		rels, err := p.copiedRelationships(f)
+		if err != nil {
+			return true
+		}
+		for _, rel := range rels.Relationship {
+			if rel.TargetMode != "External" && parts[resolveTarget(relsSourcePart(f.Name), rel.Target)] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DeduplicateEmbeddings points the charts, slides, layouts and masters to a single copy of identical
+// embedded documents and removes the others, it returns the number of bytes reclaimed
+func (p *PowerpointDoc) DeduplicateEmbeddings() int {
+	if p.xmlLocked("deduplicate embeddings") {
+		return 0
+	}
+	reclaimed := 0
+	for _, group := range p.FindDuplicateEmbeddings() {
+		keep, dups := group[0], make(map[string]bool)
+		for _, name := range group[1:] {
+			dups[name] = true
+		}
+		if p.copiedRelsTargeting(dups) {
+			log.Warnln("duplicates of", keep, "are referenced by parts left untouched, keep them")
+			continue
+		}
+		retarget := func(rels *Relationships, source string) {
+			for dup := range dups {
+				rels.ReplaceTarget(source, dup, keep)
+			}
+		}
+		for kind, all := range map[string][]Relationships{"slide": p.slideRels, "slideLayout": p.slideLayoutRels, "slideMaster": p.slideMasterRels} {
+			for i := range all {
+				retarget(&all[i], partName(kind, i))
+			}
+		}
+		for source, rels := range p.otherRels {
+			retarget(&rels, source)
+			p.otherRels[source] = rels
+		}
+		data, _ := p.readEmbedding(keep)
+		for _, dup := range group[1:] {
+			log.Infoln("remove embedding", dup, "identical to", keep)
+			p.removedParts[dup] = true
+			delete(p.replacedParts, dup)
+			p.contentTypes.RemoveOverride(dup)
+			reclaimed += len(data)
+		}
+	}
+	if reclaimed > 0 {
+		log.Infoln("deduplicated embeddings, reclaimed", reclaimed, "bytes")
+	}
+	return reclaimed
+}
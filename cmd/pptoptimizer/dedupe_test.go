@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDeduplicateMediasAcrossSlideAndLayout(t *testing.T) {
+	d := newTestDeck(2)
+	logo, other := testPNG(24, 24), testPNG(32, 24)
+	d.image("ppt/slides/slide1.xml", "ppt/media/image3.png", logo)
+	d.image("ppt/slideLayouts/slideLayout1.xml", "ppt/media/image1.png", logo)
+	d.image("ppt/slides/slide2.xml", "ppt/media/image2.png", other)
+	p := d.parse(t)
+	if reclaimed := p.DeduplicateMedias(); reclaimed != uint64(len(logo)) {
+		t.Errorf("reclaimed %d bytes, want %d", reclaimed, len(logo))
+	}
+	p.RemoveUnusedMedias()
+	_, parts := saveTestFile(t, p)
+
+	assertReferencesResolve(t, parts)
+	if parts["ppt/media/image3.png"] != nil {
+		t.Error("duplicate kept")
+	}
+	if !bytes.Equal(parts["ppt/media/image2.png"], other) {
+		t.Error("distinct media removed or changed")
+	}
+	for _, source := range []string{"ppt/slides/slide1.xml", "ppt/slideLayouts/slideLayout1.xml"} {
+		refs := referenceTargets(t, parts, source)
+		if len(refs) != 1 || refs[0] != "blip r:embed "+relTypeTransitional+"image ppt/media/image1.png" {
+			t.Errorf("references of %s %v, want the kept media", source, refs)
+		}
+	}
+}
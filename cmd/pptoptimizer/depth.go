@@ -0,0 +1,107 @@
+package main
+
+import (
+	"image"
+	"image/color"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// 4x4 ordered dithering thresholds
+var bayer4 = [4][4]uint32{
+	{0, 8, 2, 10},
+	{12, 4, 14, 6},
+	{3, 11, 1, 9},
+	{15, 7, 13, 5},
+}
+
+// pngBitDepth returns the bits per channel of a png from its IHDR chunk, 0 if unknown
+func pngBitDepth(data []byte) int {
+	if len(data) < 25 || string(data[12:16]) != "IHDR" {
+		return 0
+	}
+	return int(data[24])
+}
+
+// to8 rounds a 16 bits value to 8 bits, or dithers it with the threshold of pixel x, y,
+// 8 bits values scaled to 16 bits (v*257) are converted back exactly either way
+func to8(v uint16, x int, y int, dither bool) uint8 {
+	offset := uint32(0xffff / 2)
+	if dither {
+		offset = (bayer4[y&3][x&3]*2 + 1) * 0xffff / 32
+	}
+	return uint8((uint32(v)*255 + offset) / 0xffff)
+}
+
+// reduceTo8Bits converts a 16 bits per channel image to 8 bits, it returns nil for other images
+func reduceTo8Bits(img image.Image, dither bool) image.Image {
+	b := img.Bounds()
+	switch m := img.(type) {
+	case *image.NRGBA64:
+		out := image.NewNRGBA(b)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c := m.NRGBA64At(x, y)
+				out.SetNRGBA(x, y, color.NRGBA{to8(c.R, x, y, dither), to8(c.G, x, y, dither), to8(c.B, x, y, dither), to8(c.A, x, y, false)})
+			}
+		}
+		return out
+	case *image.RGBA64:
+		out := image.NewRGBA(b)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c := m.RGBA64At(x, y)
+				// premultiplied, the color must not exceed the alpha
+				a := to8(c.A, x, y, false)
+				clamp := func(v uint8) uint8 {
+					if v > a {
+						return a
+					}
+					return v
+				}
+				out.SetRGBA(x, y, color.RGBA{clamp(to8(c.R, x, y, dither)), clamp(to8(c.G, x, y, dither)), clamp(to8(c.B, x, y, dither)), a})
+			}
+		}
+		return out
+	case *image.Gray16:
+		out := image.NewGray(b)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				out.SetGray(x, y, color.Gray{to8(m.Gray16At(x, y).Y, x, y, dither)})
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// ReducePNGBitDepth re-encodes PNGs with 16 bits per channel, such as Photoshop exports, with 8 bits per channel,
+// which is all a slide can display, optionally with ordered dithering to avoid banding in gradients
+func (p *PowerpointDoc) ReducePNGBitDepth(dither bool) {
+	for _, name := range p.MediaNames() {
+		data, format := p.readMediaOfFormat(name, "png")
+		if format == "" || pngBitDepth(data) != 16 {
+			continue
+		}
+		img, err := p.decodeMedia(name, "png", data)
+		if err != nil {
+			p.mediaDecodeFailed(name, err)
+			continue
+		}
+		reduced := reduceTo8Bits(img, dither)
+		if reduced == nil {
+			continue
+		}
+		out, err := encodePNG(reduced)
+		if err != nil {
+			log.Warnln("cannot encode png", name, ":", err)
+			continue
+		}
+		if len(out) >= len(data) {
+			log.Debugln("8 bits png", name, "is not smaller, keep original")
+			continue
+		}
+		log.Infoln("reduced", name, "to 8 bits per channel", len(data), "->", len(out))
+		p.ReplaceMedia(name, out, "reduced from 16 to 8 bits per channel")
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"github.com/beevik/etree"
+	log "github.com/sirupsen/logrus"
+)
+
+// document properties parts, referenced from the package relationships
+const (
+	CoreProperties   = "core"
+	AppProperties    = "app"
+	CustomProperties = "custom"
+	Thumbnail        = "thumbnail"
+)
+
+const packageRelType = "http://schemas.openxmlformats.org/package/2006/relationships/"
+
+// isDocProps tells whether a package relationship targets the given document properties part
+func (r Relationship) isDocProps(kind string) bool {
+	switch kind {
+	case CoreProperties:
+		return r.Type == packageRelType+"metadata/core-properties"
+	case AppProperties:
+		return r.Is("extended-properties")
+	case CustomProperties:
+		return r.Is("custom-properties")
+	case Thumbnail:
+		return r.Type == packageRelType+"metadata/thumbnail"
+	}
+	return false
+}
+
+// docPropsPart returns the name of a document properties part, such as docProps/core.xml, or "" if there is none
+func (p *PowerpointDoc) docPropsPart(kind string) string {
+	for _, rel := range p.packageRels.Relationship {
+		if rel.isDocProps(kind) && rel.TargetMode != "External" {
+			if name := resolveTarget("", rel.Target); !p.removedParts[name] {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// ReadDocProps parses a document properties part without editing it, it returns nil if there is none
+func (p *PowerpointDoc) ReadDocProps(kind string) *etree.Document {
+	name := p.docPropsPart(kind)
+	if name == "" || kind == Thumbnail {
+		return nil
+	}
+	if doc, ok := p.parts[name]; ok {
+		return doc
+	}
+	doc, err := p.ReadPart(name)
+	if err != nil {
+		p.Problem(err)
+	}
+	return doc
+}
+
+// LoadDocProps parses a document properties part for edition, it is rewritten on save. It returns nil if there is none.
+func (p *PowerpointDoc) LoadDocProps(kind string) *etree.Document {
+	name := p.docPropsPart(kind)
+	if name == "" || kind == Thumbnail {
+		return nil
+	}
+	return p.LoadPart(name)
+}
+
+// RemoveDocProps removes a document properties part, with its package relationship and content type
+func (p *PowerpointDoc) RemoveDocProps(kind string) {
+	if p.xmlLocked("remove " + kind + " properties") {
+		return
+	}
+	rels := p.packageRels.Relationship[:0]
+	for _, rel := range p.packageRels.Relationship {
+		if rel.isDocProps(kind) {
+			if rel.TargetMode != "External" {
+				name := resolveTarget("", rel.Target)
+				log.Infoln("remove", name)
+				p.removedParts[name] = true
+				p.contentTypes.RemoveOverride(name)
+				delete(p.parts, name)
+			}
+			continue
+		}
+		rels = append(rels, rel)
+	}
+	p.packageRels.Relationship = rels
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/beevik/etree"
+	"golang.org/x/image/draw"
+)
+
+const emuPerInch = 914400
+
+// SlideSize returns the slide width and height in EMUs
+func (p *PowerpointDoc) SlideSize() (int64, int64) {
+	sldSz := p.presentation.FindElement("//p:sldSz")
+	if sldSz == nil {
+		return 0, 0
+	}
+	cx, _ := strconv.ParseInt(sldSz.SelectAttrValue("cx", "0"), 10, 64)
+	cy, _ := strconv.ParseInt(sldSz.SelectAttrValue("cy", "0"), 10, 64)
+	return cx, cy
+}
+
+// fitSize returns the largest size with the aspect ratio of w x h which fits in maxw x maxh
+func fitSize(w, h, maxw, maxh int) (int, int) {
+	if w <= maxw && h <= maxh {
+		return w, h
+	}
+	if w*maxh > h*maxw { // wider than the box
+		return maxw, max1(h * maxw / w)
+	}
+	return max1(w * maxh / h), maxh
+}
+
+func max1(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// lanczos is the Lanczos kernel with 3 lobes, sharper than Catmull-Rom on photos but slower
+var lanczos = &draw.Kernel{Support: 3, At: func(t float64) float64 {
+	if t == 0 {
+		return 1
+	}
+	if t <= -3 || t >= 3 {
+		return 0
+	}
+	x := math.Pi * t
+	return 3 * math.Sin(x) * math.Sin(x/3) / (x * x)
+}}
+
+// resampling filters of -filter, from the fastest to the sharpest
+var scaleFilters = map[string]draw.Interpolator{
+	"nearest":        draw.NearestNeighbor,
+	"approxbilinear": draw.ApproxBiLinear,
+	"bilinear":       draw.BiLinear,
+	"catmullrom":     draw.CatmullRom,
+	"lanczos":        lanczos,
+}
+
+const defaultScaleFilter = "catmullrom"
+
+func checkScaleFilter(filter string) error {
+	if _, ok := scaleFilters[filter]; !ok {
+		return fmt.Errorf("unknown filter %s, expected nearest, approxbilinear, bilinear, catmullrom or lanczos", filter)
+	}
+	return nil
+}
+
+func scaleImage(img image.Image, w, h int, filter draw.Interpolator) image.Image {
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	filter.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+	return dst
+}
+
+func encodeImage(img image.Image, format string, quality int) ([]byte, error) {
+	switch format {
+	case "png":
+		return encodePNG(img)
+	case "jpeg":
+		out := bytes.NewBuffer(nil)
+		if err := jpeg.Encode(out, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, err
+		}
+		return out.Bytes(), nil
+	}
+	return nil, fmt.Errorf("cannot encode %s pictures", format)
+}
+
+func decodeImage(data []byte, format string) (image.Image, error) {
+	switch format {
+	case "png":
+		return png.Decode(bytes.NewReader(data))
+	case "jpeg":
+		return jpeg.Decode(bytes.NewReader(data))
+	}
+	img, decoded, err := image.Decode(bytes.NewReader(data))
+	if err == nil && decoded != format {
+		return nil, fmt.Errorf("%s picture is actually a %s", format, decoded)
+	}
+	return img, err
+}
+
+// downscaleMedia resizes a PNG or JPEG picture to fit in maxw x maxh pixels, keeping it only if smaller
+func (p *PowerpointDoc) downscaleMedia(name string, maxw int, maxh int, filter draw.Interpolator) {
+	data, format := p.readMediaOfFormat(name, "png", "jpeg")
+	if format == "" {
+		return
+	}
+	img, err := p.decodeMedia(name, format, data)
+	if err != nil {
+		p.mediaDecodeFailed(name, err)
+		return
+	}
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	neww, newh := fitSize(w, h, maxw, maxh)
+	if neww == w && newh == h {
+		return
+	}
+	out, err := encodeImage(scaleImage(img, neww, newh, filter), format, p.jpegQuality(name))
+	if err != nil {
+		log.Warnln("cannot encode", name, ":", err)
+		return
+	}
+	if len(out) >= len(data) {
+		log.Debugln("downscaled", name, "is not smaller, keep original")
+		return
+	}
+	log.Infoln("downscaled", name, w, "x", h, "->", neww, "x", newh, len(data), "->", len(out))
+	p.ReplaceMedia(name, out, fmt.Sprintf("downscaled from %dx%d to %dx%d", w, h, neww, newh))
+}
+
+// pictureSize returns the size in EMUs of the whole picture of a p:pic element,
+// which is larger than the displayed size when the picture is cropped
+func pictureSize(pic *etree.Element) (int64, int64, bool) {
+	ext := pic.FindElement("./p:spPr/a:xfrm/a:ext")
+	if ext == nil {
+		return 0, 0, false
+	}
+	cx, err1 := strconv.ParseInt(ext.SelectAttrValue("cx", ""), 10, 64)
+	cy, err2 := strconv.ParseInt(ext.SelectAttrValue("cy", ""), 10, 64)
+	if err1 != nil || err2 != nil || cx <= 0 || cy <= 0 {
+		return 0, 0, false
+	}
+	if crop := pic.FindElement("./p:blipFill/a:srcRect"); crop != nil {
+		l, _ := strconv.ParseInt(crop.SelectAttrValue("l", "0"), 10, 64)
+		t, _ := strconv.ParseInt(crop.SelectAttrValue("t", "0"), 10, 64)
+		r, _ := strconv.ParseInt(crop.SelectAttrValue("r", "0"), 10, 64)
+		b, _ := strconv.ParseInt(crop.SelectAttrValue("b", "0"), 10, 64)
+		if l+r < 100000 && t+b < 100000 { // in 1/1000 of percent
+			cx = cx * 100000 / (100000 - l - r)
+			cy = cy * 100000 / (100000 - t - b)
+		}
+	}
+	return groupScale(pic, cx, cy)
+}
+
+// groupScale converts a size in the coordinates of the groups containing a shape to the slide coordinates,
+// groups being scaled when their extent differs from the extent of their children
+func groupScale(e *etree.Element, cx int64, cy int64) (int64, int64, bool) {
+	for g := e.Parent(); g != nil; g = g.Parent() {
+		if g.Tag != "grpSp" {
+			continue
+		}
+		xfrm := g.FindElement("./p:grpSpPr/a:xfrm")
+		if xfrm == nil {
+			continue
+		}
+		ext, chExt := xfrm.FindElement("./a:ext"), xfrm.FindElement("./a:chExt")
+		if ext == nil || chExt == nil {
+			continue
+		}
+		gcx, err1 := strconv.ParseInt(ext.SelectAttrValue("cx", ""), 10, 64)
+		gcy, err2 := strconv.ParseInt(ext.SelectAttrValue("cy", ""), 10, 64)
+		chcx, err3 := strconv.ParseInt(chExt.SelectAttrValue("cx", ""), 10, 64)
+		chcy, err4 := strconv.ParseInt(chExt.SelectAttrValue("cy", ""), 10, 64)
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil || gcx <= 0 || gcy <= 0 || chcx <= 0 || chcy <= 0 {
+			return 0, 0, false
+		}
+		cx = cx * gcx / chcx
+		cy = cy * gcy / chcy
+	}
+	return cx, cy, true
+}
+
+// measuredDocument returns the slide, layout or master whose pictures are measured, nil for the other parts
+func (p *PowerpointDoc) measuredDocument(source string) *etree.Document {
+	if !isNumberedPart(source) {
+		return nil
+	}
+	if strings.HasPrefix(source, "ppt/slideMasters/") {
+		if n, err := getObjectNumberFromFilename(source); err == nil && n <= len(p.slideMasters) {
+			return p.slideMasters[n-1]
+		}
+		return nil
+	}
+	if doc, ok := p.parts[source]; ok {
+		return doc
+	}
+	doc, err := p.ReadPart(source)
+	if err != nil {
+		p.Problem(err)
+	}
+	return doc
+}
+
+// DisplaySizes returns the largest size in EMUs each picture is displayed at, pictures used where their size
+// is unknown (backgrounds, shape fills) or by parts which are not measured (notes, charts, diagrams) get the slide size
+func (p *PowerpointDoc) DisplaySizes() map[string][2]int64 {
+	slidecx, slidecy := p.SlideSize()
+	sizes := make(map[string][2]int64)
+	update := func(media string, cx int64, cy int64) {
+		size := sizes[media]
+		if cx > size[0] {
+			size[0] = cx
+		}
+		if cy > size[1] {
+			size[1] = cy
+		}
+		sizes[media] = size
+	}
+
+	measure := func(source string, rels *Relationships) {
+		targets := make(map[string]string)
+		for _, rel := range rels.Relationship {
+			if rel.Is("image") && rel.TargetMode != "External" {
+				targets[rel.Id] = resolveTarget(source, rel.Target)
+			}
+		}
+		if len(targets) == 0 {
+			return
+		}
+		measured := make(map[string]bool)
+		if doc := p.measuredDocument(source); doc != nil {
+			// anywhere in the part, including pictures nested in groups
+			for _, e := range doc.FindElements("//*[@r:embed]") {
+				media, ok := targets[e.SelectAttrValue("r:embed", "")]
+				if !ok {
+					continue
+				}
+				pic := e.Parent()
+				if pic != nil && pic.Tag == "blipFill" {
+					pic = pic.Parent()
+				}
+				if cx, cy, ok := pictureSize(pic); e.Tag == "blip" && pic != nil && pic.Tag == "pic" && ok {
+					update(media, cx, cy)
+				} else {
+					update(media, slidecx, slidecy)
+				}
+				measured[media] = true
+			}
+		}
+		// pictures only referenced from places we do not know, e.g. extensions, or from parts not measured
+		for _, media := range targets {
+			if !measured[media] {
+				update(media, slidecx, slidecy)
+			}
+		}
+	}
+	p.forEachPartRels(measure)
+	p.forEachCopiedRels(measure, func(source string, err error) {
+		log.Warnln(err, ", keep all pictures at the slide size")
+		for media := range p.medias {
+			update(media, slidecx, slidecy)
+		}
+	})
+	return sizes
+}
+
+// DownscaleImages reduces pictures larger than needed to display them at the given resolution,
+// from the size of each placement of the picture or at most the slide size, with one of the scaleFilters
+func (p *PowerpointDoc) DownscaleImages(dpi int, filter string) {
+	interpolator, ok := scaleFilters[strings.ToLower(filter)]
+	if !ok {
+		log.Warnln("unknown filter", filter, ", use", defaultScaleFilter)
+		interpolator = scaleFilters[defaultScaleFilter]
+	}
+	cx, cy := p.SlideSize()
+	if cx == 0 || cy == 0 {
+		log.Warnln("no slide size in presentation, cannot downscale pictures")
+		return
+	}
+	slidew := int(cx * int64(dpi) / emuPerInch)
+	slideh := int(cy * int64(dpi) / emuPerInch)
+	log.Debugln("maximum picture size at", dpi, "dpi:", slidew, "x", slideh)
+	displaySizes := p.DisplaySizes()
+	for _, name := range p.MediaNames() {
+		maxw, maxh := slidew, slideh
+		if size, ok := displaySizes[name]; ok {
+			maxw = max1(int(size[0] * int64(dpi) / emuPerInch))
+			maxh = max1(int(size[1] * int64(dpi) / emuPerInch))
+		}
+		p.downscaleMedia(name, maxw, maxh, interpolator)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"strings"
+	"testing"
+)
+
+// thumbnail adds a picture of a media displayed one inch wide to a slide
+func (d *testDeck) thumbnail(slide string, name string, data []byte) {
+	d.addBytes(name, "", data)
+	id := d.rel(slide, "image", "../"+strings.TrimPrefix(name, "ppt/"))
+	d.shapes[slide] = append(d.shapes[slide], fmt.Sprintf(`<p:pic><p:nvPicPr><p:cNvPr id="%d" name="Thumbnail"/><p:cNvPicPr/><p:nvPr/></p:nvPicPr>`+
+		`<p:blipFill><a:blip r:embed="%s"/></p:blipFill><p:spPr><a:xfrm><a:off x="0" y="0"/><a:ext cx="914400" cy="685800"/></a:xfrm></p:spPr></p:pic>`,
+		len(d.shapes[slide])+2, id))
+}
+
+func TestDisplaySizesOfPartsNotMeasured(t *testing.T) {
+	d := newTestDeck(1)
+	d.thumbnail("ppt/slides/slide1.xml", "ppt/media/image1.png", testPNG(800, 600))
+	d.thumbnail("ppt/slides/slide1.xml", "ppt/media/image2.png", testPNG(400, 300))
+	// image1 is also shown page-wide in the notes, whose relationships are copied verbatim
+	d.add("ppt/notesSlides/notesSlide1.xml", relationshipContentTypes["notesSlide"], `<p:notes `+testNamespaces+`><p:cSld><p:spTree>{shapes}</p:spTree></p:cSld></p:notes>`)
+	d.rel("ppt/notesSlides/notesSlide1.xml", "slide", "../slides/slide1.xml")
+	d.image("ppt/notesSlides/notesSlide1.xml", "ppt/media/image1.png", testPNG(800, 600))
+	d.rel("ppt/slides/slide1.xml", "notesSlide", "../notesSlides/notesSlide1.xml")
+	p := d.parse(t)
+
+	slidecx, slidecy := p.SlideSize()
+	sizes := p.DisplaySizes()
+	if got := sizes["ppt/media/image1.png"]; got != [2]int64{slidecx, slidecy} {
+		t.Errorf("picture of the notes displayed at %v, want the slide size %dx%d", got, slidecx, slidecy)
+	}
+	if got := sizes["ppt/media/image2.png"]; got != [2]int64{914400, 685800} {
+		t.Errorf("thumbnail displayed at %v, want 914400x685800", got)
+	}
+
+	p.DownscaleImages(96, defaultScaleFilter)
+	data, err := p.ReadMedia("ppt/media/image1.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err != nil || cfg.Width != 800 || cfg.Height != 600 {
+		t.Errorf("picture of the notes is %dx%d after downscaling at 96 dpi (%v), want 800x600", cfg.Width, cfg.Height, err)
+	}
+}
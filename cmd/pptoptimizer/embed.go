@@ -0,0 +1,110 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"path"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// media folders of the office documents which can be embedded in a presentation
+var embeddedMediaDirs = map[string]string{".xlsx": "xl/media/", ".xlsm": "xl/media/", ".docx": "word/media/", ".docm": "word/media/", ".pptx": "ppt/media/"}
+
+// openEmbedding returns a document holding the medias of an embedded office document,
+// on which the passes keeping media names can run (FlattenOpaquePNGs, StripICCProfiles, RecompressPNGs)
+func openEmbedding(data []byte, mediaDir string) (*PowerpointDoc, error) {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	e := NewPowerpointDoc()
+	e.sourceFileReader = r
+	e.mediaOnly = true
+	for _, f := range r.File {
+		if strings.HasPrefix(f.Name, mediaDir) {
+			e.medias[f.Name] = Media{size: f.UncompressedSize64}
+		}
+	}
+	return e, nil
+}
+
+// repack writes the embedded document again, with its replaced medias
+func (p *PowerpointDoc) repack() ([]byte, error) {
+	out := bytes.NewBuffer(nil)
+	outz := zip.NewWriter(out)
+	for _, f := range p.sourceFileReader.File {
+		header := f.FileHeader
+		header.Method = zip.Deflate
+		fo, err := outz.CreateHeader(&header)
+		if err != nil {
+			return nil, err
+		}
+		fi, err := f.Open()
+		if m, ok := p.medias[f.Name]; ok && m.replaced() {
+			fi, err = p.OpenMedia(f.Name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(fo, fi)
+		fi.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := outz.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// OptimizeEmbeddings applies passes to the medias of the office documents embedded in the presentation,
+// such as workbooks of charts, and keeps the repacked documents when they are smaller.
+// Embeddings which cannot be read are left as is.
+func (p *PowerpointDoc) OptimizeEmbeddings(passes func(e *PowerpointDoc)) {
+	for _, f := range p.sourceFileReader.File {
+		mediaDir, ok := embeddedMediaDirs[strings.ToLower(path.Ext(f.Name))]
+		if !strings.HasPrefix(f.Name, "ppt/embeddings/") || !ok || p.removedParts[f.Name] {
+			continue
+		}
+		fi, err := f.Open()
+		if err != nil {
+			log.Warnln("cannot open embedding", f.Name, ":", err)
+			continue
+		}
+		data, err := readLimited(fi, int64(f.UncompressedSize64))
+		fi.Close()
+		if err != nil {
+			log.Warnln("cannot read embedding", f.Name, ":", err)
+			continue
+		}
+		e, err := openEmbedding(data, mediaDir)
+		if err != nil {
+			log.Warnln("cannot open embedding", f.Name, ":", err)
+			continue
+		}
+		if len(e.medias) == 0 {
+			continue
+		}
+		log.Debugln("optimize", len(e.medias), "medias of embedding", f.Name)
+		passes(e)
+		if len(e.Problems()) > 0 {
+			log.Warnln("cannot read embedding", f.Name, "entirely, keep original")
+			continue
+		}
+		out, err := e.repack()
+		if err != nil {
+			log.Warnln("cannot repack embedding", f.Name, ":", err)
+			continue
+		}
+		if len(out) >= len(data) {
+			log.Debugln("repacked embedding", f.Name, "is not smaller, keep original")
+			continue
+		}
+		log.Infoln("optimized embedding", f.Name, len(data), "->", len(out))
+		p.replacedParts[f.Name] = out
+	}
+}
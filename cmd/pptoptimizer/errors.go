@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// errors which callers can check with errors.Is
+var (
+	ErrEncrypted        = errors.New("presentation is encrypted")
+	ErrNotAPresentation = errors.New("not a powerpoint presentation")
+	ErrMalformedPart    = errors.New("malformed part")
+	ErrMediaDecode      = errors.New("cannot decode media")
+)
+
+// PartError is a part of the package which cannot be read or parsed, it matches ErrMalformedPart
+type PartError struct {
+	Part string
+	Err  error
+}
+
+func (e *PartError) Error() string {
+	return fmt.Sprintf("malformed part %s: %v", e.Part, e.Err)
+}
+
+func (e *PartError) Unwrap() error {
+	return e.Err
+}
+
+func (e *PartError) Is(target error) bool {
+	return target == ErrMalformedPart
+}
+
+// MediaError is a media which cannot be decoded, and is left untouched, it matches ErrMediaDecode
+type MediaError struct {
+	Media string
+	Err   error
+}
+
+func (e *MediaError) Error() string {
+	return fmt.Sprintf("cannot decode media %s: %v", e.Media, e.Err)
+}
+
+func (e *MediaError) Unwrap() error {
+	return e.Err
+}
+
+func (e *MediaError) Is(target error) bool {
+	return target == ErrMediaDecode
+}
+
+// compound file header: office encrypts documents into an OLE container instead of a zip
+var compoundFileMagic = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// openError tells why a file could not be opened as a zip
+func openError(r io.ReaderAt, err error) error {
+	magic := make([]byte, len(compoundFileMagic))
+	if _, rerr := r.ReadAt(magic, 0); rerr == nil && bytes.Equal(magic, compoundFileMagic) {
+		return ErrEncrypted
+	}
+	return fmt.Errorf("%w: invalid zip file: %v", ErrNotAPresentation, err)
+}
+
+// mediaDecodeFailed reports a media left untouched because it cannot be decoded
+func (p *PowerpointDoc) mediaDecodeFailed(name string, err error) {
+	merr := &MediaError{Media: name, Err: err}
+	log.Warnln(merr)
+	p.mediaErrors = append(p.mediaErrors, merr)
+}
+
+// MediaErrors returns the medias which could not be decoded, as *MediaError
+func (p *PowerpointDoc) MediaErrors() []error {
+	return p.mediaErrors
+}
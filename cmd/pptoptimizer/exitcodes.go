@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// exit codes, which scripts can branch on, 0 being success
+const (
+	exitFailure    = 1 // any other error, such as an output which cannot be written
+	exitUsage      = 2 // unknown command, invalid flag or argument, or an existing output with -noclobber
+	exitInput      = 3 // input file missing, unreadable, encrypted, not a valid presentation or with a malformed part
+	exitNoSavings  = 4 // the output is not smaller than the input, with -nobloat
+	exitValidation = 5 // the output failed the self-test, or warnings were logged with -failonwarn
+)
+
+// errorExitCode returns the exit code of an error of the library, exitInput for an unreadable input
+func errorExitCode(err error) int {
+	if errors.Is(err, ErrMalformedPart) || errors.Is(err, ErrEncrypted) || errors.Is(err, ErrNotAPresentation) {
+		return exitInput
+	}
+	return exitFailure
+}
+
+// exitWith logs an error and exits with one of the codes above
+func exitWith(code int, args ...interface{}) {
+	log.Errorln(args...)
+	os.Exit(code)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/beevik/etree"
+)
+
+var imageContentTypes = map[string]string{
+	"png":  "image/png",
+	"jpeg": "image/jpeg",
+	"jpg":  "image/jpeg",
+	"gif":  "image/gif",
+	"bmp":  "image/bmp",
+	"tif":  "image/tiff",
+	"tiff": "image/tiff",
+	"emf":  "image/x-emf",
+	"wmf":  "image/x-wmf",
+	"svg":  "image/svg+xml",
+	"webp": "image/webp",
+}
+
+var reMediaNumber = regexp.MustCompile(`^ppt/media/image([0-9]+)\.`)
+
+func (p *PowerpointDoc) newMediaName(ext string) string {
+	last := 0
+	for k := range p.medias {
+		if matches := reMediaNumber.FindStringSubmatch(k); len(matches) == 2 {
+			if n, _ := strconv.Atoi(matches[1]); n > last {
+				last = n
+			}
+		}
+	}
+	return fmt.Sprintf("ppt/media/image%d.%s", last+1, ext)
+}
+
+func readLimited(r io.Reader, maxSize int64) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("larger than %d bytes", maxSize)
+	}
+	return data, nil
+}
+
+// errLocalImage is an external image which is a local file, only fetched when allowed
+var errLocalImage = errors.New("local file, not fetched unless local images are allowed")
+
+// fetchExternal fetches an image over http or https, or reads a local path or file: url relative to basedir
+// if local is set, since a deck could otherwise make the tool embed any file readable on the machine running it
+func fetchExternal(target string, basedir string, timeout time.Duration, maxSize int64, local bool) ([]byte, error) {
+	u, err := url.Parse(target)
+	if err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		client := http.Client{Timeout: timeout}
+		resp, err := client.Get(target)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, errors.New(resp.Status)
+		}
+		return readLimited(resp.Body, maxSize)
+	}
+	if !local {
+		return nil, errLocalImage
+	}
+
+	file := target
+	if err == nil && u.Scheme == "file" {
+		file = u.Path
+	}
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(basedir, file)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readLimited(f, maxSize)
+}
+
+func externalImageExtension(target string, data []byte) string {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(target)), ".")
+	if _, ok := imageContentTypes[ext]; ok {
+		return ext
+	}
+	contentType := http.DetectContentType(data)
+	for e, ct := range imageContentTypes {
+		if ct == contentType && e != "jpg" && e != "tif" {
+			return e
+		}
+	}
+	return ""
+}
+
+func linkToEmbed(doc *etree.Document, id string) {
+	for _, e := range doc.FindElements(fmt.Sprintf("//*[@r:link='%s']", id)) {
+		if e.SelectAttr("r:embed") != nil {
+			// keep the cached copy, the link would now target a part of the package
+			e.RemoveAttr("r:link")
+			continue
+		}
+		log.Debugln("found image link", id, "-> embed")
+		e.RemoveAttr("r:link")
+		e.CreateAttr("r:embed", id)
+	}
+}
+
+// editableDocument returns the xml of a part for edition, the masters being parsed with the package
+func (p *PowerpointDoc) editableDocument(source string) *etree.Document {
+	if strings.HasPrefix(source, "ppt/slideMasters/") {
+		if n, err := getObjectNumberFromFilename(source); err == nil && n <= len(p.slideMasters) {
+			return p.slideMasters[n-1]
+		}
+		return nil
+	}
+	return p.LoadPart(source)
+}
+
+// inlineExternalImagesOf embeds the external images of a part, it returns whether its relationships changed
+func (p *PowerpointDoc) inlineExternalImagesOf(rels *Relationships, source string, timeout time.Duration, maxSize int64, local bool) bool {
+	basedir := filepath.Dir(p.sourceFileName)
+	changed := false
+	for j, rel := range rels.Relationship {
+		if !rel.Is("image") || rel.TargetMode != "External" {
+			continue
+		}
+		doc := p.editableDocument(source)
+		if doc == nil {
+			log.Warnln("cannot find", source, "to embed", rel.Target)
+			continue
+		}
+		if _, linked := imageReferences(doc); linked[rel.Id] {
+			log.Debugln("external image", rel.Target, "of", source, "already has an embedded copy, skip it")
+			continue
+		}
+		data, err := fetchExternal(rel.Target, basedir, timeout, maxSize, local)
+		if err != nil {
+			log.Warnln("cannot fetch external image", rel.Target, "of", source, ":", err)
+			continue
+		}
+		ext := externalImageExtension(rel.Target, data)
+		if ext == "" {
+			log.Warnln("external image", rel.Target, "of", source, "is not a known image format, skip it")
+			continue
+		}
+		linkToEmbed(doc, rel.Id)
+
+		name := p.newMediaName(ext)
+		p.medias[name] = p.newMedia(data)
+		p.contentTypes.AddDefault(ext, imageContentTypes[ext])
+		if path.Dir(path.Dir(source)) == "ppt" {
+			rels.Relationship[j].Target = "../media/" + path.Base(name)
+		} else {
+			rels.Relationship[j].Target = "/" + name
+		}
+		rels.Relationship[j].TargetMode = ""
+		changed = true
+		log.Infoln("inlined external image", rel.Target, "as", name, len(data))
+	}
+	return changed
+}
+
+// InlineExternalImages embeds the images linked by the slides, layouts, masters, notes and other parts, fetched over
+// http or https, and from local paths or file: urls only if local is set
+func (p *PowerpointDoc) InlineExternalImages(timeout time.Duration, maxSize int64, local bool) {
+	if p.xmlLocked("inline external images") {
+		return
+	}
+	p.forEachPartRels(func(source string, rels *Relationships) {
+		p.inlineExternalImagesOf(rels, source, timeout, maxSize, local)
+	})
+	// rels copied verbatim, such as those of the notes, are replaced when changed
+	p.forEachCopiedRels(func(source string, rels *Relationships) {
+		if p.inlineExternalImagesOf(rels, source, timeout, maxSize, local) {
+			xmlout, _ := xml.Marshal(rels)
+			p.replacedParts[relsPartName(source)] = append([]byte(xmlHeader), xmlout...)
+		}
+	}, func(source string, err error) {
+		log.Warnln(err, ", external images it references left as is")
+	})
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInlineExternalImages(t *testing.T) {
+	images := map[string][]byte{"/slide.png": testPNG(20, 10), "/notes.png": testPNG(21, 10), "/master.png": testPNG(22, 10)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if data, ok := images[r.URL.Path]; ok {
+			w.Write(data)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+	local := filepath.Join(t.TempDir(), "local.png")
+	if err := ioutil.WriteFile(local, testPNG(23, 10), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	links := []struct {
+		source string
+		target string
+		data   []byte // embedded content, nil if the image cannot be fetched
+		local  bool
+	}{
+		{"ppt/slides/slide1.xml", server.URL + "/slide.png", images["/slide.png"], false},
+		{"ppt/notesSlides/notesSlide1.xml", server.URL + "/notes.png", images["/notes.png"], false},
+		{"ppt/notesMasters/notesMaster1.xml", server.URL + "/master.png", images["/master.png"], false},
+		{"ppt/slideLayouts/slideLayout1.xml", server.URL + "/missing.png", nil, false},
+		{"ppt/slides/slide2.xml", local, testPNG(23, 10), true},
+		{"ppt/slideMasters/slideMaster1.xml", "file://" + filepath.ToSlash(local), testPNG(23, 10), true},
+	}
+	for _, allowLocal := range []bool{false, true} {
+		d := newTestDeck(2)
+		d.notes(1, "ppt/theme/theme1.xml")
+		for _, l := range links {
+			d.picture(l.source, "r:link", d.rel(l.source, "image", l.target))
+			d.rels[l.source][len(d.rels[l.source])-1].TargetMode = "External"
+		}
+		p := d.parse(t)
+		p.InlineExternalImages(time.Second, 1<<20, allowLocal)
+		p.RemoveUnusedMedias()
+		_, parts := saveTestFile(t, p)
+		assertReferencesResolve(t, parts)
+
+		for _, l := range links {
+			rels := Relationships{}
+			if err := xml.Unmarshal(parts[relsPartName(l.source)], &rels); err != nil {
+				t.Fatal(err)
+			}
+			rel := rels.Relationship[len(rels.Relationship)-1]
+			embedded := l.data != nil && (!l.local || allowLocal)
+			if embedded != (rel.TargetMode == "") {
+				t.Errorf("local %v: image %s of %s has target mode %q, embedded %v", allowLocal, l.target, l.source, rel.TargetMode, embedded)
+				continue
+			}
+			if embedded && !bytes.Equal(parts[resolveTarget(l.source, rel.Target)], l.data) {
+				t.Errorf("local %v: image %s of %s embedded with other content", allowLocal, l.target, l.source)
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+)
+
+// styles of an embedded font, in the order of the presentation schema
+var fontStyles = []string{"regular", "bold", "italic", "boldItalic"}
+
+type FontVariant struct {
+	Style string
+	Part  string // empty when the relationship or part is missing
+	Size  uint64
+}
+
+type FontInfo struct {
+	Typeface string
+	Variants []FontVariant
+}
+
+// Size returns the total size of the parts of the font
+func (f FontInfo) Size() uint64 {
+	size := uint64(0)
+	for _, v := range f.Variants {
+		size += v.Size
+	}
+	return size
+}
+
+// Styles lists the variants of the font, marking those whose part is missing
+func (f FontInfo) Styles() string {
+	styles := make([]string, 0, len(f.Variants))
+	for _, v := range f.Variants {
+		if v.Part == "" {
+			styles = append(styles, v.Style+" (missing)")
+		} else {
+			styles = append(styles, v.Style)
+		}
+	}
+	return strings.Join(styles, ", ")
+}
+
+// EmbeddedFonts lists the fonts embedded in the presentation, with the size of the part of each variant
+func (p *PowerpointDoc) EmbeddedFonts() []FontInfo {
+	sizes := make(map[string]uint64, len(p.sourceFileReader.File))
+	for _, f := range p.sourceFileReader.File {
+		sizes[f.Name] = f.UncompressedSize64
+	}
+	fonts := []FontInfo{}
+	for _, e := range p.presentation.FindElements("//p:embeddedFontLst/p:embeddedFont") {
+		info := FontInfo{}
+		if font := e.SelectElement("p:font"); font != nil {
+			info.Typeface = font.SelectAttrValue("typeface", "")
+		}
+		for _, style := range fontStyles {
+			v := e.SelectElement("p:" + style)
+			if v == nil {
+				continue
+			}
+			variant := FontVariant{Style: style}
+			id := v.SelectAttrValue("r:id", "")
+			for _, rel := range p.presentationRels.Relationship {
+				if rel.Id != id || rel.TargetMode == "External" {
+					continue
+				}
+				if target := resolveTarget("ppt/presentation.xml", rel.Target); !p.removedParts[target] {
+					if size, ok := sizes[target]; ok {
+						variant.Part, variant.Size = target, size
+					}
+				}
+			}
+			info.Variants = append(info.Variants, variant)
+		}
+		fonts = append(fonts, info)
+	}
+	return fonts
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/beevik/etree"
+	log "github.com/sirupsen/logrus"
+)
+
+// flags of the embedded OpenType header, which PowerPoint uses for .fntdata parts
+const (
+	eotFlagSubset     = 0x00000001
+	eotFlagCompressed = 0x00000004 // MicroType Express, which we cannot decompress
+	eotFlagXOR        = 0x10000000
+	eotXORKey         = 0x50
+)
+
+// characters always kept, for slide numbers, dates and fields computed when the deck is shown
+const fontSubsetBase = " !\"#$%&'()*+,-./0123456789:;<=>?@ABCDEFGHIJKLMNOPQRSTUVWXYZ[\\]^_`abcdefghijklmnopqrstuvwxyz{|}~"
+
+func isSFNT(data []byte) bool {
+	return len(data) >= 12 && (bytes.Equal(data[:4], []byte{0, 1, 0, 0}) || string(data[:4]) == "true" || string(data[:4]) == "OTTO")
+}
+
+// sfntForbidsSubsetting tells whether the OS/2 table of a font sets the "no subsetting" embedding permission
+func sfntForbidsSubsetting(data []byte) bool {
+	tables := int(binary.BigEndian.Uint16(data[4:]))
+	for i := 0; i < tables && 12+16*i+16 <= len(data); i++ {
+		entry := data[12+16*i:]
+		if string(entry[:4]) != "OS/2" {
+			continue
+		}
+		offset := int(binary.BigEndian.Uint32(entry[8:]))
+		if offset+10 > len(data) {
+			return false
+		}
+		return binary.BigEndian.Uint16(data[offset+8:])&0x0100 != 0
+	}
+	return false
+}
+
+// unwrapFont returns the TrueType or OpenType data of a font part, plain or wrapped in an uncompressed embedded
+// OpenType header, and a function wrapping subset data the same way
+func unwrapFont(data []byte) ([]byte, func([]byte) []byte, error) {
+	if isSFNT(data) {
+		return data, func(subset []byte) []byte { return subset }, nil
+	}
+	if len(data) < 36 || binary.LittleEndian.Uint16(data[34:]) != 0x504c {
+		return nil, nil, errors.New("unknown font format")
+	}
+	eotSize := int(binary.LittleEndian.Uint32(data))
+	fontSize := int(binary.LittleEndian.Uint32(data[4:]))
+	flags := binary.LittleEndian.Uint32(data[12:])
+	if eotSize != len(data) || fontSize > eotSize-36 {
+		return nil, nil, errors.New("invalid embedded OpenType header")
+	}
+	if flags&eotFlagCompressed != 0 {
+		return nil, nil, errors.New("compressed embedded OpenType font")
+	}
+	xor := func(b []byte) []byte {
+		out := make([]byte, len(b))
+		for i := range b {
+			out[i] = b[i]
+			if flags&eotFlagXOR != 0 {
+				out[i] ^= eotXORKey
+			}
+		}
+		return out
+	}
+	header := data[:eotSize-fontSize]
+	font := xor(data[eotSize-fontSize:])
+	if !isSFNT(font) {
+		return nil, nil, errors.New("embedded OpenType font without TrueType data")
+	}
+	wrap := func(subset []byte) []byte {
+		out := append(append([]byte(nil), header...), xor(subset)...)
+		binary.LittleEndian.PutUint32(out, uint32(len(out)))
+		binary.LittleEndian.PutUint32(out[4:], uint32(len(subset)))
+		binary.LittleEndian.PutUint32(out[12:], flags|eotFlagSubset)
+		return out
+	}
+	return font, wrap, nil
+}
+
+// collectText adds the characters of the text runs, field values, bullets and chart values of an xml part
+func collectText(doc *etree.Document, chars map[rune]bool) {
+	for _, e := range doc.FindElements("//*") {
+		if e.Space == "a" && e.Tag == "buChar" {
+			for _, r := range e.SelectAttrValue("char", "") {
+				chars[r] = true
+			}
+		}
+		if e.Tag != "t" && e.Tag != "v" {
+			continue
+		}
+		for _, r := range e.Text() {
+			chars[r] = true
+		}
+	}
+}
+
+// UsedCharacters returns the characters of all text of the slides, layouts, masters, notes, charts and diagrams,
+// along with the printable ascii ones
+func (p *PowerpointDoc) UsedCharacters() string {
+	chars := make(map[rune]bool)
+	for _, r := range fontSubsetBase {
+		chars[r] = true
+	}
+	for _, f := range p.sourceFileReader.File {
+		if !strings.HasPrefix(f.Name, "ppt/") || !strings.HasSuffix(f.Name, ".xml") || p.removedParts[f.Name] {
+			continue
+		}
+		if n, err := getObjectNumberFromFilename(f.Name); err == nil &&
+			((strings.HasPrefix(f.Name, "ppt/slides/") && p.IsSlideRemoved(n-1)) ||
+				(strings.HasPrefix(f.Name, "ppt/slideLayouts/") && p.IsLayoutRemoved(n-1)) ||
+				(strings.HasPrefix(f.Name, "ppt/slideMasters/") && p.IsMasterRemoved(n-1))) {
+			continue
+		}
+		doc, ok := p.parts[f.Name]
+		if !ok {
+			var err error
+			if doc, err = p.ReadPart(f.Name); err != nil {
+				p.Problem(err)
+			}
+		}
+		if doc != nil {
+			collectText(doc, chars)
+		}
+	}
+	runes := make([]rune, 0, len(chars))
+	for r := range chars {
+		runes = append(runes, r)
+	}
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+	return string(runes)
+}
+
+// SubsetFonts reduces the embedded fonts to the characters used by the text of the presentation with an external
+// subsetter, such as "pyftsubset {} --text-file={text} --output-file=/dev/stdout", and keeps the result when smaller.
+// Fonts whose license forbids subsetting, and compressed embedded OpenType fonts, are left as is.
+func (p *PowerpointDoc) SubsetFonts(tool string) {
+	args := strings.Fields(tool)
+	if len(args) == 0 {
+		log.Warnln("font subsetting needs a -fonttool such as \"pyftsubset {} --text-file={text} --output-file=/dev/stdout\", skipped")
+		return
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		log.Warnln("font tool", args[0], "not found, font subsetting skipped")
+		return
+	}
+	fonts := p.EmbeddedFonts()
+	if len(fonts) == 0 {
+		return
+	}
+	text := p.UsedCharacters()
+	log.Debugln("subset fonts to", len([]rune(text)), "characters")
+	done := make(map[string]bool)
+	for _, font := range fonts {
+		for _, v := range font.Variants {
+			if v.Part == "" || done[v.Part] {
+				continue
+			}
+			done[v.Part] = true
+			p.subsetFont(tool, v.Part, text)
+		}
+	}
+}
+
+func (p *PowerpointDoc) subsetFont(tool string, name string, text string) {
+	data, ok := p.replacedParts[name]
+	if !ok {
+		for _, f := range p.sourceFileReader.File {
+			if f.Name == name {
+				rc, err := f.Open()
+				if err == nil {
+					data, err = ioutil.ReadAll(rc)
+					rc.Close()
+				}
+				if err != nil {
+					p.Problem(&PartError{Part: name, Err: err})
+					return
+				}
+			}
+		}
+	}
+	font, wrap, err := unwrapFont(data)
+	if err != nil {
+		log.Infoln("cannot subset font", name, ":", err, ", keep it as is")
+		return
+	}
+	if sfntForbidsSubsetting(font) {
+		log.Infoln("font", name, "does not allow subsetting, keep it as is")
+		return
+	}
+	subset, err := runExternalTool(tool, "ttf", font, text, outputStdout)
+	if err != nil {
+		log.Warnln("font tool failed on", name, ":", err)
+		return
+	}
+	if !isSFNT(subset) {
+		log.Warnln("font tool did not produce a font for", name)
+		return
+	}
+	out := wrap(subset)
+	if len(out) >= len(data) {
+		log.Debugln("subset font", name, "is not smaller, keep original")
+		return
+	}
+	log.Infoln("subset font", name, len(data), "->", len(out))
+	p.replacedParts[name] = out
+}
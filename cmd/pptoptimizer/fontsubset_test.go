@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// testSFNT returns a TrueType font with only an OS/2 table holding the embedding permissions
+func testSFNT(fsType uint16) []byte {
+	data := make([]byte, 12+16+10)
+	binary.BigEndian.PutUint32(data, 0x00010000)
+	binary.BigEndian.PutUint16(data[4:], 1)
+	copy(data[12:], "OS/2")
+	binary.BigEndian.PutUint32(data[12+8:], 28)
+	binary.BigEndian.PutUint32(data[12+12:], 10)
+	binary.BigEndian.PutUint16(data[28+8:], fsType)
+	return data
+}
+
+// testEOT wraps a font in an embedded OpenType header
+func testEOT(font []byte, flags uint32) []byte {
+	header := make([]byte, 40)
+	binary.LittleEndian.PutUint32(header, uint32(len(header)+len(font)))
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(font)))
+	binary.LittleEndian.PutUint32(header[12:], flags)
+	binary.LittleEndian.PutUint16(header[34:], 0x504c)
+	data := append(header, font...)
+	if flags&eotFlagXOR != 0 {
+		for i := len(header); i < len(data); i++ {
+			data[i] ^= eotXORKey
+		}
+	}
+	return data
+}
+
+func TestUnwrapFont(t *testing.T) {
+	font := testSFNT(0)
+	subset := testSFNT(0x0100)
+	for _, flags := range []uint32{0, eotFlagXOR} {
+		data := testEOT(font, flags)
+		unwrapped, wrap, err := unwrapFont(data)
+		if err != nil {
+			t.Fatalf("flags %x: %v", flags, err)
+		}
+		if !bytes.Equal(unwrapped, font) {
+			t.Errorf("flags %x: unwrapped font differs", flags)
+		}
+		wrapped := wrap(subset)
+		if binary.LittleEndian.Uint32(wrapped[12:]) != flags|eotFlagSubset {
+			t.Errorf("flags %x: wrapped flags %x, want the subset flag added", flags, binary.LittleEndian.Uint32(wrapped[12:]))
+		}
+		if again, _, err := unwrapFont(wrapped); err != nil || !bytes.Equal(again, subset) {
+			t.Errorf("flags %x: wrapped subset unwraps to %v, %v", flags, again, err)
+		}
+	}
+
+	if unwrapped, _, err := unwrapFont(font); err != nil || !bytes.Equal(unwrapped, font) {
+		t.Errorf("plain font unwraps to %v, %v", unwrapped, err)
+	}
+	if _, _, err := unwrapFont(testEOT(font, eotFlagCompressed)); err == nil {
+		t.Error("compressed font unwrapped")
+	}
+	if _, _, err := unwrapFont(testEOT(font, 0)[:50]); err == nil {
+		t.Error("truncated font unwrapped")
+	}
+}
+
+func TestSfntForbidsSubsetting(t *testing.T) {
+	tests := []struct {
+		fsType uint16
+		forbid bool
+	}{
+		{0x0000, false}, // installable
+		{0x0008, false}, // editable
+		{0x0100, true},  // no subsetting
+		{0x0108, true},
+	}
+	for _, tt := range tests {
+		font, _, err := unwrapFont(testEOT(testSFNT(tt.fsType), eotFlagXOR))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if forbid := sfntForbidsSubsetting(font); forbid != tt.forbid {
+			t.Errorf("fsType %04x forbids subsetting: %v, want %v", tt.fsType, forbid, tt.forbid)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// dotQuote quotes an id or label, %q would escape non-ASCII characters in a way dot does not understand
+func dotQuote(s string) string {
+	return `"` + dotEscaper.Replace(s) + `"`
+}
+
+// removalCascade returns the parts the removal passes would remove: the unused layouts, then the masters
+// and themes only they use when removeLayouts is set, and the medias no remaining part references when removeMedias is set
+func (p *PowerpointDoc) removalCascade(removeLayouts bool, removeMedias bool) map[string]bool {
+	removed := make(map[string]bool)
+	if removeLayouts && p.SlideCount() > 0 {
+		for i, used := range p.FindUsedLayouts() {
+			if !used && !p.IsLayoutRemoved(i) && !p.isLayoutKept(i) {
+				removed[partName("slideLayout", i)] = true
+			}
+		}
+		usedMasters := make(map[string]bool)
+		for i, rels := range p.slideLayoutRels {
+			if p.IsLayoutRemoved(i) || removed[partName("slideLayout", i)] {
+				continue
+			}
+			for _, rel := range rels.Relationship {
+				if rel.Is("slideMaster") {
+					usedMasters[resolveTarget(partName("slideLayout", i), rel.Target)] = true
+				}
+			}
+		}
+		for i := range p.slideMasterRels {
+			if name := partName("slideMaster", i); !p.IsMasterRemoved(i) && !usedMasters[name] {
+				removed[name] = true
+			}
+		}
+		used := p.FindUsedThemes()
+		for i, rels := range p.slideMasterRels {
+			if name := partName("slideMaster", i); removed[name] {
+				for _, rel := range rels.Relationship {
+					if rel.Is("theme") && rel.TargetMode != "External" {
+						used[resolveTarget(name, rel.Target)]--
+					}
+				}
+			}
+		}
+		for _, f := range p.sourceFileReader.File {
+			if reThemePart.MatchString(f.Name) && !p.removedParts[f.Name] && used[f.Name] <= 0 {
+				removed[f.Name] = true
+			}
+		}
+	}
+	if removeMedias {
+		used := p.referencedParts(func(source string) bool { return removed[source] })
+		for _, name := range p.MediaNames() {
+			if !used[name] {
+				removed[name] = true
+			}
+		}
+	}
+	return removed
+}
+
+func (p *PowerpointDoc) graphLabel(name string) string {
+	n, err := getObjectNumberFromFilename(name)
+	switch {
+	case err == nil && path.Dir(name) == "ppt/slides":
+		return fmt.Sprintf("slide %d", n)
+	case err == nil && path.Dir(name) == "ppt/slideLayouts":
+		if layout := p.LayoutName(n - 1); layout != "" {
+			return fmt.Sprintf("layout %d\n%s", n, layout)
+		}
+		return fmt.Sprintf("layout %d", n)
+	case err == nil && path.Dir(name) == "ppt/slideMasters":
+		return fmt.Sprintf("master %d", n)
+	}
+	return path.Base(name)
+}
+
+// WriteRemovalGraph writes in DOT format the slides, layouts, masters, themes and medias with their references,
+// highlighting what the removal passes would remove, without removing anything
+func (p *PowerpointDoc) WriteRemovalGraph(w io.Writer, removeLayouts bool, removeMedias bool) error {
+	removed := p.removalCascade(removeLayouts, removeMedias)
+	bw := bufio.NewWriter(w)
+	nodes := make(map[string]bool)
+	edges := make(map[[2]string]bool)
+	node := func(name string) {
+		if nodes[name] {
+			return
+		}
+		nodes[name] = true
+		fmt.Fprintf(bw, "  %s [label=%s", dotQuote(name), dotQuote(p.graphLabel(name)))
+		if removed[name] {
+			fmt.Fprint(bw, ", style=filled, fillcolor=\"#f4cccc\"")
+		}
+		fmt.Fprintln(bw, "];")
+	}
+
+	fmt.Fprintln(bw, "digraph removal {")
+	fmt.Fprintln(bw, "  rankdir=LR;")
+	fmt.Fprintln(bw, "  node [shape=box];")
+	p.forEachPartRels(func(source string, rels *Relationships) {
+		for _, rel := range rels.Relationship {
+			if rel.TargetMode == "External" {
+				continue
+			}
+			target := resolveTarget(source, rel.Target)
+			_, media := p.medias[target]
+			if !media && !rel.Is("slideLayout") && !rel.Is("slideMaster") && !rel.Is("theme") {
+				continue
+			}
+			// masters list their layouts, the cascade goes the other way
+			if rel.Is("slideLayout") && path.Dir(source) == "ppt/slideMasters" {
+				continue
+			}
+			if edges[[2]string{source, target}] {
+				continue // audio and video have two relationships to the same media
+			}
+			edges[[2]string{source, target}] = true
+			node(source)
+			node(target)
+			if removed[source] || removed[target] {
+				fmt.Fprintf(bw, "  %s -> %s [style=dashed, color=gray];\n", dotQuote(source), dotQuote(target))
+			} else {
+				fmt.Fprintf(bw, "  %s -> %s;\n", dotQuote(source), dotQuote(target))
+			}
+		}
+	})
+	for _, name := range p.MediaNames() {
+		node(name) // unreferenced medias
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
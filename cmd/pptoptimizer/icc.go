@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// stripICC removes the embedded ICC color profile of a png (iCCP chunk) or jpeg (APP2 ICC_PROFILE segments),
+// without decoding the picture. It returns the new data and the size of the profile removed.
+func stripICC(data []byte, format string) ([]byte, int, error) {
+	switch format {
+	case "png":
+		return stripPNGChunk(data, "iCCP")
+	case "jpeg":
+		return stripJPEGSegments(data, 0xe2, []byte("ICC_PROFILE\x00"))
+	}
+	return data, 0, nil
+}
+
+func stripPNGChunk(data []byte, chunk string) ([]byte, int, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, 0, fmt.Errorf("not a png")
+	}
+	out := bytes.NewBuffer(nil)
+	out.Write(pngSignature)
+	removed := 0
+	for pos := len(pngSignature); pos < len(data); {
+		if pos+8 > len(data) {
+			return nil, 0, fmt.Errorf("truncated png chunk")
+		}
+		end := pos + 12 + int(binary.BigEndian.Uint32(data[pos:]))
+		if end > len(data) || end < pos {
+			return nil, 0, fmt.Errorf("truncated png chunk")
+		}
+		if string(data[pos+4:pos+8]) == chunk {
+			removed += end - pos
+		} else {
+			out.Write(data[pos:end])
+		}
+		pos = end
+	}
+	return out.Bytes(), removed, nil
+}
+
+func stripJPEGSegments(data []byte, marker byte, prefix []byte) ([]byte, int, error) {
+	if len(data) < 2 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil, 0, fmt.Errorf("not a jpeg")
+	}
+	out := bytes.NewBuffer(nil)
+	out.Write(data[:2])
+	removed := 0
+	pos := 2
+	for pos < len(data) {
+		if data[pos] != 0xff || pos+1 >= len(data) {
+			return nil, 0, fmt.Errorf("invalid jpeg marker at %d", pos)
+		}
+		m := data[pos+1]
+		if m == 0xff { // fill byte
+			out.WriteByte(0xff)
+			pos++
+			continue
+		}
+		if m == 0x01 || (m >= 0xd0 && m <= 0xd7) { // markers without length
+			out.Write(data[pos : pos+2])
+			pos += 2
+			continue
+		}
+		if pos+4 > len(data) {
+			return nil, 0, fmt.Errorf("truncated jpeg segment")
+		}
+		end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+		if end > len(data) {
+			return nil, 0, fmt.Errorf("truncated jpeg segment")
+		}
+		if m == 0xda { // start of scan, the rest is image data
+			out.Write(data[pos:])
+			break
+		}
+		if m == marker && bytes.HasPrefix(data[pos+4:end], prefix) {
+			removed += end - pos
+		} else {
+			out.Write(data[pos:end])
+		}
+		pos = end
+	}
+	return out.Bytes(), removed, nil
+}
+
+// ICCProfileSize returns the size of the color profile embedded in a png or jpeg media, 0 if none
+func (p *PowerpointDoc) ICCProfileSize(name string) int {
+	format, err := p.SniffMedia(name)
+	if err != nil || (format != "png" && format != "jpeg") {
+		return 0
+	}
+	data, err := p.ReadMedia(name)
+	if err != nil {
+		return 0
+	}
+	_, removed, err := stripICC(data, format)
+	if err != nil {
+		return 0
+	}
+	return removed
+}
+
+// StripICCProfiles removes the color profiles embedded in png and jpeg medias, which are then rendered as sRGB
+func (p *PowerpointDoc) StripICCProfiles() {
+	for _, name := range p.MediaNames() {
+		data, format := p.readMediaOfFormat(name, "png", "jpeg")
+		if format == "" {
+			continue
+		}
+		out, removed, err := stripICC(data, format)
+		if err != nil {
+			log.Warnln("cannot strip color profile of", name, ":", err)
+			continue
+		}
+		if removed == 0 {
+			continue
+		}
+		if sniffImageFormat(out) != format {
+			log.Warnln("stripped", name, "is not decodable, keep original")
+			continue
+		}
+		log.Infoln("stripped color profile of", name, len(data), "->", len(out))
+		p.ReplaceMedia(name, out, fmt.Sprintf("stripped %d bytes color profile", removed))
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type MediaInfo struct {
+	Name   string
+	Size   uint64
+	Format string
+	ICC    int // size of the embedded color profile
+}
+
+func (p *PowerpointDoc) ListMedia() []MediaInfo {
+	infos := []MediaInfo{}
+	for _, name := range p.MediaNames() {
+		format, err := p.SniffMedia(name)
+		if err != nil {
+			p.Problem(err)
+		}
+		if format == "" {
+			format = mediaExtension(name)
+		}
+		infos = append(infos, MediaInfo{Name: name, Size: p.medias[name].size, Format: format, ICC: p.ICCProfileSize(name)})
+	}
+	return infos
+}
+
+type PartInfo struct {
+	Name           string
+	Size           uint64
+	CompressedSize uint64
+}
+
+// TopParts returns the n largest parts of the source file by compressed size, whatever their type,
+// from the sizes of the zip central directory
+func (p *PowerpointDoc) TopParts(n int) []PartInfo {
+	parts := make([]PartInfo, 0, len(p.sourceFileReader.File))
+	for _, f := range p.sourceFileReader.File {
+		if !strings.HasSuffix(f.Name, "/") {
+			parts = append(parts, PartInfo{Name: f.Name, Size: f.UncompressedSize64, CompressedSize: f.CompressedSize64})
+		}
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		if parts[i].CompressedSize != parts[j].CompressedSize {
+			return parts[i].CompressedSize > parts[j].CompressedSize
+		}
+		return parts[i].Name < parts[j].Name
+	})
+	if n >= 0 && n < len(parts) {
+		parts = parts[:n]
+	}
+	return parts
+}
+
+// extractPath returns where to extract a media within dir, or an error if its name would escape dir
+// such as ppt/media/../../x or an absolute path (zip slip)
+func extractPath(dir string, name string) (string, error) {
+	rel := filepath.FromSlash(strings.TrimPrefix(name, "ppt/media/"))
+	if rel == "" || filepath.IsAbs(rel) || filepath.VolumeName(rel) != "" {
+		return "", errors.New("invalid media name " + name)
+	}
+	dest := filepath.Join(dir, rel)
+	if r, err := filepath.Rel(filepath.Clean(dir), dest); err != nil || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+		return "", errors.New("media name " + name + " escapes the destination directory")
+	}
+	return dest, nil
+}
+
+// ExtractMedia writes all medias to a directory, skipping those whose name would escape it
+func (p *PowerpointDoc) ExtractMedia(dir string) error {
+	for _, name := range p.MediaNames() {
+		dest, err := extractPath(dir, name)
+		if err != nil {
+			log.Warnln("skip", err)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		mf, err := p.OpenMedia(name)
+		if err != nil {
+			return err
+		}
+		out, err := os.Create(dest)
+		if err != nil {
+			mf.Close()
+			return err
+		}
+		_, err = io.Copy(out, partReader{r: mf, name: name})
+		mf.Close()
+		out.Close()
+		if err != nil {
+			return err
+		}
+		log.Infoln("extracted", name, "to", dest)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtractPath(t *testing.T) {
+	dir := filepath.Join("out", "medias")
+	tests := []struct {
+		name string
+		want string // empty when rejected
+	}{
+		{"ppt/media/image1.png", filepath.Join(dir, "image1.png")},
+		{"ppt/media/sub/image1.png", filepath.Join(dir, "sub", "image1.png")},
+		{"ppt/media/sub/../image2.png", filepath.Join(dir, "image2.png")},
+		{"ppt/pictures/image3.png", filepath.Join(dir, "ppt", "pictures", "image3.png")},
+		{"ppt/media/../../evil.png", ""},
+		{"ppt/media/../../../evil.png", ""},
+		{"ppt/media/..", ""},
+		{"ppt/media/", ""},
+		{"../evil.png", ""},
+		{"ppt/media//etc/evil", ""},
+	}
+	if filepath.Separator == '/' {
+		tests = append(tests, struct {
+			name string
+			want string
+		}{"/etc/evil", ""})
+	}
+	for _, tt := range tests {
+		got, err := extractPath(dir, tt.name)
+		if tt.want == "" && err == nil {
+			t.Errorf("%s extracted to %s, want rejected", tt.name, got)
+		}
+		if tt.want != "" && (err != nil || got != tt.want) {
+			t.Errorf("%s extracted to %s (%v), want %s", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestExtractMediaRejectsTraversal(t *testing.T) {
+	d := newTestDeck(1)
+	d.image("ppt/slides/slide1.xml", "ppt/media/image1.png", testPNG(8, 8))
+	d.addBytes("ppt/media/../../evil.png", "", []byte("evil"))
+	d.addBytes("ppt/media/../../../evil.png", "", []byte("evil"))
+	p := d.parse(t)
+
+	root := t.TempDir()
+	dir := filepath.Join(root, "a", "b")
+	if err := p.ExtractMedia(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "image1.png")); err != nil {
+		t.Error(err)
+	}
+	for _, name := range []string{filepath.Join(root, "evil.png"), filepath.Join(root, "a", "evil.png"), filepath.Join(filepath.Dir(root), "evil.png")} {
+		if _, err := os.Stat(name); err == nil {
+			t.Errorf("%s written outside the destination directory", name)
+			os.Remove(name)
+		}
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("%d files extracted, want 1", len(entries))
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"github.com/beevik/etree"
+	log "github.com/sirupsen/logrus"
+)
+
+// LinkedImage is an image of a slide, layout or master linked to a file outside of the package
+type LinkedImage struct {
+	Part   string
+	Target string
+	Cached bool // every picture linking it also embeds a copy, shown when the target cannot be reached
+}
+
+// imageReferences returns the relationship ids referenced as embedded pictures (r:embed) and as linked ones (r:link),
+// the latter mapped to whether all the elements linking them also embed a cached copy
+func imageReferences(doc *etree.Document) (map[string]bool, map[string]bool) {
+	embedded := make(map[string]bool)
+	for _, e := range doc.FindElements("//*[@r:embed]") {
+		embedded[e.SelectAttrValue("r:embed", "")] = true
+	}
+	linked := make(map[string]bool)
+	for _, e := range doc.FindElements("//*[@r:link]") {
+		id := e.SelectAttrValue("r:link", "")
+		cached, seen := linked[id]
+		linked[id] = (cached || !seen) && e.SelectAttr("r:embed") != nil
+	}
+	return embedded, linked
+}
+
+// LinkedImages lists the external images of the remaining slides, layouts and masters, which the media
+// optimizations leave alone since they are not in the package
+func (p *PowerpointDoc) LinkedImages() []LinkedImage {
+	var images []LinkedImage
+	p.forEachPartRels(func(name string, rels *Relationships) {
+		var embedded, linked map[string]bool
+		for _, rel := range rels.Relationship {
+			if !rel.Is("image") || rel.TargetMode != "External" {
+				continue
+			}
+			if linked == nil {
+				doc, err := p.ReadPart(name)
+				if err != nil {
+					p.Problem(err)
+				}
+				if doc == nil {
+					break
+				}
+				embedded, linked = imageReferences(doc)
+			}
+			if embedded[rel.Id] {
+				log.Warnln(name, "embeds the external image", rel.Target, ", which is not in the package")
+			}
+			images = append(images, LinkedImage{Part: name, Target: rel.Target, Cached: linked[rel.Id]})
+		}
+	}, numberedKinds...)
+	return images
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLinkedImagesOfSlidesLayoutsAndMasters(t *testing.T) {
+	d := newTestDeck(2)
+	d.notes(2, "ppt/theme/theme1.xml")
+	links := map[string]string{
+		"ppt/slides/slide2.xml":             "http://example.com/slide.png",
+		"ppt/slideLayouts/slideLayout1.xml": "http://example.com/layout.png",
+		"ppt/slideMasters/slideMaster1.xml": "http://example.com/master.png",
+		"ppt/notesMasters/notesMaster1.xml": "http://example.com/notes.png",
+	}
+	for part, target := range links {
+		d.picture(part, "r:link", d.rel(part, "image", target))
+	}
+	p := d.parse(t)
+	p.RemoveSlide(1)
+
+	// the notes master is not listed, and neither is the removed slide
+	want := []LinkedImage{
+		{Part: "ppt/slideLayouts/slideLayout1.xml", Target: "http://example.com/layout.png"},
+		{Part: "ppt/slideMasters/slideMaster1.xml", Target: "http://example.com/master.png"},
+	}
+	if images := p.LinkedImages(); !reflect.DeepEqual(images, want) {
+		t.Errorf("linked images %v, want %v", images, want)
+	}
+}
@@ -1,51 +1,753 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
 func main() {
-	flagVerbose := flag.Bool("v", false, "verbose logging")
-	flagInputFile := flag.String("f", "", "pptx input file")
-	flagConvertBitmaps := flag.Bool("convert", true, "convert uncompressed pictures such as TIFF to PNG (lossless)")
-	flagCleanLayouts := flag.Bool("layouts", false, "remove all unused layouts, masters, and their media files")
-	flagAllOptimizations := flag.Bool("a", false, "apply all optimizations")
-	flag.Parse()
+	command := "optimize"
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "optimize":
+		optimize(args)
+	case "inspect":
+		inspect(args)
+	case "extract":
+		extract(args)
+	case "excerpt":
+		excerpt(args)
+	case "compare":
+		compare(args)
+	case "batch":
+		batch(args)
+	default:
+		exitWith(exitUsage, "unknown command", command, "- expected optimize, inspect, extract, excerpt, compare or batch")
+	}
+}
+
+func parseInput(fs *flag.FlagSet, args []string) (string, *PowerpointDoc) {
+	flagVerbose := fs.Bool("v", false, "verbose logging")
+	flagInputFile := fs.String("f", "", "pptx input file")
+	fs.Parse(args)
+
+	if *flagVerbose {
+		log.SetLevel(log.DebugLevel)
+	}
+	if *flagInputFile == "" {
+		exitWith(exitUsage, "no input file given with -f")
+	}
+	if _, err := os.Stat(*flagInputFile); err != nil {
+		exitWith(exitInput, "cannot open input file:", err)
+	}
+
+	p := NewPowerpointDoc()
+	if err := p.ParseFile(*flagInputFile); err != nil {
+		exitWith(exitInput, "cannot parse input file:", err)
+	}
+	return *flagInputFile, p
+}
+
+func inspect(args []string) {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	flagTop := fs.Int("top", 10, "number of largest parts to list, of any type")
+	_, p := parseInput(fs, args)
+	defer p.Close()
+
+	fmt.Println("medias:")
+	for _, m := range p.ListMedia() {
+		if m.ICC > 0 {
+			fmt.Printf("  %-30s %10d %s, %d bytes color profile\n", m.Name, m.Size, m.Format, m.ICC)
+		} else {
+			fmt.Printf("  %-30s %10d %s\n", m.Name, m.Size, m.Format)
+		}
+	}
+	fmt.Println("largest parts (compressed, uncompressed):")
+	for _, part := range p.TopParts(*flagTop) {
+		fmt.Printf("  %-40s %10d %10d\n", part.Name, part.CompressedSize, part.Size)
+	}
+	fmt.Println("slides:", p.SlideCount(), "listed,", p.SourceSlideParts(), "slide parts")
+	fmt.Println("media size per slide:")
+	for i, size := range p.SlideMediaSizes() {
+		if !p.IsSlideRemoved(i) {
+			fmt.Printf("  slide %-4d %10d\n", i+1, size)
+		}
+	}
+	if images := p.LinkedImages(); len(images) > 0 {
+		fmt.Println("linked images:")
+		for _, l := range images {
+			if l.Cached {
+				fmt.Printf("  %-30s %s (cached copy embedded)\n", l.Part, l.Target)
+			} else {
+				fmt.Printf("  %-30s %s\n", l.Part, l.Target)
+			}
+		}
+	}
+	if fonts := p.EmbeddedFonts(); len(fonts) > 0 {
+		fmt.Println("embedded fonts:")
+		for _, f := range fonts {
+			fmt.Printf("  %-30s %10d %s\n", f.Typeface, f.Size(), f.Styles())
+		}
+	}
+	p.ReportDuplicateMedias()
+	p.ReportDuplicateEmbeddings()
+	fmt.Println("stream ordered:", p.IsStreamOrdered())
+	fmt.Println("digitally signed:", p.IsSigned())
+	if err := p.Err(); err != nil {
+		exitWith(errorExitCode(err), err)
+	}
+}
+
+func extract(args []string) {
+	fs := flag.NewFlagSet("extract", flag.ExitOnError)
+	flagOutputDir := fs.String("o", ".", "directory where medias are extracted")
+	_, p := parseInput(fs, args)
+	defer p.Close()
+
+	if err := p.ExtractMedia(*flagOutputDir); err != nil {
+		exitWith(errorExitCode(err), "cannot extract medias:", err)
+	}
+}
+
+func excerpt(args []string) {
+	fs := flag.NewFlagSet("excerpt", flag.ExitOnError)
+	flagSlides := fs.String("slides", "", "slides to keep, in presentation order, such as 1,3-5")
+	flagOutputFile := fs.String("o", "", "pptx output file")
+	_, p := parseInput(fs, args)
+	defer p.Close()
+
+	if *flagOutputFile == "" {
+		exitWith(exitUsage, "no output file given with -o")
+	}
+	positions, err := parseSlideRanges(*flagSlides)
+	if err != nil {
+		exitWith(exitUsage, err)
+	}
+	e, err := p.ExtractSlides(positions)
+	if err != nil {
+		exitWith(errorExitCode(err), "cannot extract slides:", err)
+	}
+	defer e.Close()
+	if err := e.SaveFile(*flagOutputFile); err != nil {
+		os.Remove(*flagOutputFile)
+		exitWith(exitFailure, "cannot write output file:", err)
+	}
+}
+
+func compare(args []string) {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	flagVerbose := fs.Bool("v", false, "verbose logging")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: pptoptimizer compare [-v] original.pptx optimized.pptx")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *flagVerbose {
+		log.SetLevel(log.DebugLevel)
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+
+	a := NewPowerpointDoc()
+	defer a.Close()
+	if err := a.ParseFile(fs.Arg(0)); err != nil {
+		exitWith(exitInput, "cannot parse", fs.Arg(0), ":", err)
+	}
+	b := NewPowerpointDoc()
+	defer b.Close()
+	if err := b.ParseFile(fs.Arg(1)); err != nil {
+		exitWith(exitInput, "cannot parse", fs.Arg(1), ":", err)
+	}
+	Compare(a, b).Print(os.Stdout)
+}
+
+func batch(args []string) {
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	flagVerbose := fs.Bool("v", false, "verbose logging")
+	flagParallel := fs.Int("parallel", runtime.NumCPU(), "number of files optimized at once")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: pptoptimizer batch [-v] [-parallel n] files or directories... [-- optimize flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *flagVerbose {
+		log.SetLevel(log.DebugLevel)
+	}
+	paths, optimizeArgs := fs.Args(), []string{}
+	for i, arg := range paths {
+		if arg == "--" {
+			paths, optimizeArgs = paths[:i], paths[i+1:]
+			break
+		}
+	}
+	if len(paths) == 0 || *flagParallel < 1 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	for _, arg := range optimizeArgs {
+		if batchSetFlags[flagName(arg)] {
+			exitWith(exitUsage, "batch sets", arg, "itself for each file")
+		}
+	}
+
+	files, err := batchFiles(paths)
+	if err != nil {
+		exitWith(exitInput, "cannot list input files:", err)
+	}
+	results := runBatch(files, optimizeArgs, *flagParallel)
+	printBatchSummary(os.Stdout, results)
+	failed := 0
+	for _, r := range results {
+		if r.Err != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		exitWith(exitFailure, failed, "files failed")
+	}
+}
+
+func optimize(args []string) {
+	fs := flag.NewFlagSet("optimize", flag.ExitOnError)
+	flagVerbose := fs.Bool("v", false, "verbose logging")
+	flagInputFile := fs.String("f", "", "pptx input file")
+	flagConvertBitmaps := fs.Bool("convert", true, "convert uncompressed pictures such as TIFF to PNG (lossless)")
+	flagFixExtensions := fs.Bool("fixext", false, "rename pictures whose extension or content type does not match their actual format")
+	flagFixTypes := fs.Bool("fixtypes", false, "correct the declared content type of pictures to match their actual format")
+	flagCleanLayouts := fs.Bool("layouts", false, "remove all unused layouts, masters, and their media files")
+	flagFlattenPNGs := fs.Bool("flatten", false, "re-encode PNG pictures with a fully opaque alpha channel without it")
+	flagKeepLayouts := fs.String("keeplayouts", "", "comma separated numbers or names of unused layouts to keep, or \"all\" (default for .potx templates)")
+	flagRecompressPNGs := fs.Bool("recompress", false, "recompress PNG pictures, with the -pngtool optimizer if available")
+	flagPNGTool := fs.String("pngtool", os.Getenv("PPTOPTIMIZER_PNGTOOL"), "external PNG optimizer command, reading stdin and writing stdout, or updating the file given as {} (default $PPTOPTIMIZER_PNGTOOL)")
+	flagProgressive := fs.Bool("progressive", false, "convert JPEG pictures to progressive ones with the -jpegtool, when smaller")
+	flagJPEGTool := fs.String("jpegtool", os.Getenv("PPTOPTIMIZER_JPEGTOOL"), "external JPEG encoder for -progressive, reading stdin and writing stdout, or updating the file given as {}, such as \"jpegtran -progressive -copy all\" (default $PPTOPTIMIZER_JPEGTOOL)")
+	flagTiffTool := fs.String("tifftool", os.Getenv("PPTOPTIMIZER_TIFFTOOL"), "external converter for TIFF pictures the internal decoder does not support, reading TIFF on stdin and writing PNG on stdout, or converting the file given as {} to PNG in place (default $PPTOPTIMIZER_TIFFTOOL)")
+	flagFormats := fs.String("formats", "", "file of lines \"<media name> keep|png|jpeg [quality]\" overriding the optimizations of specific medias, e.g. \"image7.png jpeg 70\"")
+	flag8Bit := fs.Bool("8bit", false, "reduce PNG pictures with 16 bits per channel to 8 bits, which is all a slide can display")
+	flagDither := fs.Bool("dither", false, "with -8bit, dither the reduced pictures to avoid banding in gradients")
+	flagStripICC := fs.Bool("stripicc", false, "remove color profiles embedded in PNG and JPEG pictures, which are then rendered as sRGB")
+	flagCMYK := fs.Bool("cmyk2rgb", false, "convert CMYK JPEG pictures, rendered with wrong colors by some viewers, to RGB (lossy)")
+	flagMinVersion := fs.String("minversion", "", "oldest PowerPoint version which must display the output, such as 2010, warning about incompatible pictures and conversions")
+	flagDPI := fs.Int("dpi", 0, "downscale PNG and JPEG pictures larger than the slide displayed at this resolution (lossy)")
+	flagFilter := fs.String("filter", defaultScaleFilter, "resampling filter of -dpi, from the fastest to the sharpest: nearest, approxbilinear, bilinear, catmullrom or lanczos")
+	flagRenumber := fs.Bool("renumber", false, "rewrite relationship ids to a compact rId1..rIdN form")
+	flagRemoveNotes := fs.Bool("removenotes", false, "remove the speaker notes of all slides, and the notes master")
+	flagNoCustomXML := fs.Bool("nocustomxml", false, "remove the custom xml parts added by add-ins and document management systems which no part references")
+	flagSubsetFonts := fs.Bool("subsetfonts", false, "reduce the embedded fonts to the characters used by the presentation with the -fonttool")
+	flagFontTool := fs.String("fonttool", os.Getenv("PPTOPTIMIZER_FONTTOOL"), "external font subsetter for -subsetfonts, reading the font given as {} and the characters of the file given as {text}, and writing stdout, such as \"pyftsubset {} --text-file={text} --output-file=/dev/stdout\" (default $PPTOPTIMIZER_FONTTOOL)")
+	flagSVG := fs.Bool("svg", false, "strip SVG pictures of comments, metadata, drawing tool data and indentation")
+	flagNoTransitionSounds := fs.Bool("notransitionsounds", false, "silence slide transitions and remove the sounds they played")
+	flagSVGMode := fs.String("svgmode", "", "keep only the svg (svg) or the png fallback (png) of the pictures which have both")
+	flagRenameMedias := fs.Bool("renamemedias", false, "rename the medias image1..imageN and media1..mediaN in the order of the slides, with the extension of their actual format")
+	flagDedupMedias := fs.Bool("dedupmedias", false, "keep a single copy of identical medias, pointing all slides, layouts and masters to it")
+	flagDedupEmbeddings := fs.Bool("dedupembeddings", false, "keep a single copy of identical embedded documents such as chart workbooks")
+	flagMinify := fs.Bool("minify", false, "strip the insignificant whitespace and indentation of slides, layouts, masters and other xml parts")
+	flagMediaOnly := fs.Bool("mediaonly", false, "apply all media optimizations and remove unused medias, copying slides, layouts, masters and other xml parts verbatim")
+	flagAllOptimizations := fs.Bool("a", false, "apply all optimizations, except those explicitly disabled such as -convert=false")
+	flagProfile := fs.String("profile", "", "apply a named combination of optimizations, except those explicitly disabled: presenter (lossless only, keeping notes, transitions and medias)")
+	flagInline := fs.Bool("inline", false, "fetch externally linked images and embed them in the file")
+	flagInlineTimeout := fs.Duration("inlinetimeout", 10*time.Second, "timeout when fetching an external image")
+	flagInlineMaxSize := fs.Int64("inlinemaxsize", 20*1024*1024, "maximum size in bytes of an external image to embed")
+	flagInlineLocal := fs.Bool("inlinelocal", false, "with -inline, also embed images linked to local paths or file: urls, which may be any file readable on this machine")
+	flagBestEffort := fs.Bool("besteffort", false, "keep going after errors, save what could be optimized and report all problems at the end")
+	flagManifest := fs.Bool("manifest", false, "write a JSON manifest with the size and SHA-256 of every part of the output next to it")
+	flagAudit := fs.Bool("audit", false, "record the optimizations applied to each media in a custom part of the output")
+	flagKeepOriginals := fs.Bool("keeporiginals", false, "keep the original content of the changed medias in the output, which is then larger, so that they can be restored")
+	flagDiff := fs.Bool("diff", false, "print the relationships added, removed or retargeted by the optimizations")
+	flagMark := fs.Bool("mark", false, "add the \"pptoptimized\" keyword to the document properties, so that processed files can be detected")
+	flagSkipMarked := fs.Bool("skipmarked", false, "do nothing if the input file was already processed with -mark")
+	flagTopPct := fs.Int("toppct", 100, "only optimize the largest medias which together make up this percentage of the media bytes, leaving the small ones untouched")
+	flagMinFileSize := fs.Int64("minfilesize", 0, "do nothing if the input file is smaller than this size in bytes, for sweeps over many files")
+	flagSummaryOnly := fs.Bool("summaryonly", false, "only log warnings and errors, and print the sizes before and after on one line")
+	flagReportFormat := fs.String("reportformat", "", "print a report of the sizes, counts and problems on stdout, as text, json or csv")
+	flagReportFile := fs.String("reportfile", "", "write the -reportformat report to this file instead of stdout")
+	flagDeep := fs.Bool("deep", false, "also flatten, strip and recompress the pictures of embedded documents such as chart workbooks, as enabled for the presentation")
+	flagSelfTest := fs.Bool("selftest", true, "parse the output again and fail if slides, pictures or content types were lost")
+	flagFailOnWarn := fs.Bool("failonwarn", false, "exit with an error if any warning was logged, after writing the output")
+	flagNoBloat := fs.Bool("nobloat", false, "exit with code 4 without writing the output, or replacing the input with -inplace, if it would not be smaller than the input")
+	flagGraph := fs.String("graph", "", "write to this file the slides, layouts, masters, themes and medias in DOT format, highlighting what the enabled removals would remove, and exit")
+	flagShowConfig := fs.Bool("showconfig", false, "print the passes which would run with their settings, and exit")
+	flagInPlace := fs.Bool("inplace", false, "overwrite the input file instead of creating a new one")
+	flagNoClobber := fs.Bool("noclobber", false, "fail instead of overwriting an existing output file, such as the result of a previous run")
+	flagForce := fs.Bool("force", false, "overwrite an existing output file, even with -noclobber (default behavior)")
+	flagRetries := fs.Int("retries", 3, "number of retries when creating or renaming the output file fails, for network filesystems")
+	flagRetryDelay := fs.Duration("retrydelay", 200*time.Millisecond, "delay before the first retry, doubled for each of the next ones")
+	flagMemBudget := fs.Int64("membudget", 0, "maximum size in bytes of converted pictures kept in memory, beyond which they are written to temporary files (default no limit)")
+	flagDecodeCache := fs.Int64("decodecache", defaultDecodeCacheSize, "maximum size in bytes of the decoded pictures kept between passes, at most the -membudget, 0 to decode them again in each pass")
+	flagStreamOrder := fs.Bool("streamorder", false, "write content types and xml parts first and the largest medias last, for viewers streaming the file")
+	flagBackup := fs.Int("backup", 0, "with -inplace, keep the original as <file>.bak, and up to this number of backups of previous runs as <file>.bak1, <file>.bak2...")
+	flagAllowUnsign := fs.Bool("allowunsign", false, "optimize digitally signed files, whose signature is then invalid")
+	flagTmpDir := fs.String("tmpdir", "", "directory where the output is staged before being renamed over the input file with -inplace (default: input file directory)")
+	fs.Parse(args)
+
+	// -a enables all optimizations, except those explicitly disabled, e.g. -a -convert=false
+	// -mediaonly enables the media ones and disables those editing xml
+	// -profile enables a named set of them, and rejects the options it excludes
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	profile, err := checkProfile(*flagProfile, fs)
+	if err != nil {
+		exitWith(exitUsage, err)
+	}
+	xmlOptimizations := map[string]bool{"layouts": true, "renumber": true, "minify": true, "dedupembeddings": true}
+	enabled := func(name string, value bool) bool {
+		if *flagMediaOnly && xmlOptimizations[name] {
+			return false
+		}
+		if explicit[name] {
+			return value
+		}
+		return value || *flagAllOptimizations || *flagMediaOnly || profile.enables(name)
+	}
+	convert := enabled("convert", *flagConvertBitmaps)
+	fixTypes := enabled("fixtypes", *flagFixTypes)
+	flatten := enabled("flatten", *flagFlattenPNGs)
+	recompress := enabled("recompress", *flagRecompressPNGs)
+	cleanLayouts := enabled("layouts", *flagCleanLayouts)
+	renumber := enabled("renumber", *flagRenumber)
+	minify := enabled("minify", *flagMinify)
+	dedupEmbeddings := enabled("dedupembeddings", *flagDedupEmbeddings)
+	dedupMedias := enabled("dedupmedias", *flagDedupMedias)
+	svg := enabled("svg", *flagSVG)
+	var keepLayouts []string
+	if *flagKeepLayouts != "" {
+		keepLayouts = strings.Split(*flagKeepLayouts, ",")
+	} else if strings.ToLower(filepath.Ext(*flagInputFile)) == ".potx" {
+		keepLayouts = []string{"all"}
+	}
+	outputFileName := strings.Replace(*flagInputFile, filepath.Ext(*flagInputFile), ".new.pptx", 1)
+	if *flagInPlace {
+		outputFileName = *flagInputFile
+	}
+
+	if *flagShowConfig {
+		fmt.Println("input:", *flagInputFile)
+		fmt.Println("output:", outputFileName)
+		if *flagProfile != "" {
+			fmt.Println("profile:", *flagProfile)
+		}
+		fmt.Println("passes:")
+		pass := func(run bool, format string, settings ...interface{}) {
+			if run {
+				fmt.Printf("  "+format+"\n", settings...)
+			}
+		}
+		pass(*flagInline, "inline external images (timeout %v, max size %d, local files %v)", *flagInlineTimeout, *flagInlineMaxSize, *flagInlineLocal)
+		pass(*flagSVGMode != "", "keep only the %s version of svg pictures", *flagSVGMode)
+		pass(convert, "convert tiff to png (fix extensions %v, tiff tool %q)", *flagFixExtensions, *flagTiffTool)
+		pass(fixTypes, "fix content types")
+		pass(*flagFormats != "", "convert medias listed in %s", *flagFormats)
+		pass(flatten, "flatten opaque png")
+		pass(*flagCMYK, "convert cmyk jpeg to rgb")
+		pass(*flag8Bit, "reduce 16 bits png to 8 bits (dither %v)", *flagDither)
+		pass(*flagStripICC, "strip color profiles")
+		pass(*flagDPI > 0, "downscale pictures (%d dpi, %s filter)", *flagDPI, *flagFilter)
+		pass(*flagProgressive, "convert jpeg to progressive (jpeg tool %q)", *flagJPEGTool)
+		pass(recompress, "recompress png (png tool %q)", *flagPNGTool)
+		pass(svg, "minify svg")
+		pass(dedupMedias, "deduplicate medias")
+		pass(dedupEmbeddings, "deduplicate embedded documents")
+		pass(*flagDeep, "optimize embedded documents")
+		pass(*flagRemoveNotes, "remove notes")
+		pass(*flagNoTransitionSounds, "remove transition sounds")
+		pass(*flagNoCustomXML, "remove unused custom xml")
+		pass(cleanLayouts, "remove unused layouts, masters and themes (keep layouts %q)", keepLayouts)
+		pass(cleanLayouts || *flagMediaOnly, "remove unused medias")
+		pass(*flagRenameMedias, "rename medias sequentially")
+		pass(*flagSubsetFonts, "subset embedded fonts (font tool %q)", *flagFontTool)
+		pass(renumber, "renumber relationships")
+		pass(minify, "minify xml parts")
+		pass(*flagMark, "mark as optimized")
+		fmt.Println("stream order:", *flagStreamOrder, "min version:", *flagMinVersion)
+		fmt.Println("memory budget:", *flagMemBudget, "decode cache:", *flagDecodeCache)
+		fmt.Println("media only:", *flagMediaOnly)
+		fmt.Println("skip marked:", *flagSkipMarked, "min file size:", *flagMinFileSize, "top medias:", *flagTopPct, "%")
+		fmt.Println("summary only:", *flagSummaryOnly)
+		fmt.Println("best effort:", *flagBestEffort, "fail on warning:", *flagFailOnWarn, "self-test:", *flagSelfTest, "no bloat:", *flagNoBloat)
+		fmt.Println("allow unsign:", *flagAllowUnsign)
+		if *flagGraph != "" {
+			fmt.Println("graph:", *flagGraph, "(dry run)")
+		}
+		fmt.Println("audit:", *flagAudit, "keep originals:", *flagKeepOriginals, "diff:", *flagDiff, "manifest:", *flagManifest)
+		if *flagInPlace {
+			fmt.Println("in place, staged in:", *flagTmpDir, "backups:", *flagBackup)
+		} else {
+			fmt.Println("overwrite existing output:", !*flagNoClobber || *flagForce)
+		}
+		return
+	}
 
 	if *flagVerbose {
 		log.SetLevel(log.DebugLevel)
+	} else if *flagSummaryOnly {
+		log.SetLevel(log.WarnLevel)
+	}
+	if *flagReportFormat != "" {
+		if err := checkReportFormat(*flagReportFormat); err != nil {
+			exitWith(exitUsage, err)
+		}
+	}
+	if *flagReportFile != "" && *flagReportFormat == "" {
+		exitWith(exitUsage, "-reportfile needs a -reportformat")
+	}
+	if *flagInlineLocal && !*flagInline {
+		exitWith(exitUsage, "-inlinelocal needs -inline")
+	}
+	if err := checkScaleFilter(strings.ToLower(*flagFilter)); err != nil {
+		exitWith(exitUsage, err)
+	}
+	if *flagTopPct < 1 || *flagTopPct > 100 {
+		exitWith(exitUsage, "invalid -toppct", *flagTopPct, ", expected 1 to 100")
+	}
+	if *flagSVGMode != "" {
+		if err := checkSVGMode(*flagSVGMode); err != nil {
+			exitWith(exitUsage, err)
+		}
+	}
+	warnings := &warningCounter{}
+	if *flagFailOnWarn || *flagReportFormat != "" {
+		log.AddHook(warnings)
 	}
 
+	if *flagInputFile == "" {
+		exitWith(exitUsage, "no input file given with -f")
+	}
 	oldinfo, err := os.Stat(*flagInputFile)
 	if err != nil {
-		log.Fatalln("cannot open input file:", err)
+		exitWith(exitInput, "cannot open input file:", err)
+	}
+	if oldinfo.Size() < *flagMinFileSize {
+		log.Infoln("skip", *flagInputFile, ", smaller than", *flagMinFileSize, "bytes")
+		if *flagSummaryOnly {
+			fmt.Printf("%s: skipped, smaller than %d bytes\n", *flagInputFile, *flagMinFileSize)
+		}
+		return
+	}
+
+	if *flagSkipMarked {
+		marked, err := IsFileMarkedOptimized(*flagInputFile)
+		if err != nil {
+			exitWith(exitInput, "cannot read input file:", err)
+		}
+		if marked {
+			log.Infoln("skip", *flagInputFile, ", already optimized")
+			if *flagSummaryOnly {
+				fmt.Printf("%s: skipped, already optimized\n", *flagInputFile)
+			}
+			return
+		}
+	}
+
+	tmpdir := *flagTmpDir
+	if *flagInPlace {
+		if tmpdir == "" {
+			tmpdir = filepath.Dir(*flagInputFile)
+		}
+		if err := checkTmpDir(tmpdir, filepath.Dir(*flagInputFile)); err != nil {
+			exitWith(exitUsage, err)
+		}
 	}
 
 	p := NewPowerpointDoc()
 	defer p.Close()
-	p.ParseFile(*flagInputFile)
+	p.SetBestEffort(*flagBestEffort)
+	p.SetRetries(*flagRetries, *flagRetryDelay)
+	p.SetNoClobber(*flagNoClobber && !*flagForce && !*flagInPlace)
+	p.SetMemoryBudget(*flagMemBudget)
+	p.SetDecodeCache(*flagDecodeCache)
+	p.SetStreamOrder(*flagStreamOrder)
+	p.SetManifest(*flagManifest)
+	p.SetAudit(*flagAudit)
+	p.SetKeepOriginals(*flagKeepOriginals)
+	p.SetMediaOnly(*flagMediaOnly)
+	if *flagMinVersion != "" {
+		version, err := ParseOfficeVersion(*flagMinVersion)
+		if err != nil {
+			exitWith(exitUsage, err)
+		}
+		p.SetMinVersion(version)
+	}
+	if *flagFormats != "" {
+		ff, err := os.Open(*flagFormats)
+		if err != nil {
+			exitWith(exitUsage, "cannot open formats file:", err)
+		}
+		formats, err := ParseMediaFormats(ff)
+		ff.Close()
+		if err != nil {
+			exitWith(exitUsage, "invalid formats file:", err)
+		}
+		p.SetMediaFormats(formats)
+	}
+	if err := p.ParseFile(*flagInputFile); err != nil {
+		exitWith(exitInput, "cannot parse input file:", err)
+	}
+	if *flagGraph != "" {
+		if keepLayouts != nil {
+			p.KeepLayouts(keepLayouts)
+		}
+		gf, err := os.Create(*flagGraph)
+		if err != nil {
+			exitWith(exitFailure, "cannot create graph file:", err)
+		}
+		defer gf.Close()
+		if err := p.WriteRemovalGraph(gf, cleanLayouts, cleanLayouts || *flagMediaOnly); err != nil {
+			exitWith(exitFailure, "cannot write graph file:", err)
+		}
+		return
+	}
+	if p.IsSigned() && !*flagAllowUnsign {
+		exitWith(exitInput, "input file is digitally signed, use -allowunsign to optimize it anyway and sign it again afterwards")
+	}
+	mediasBefore := len(p.MediaNames())
+	slideList := ""
+	if listed, parts := p.SlideCount(), p.SourceSlideParts(); listed != parts {
+		slideList = fmt.Sprintf("%d slides listed, %d slide parts", listed, parts)
+	}
+	var relsBefore RelationshipSnapshot
+	if *flagDiff {
+		relsBefore = p.Relationships()
+	}
+	if *flagTopPct < 100 {
+		p.SelectTopMedias(*flagTopPct)
+	}
 
-	if *flagConvertBitmaps || *flagAllOptimizations {
-		p.ConvertPictures()
+	if !*flagMediaOnly {
+		p.RepairSlideList()
+	}
+	// no pass removes slides, once the list is repaired
+	slides := p.SlideCount()
+	if *flagInline {
+		p.InlineExternalImages(*flagInlineTimeout, *flagInlineMaxSize, *flagInlineLocal)
+	}
+	if *flagSVGMode != "" {
+		p.DropSVGAlternates(*flagSVGMode)
+	}
+	if convert {
+		p.ConvertPictures(*flagFixExtensions, *flagTiffTool)
+	}
+	if fixTypes {
+		p.FixContentTypes()
+	}
+	if *flagFormats != "" {
+		p.ConvertMediaFormats()
+	}
+	if flatten {
+		p.FlattenOpaquePNGs()
+	}
+	if *flagCMYK {
+		p.ConvertCMYKJPEGs()
 	}
-	if *flagCleanLayouts || *flagAllOptimizations {
+	if *flag8Bit {
+		p.ReducePNGBitDepth(*flagDither)
+	}
+	if *flagStripICC {
+		p.StripICCProfiles()
+	}
+	if *flagDPI > 0 {
+		p.DownscaleImages(*flagDPI, *flagFilter)
+	}
+	if *flagProgressive {
+		p.ConvertProgressiveJPEGs(*flagJPEGTool)
+	}
+	if recompress {
+		p.RecompressPNGs(*flagPNGTool)
+	}
+	if svg {
+		p.MinifySVGs()
+	}
+	dedupedMedias := uint64(0)
+	if dedupMedias {
+		dedupedMedias = p.DeduplicateMedias()
+	}
+	dedupedEmbeddings := 0
+	if dedupEmbeddings {
+		dedupedEmbeddings = p.DeduplicateEmbeddings()
+	}
+	if *flagDeep {
+		p.OptimizeEmbeddings(func(e *PowerpointDoc) {
+			if flatten {
+				e.FlattenOpaquePNGs()
+			}
+			if *flagCMYK {
+				e.ConvertCMYKJPEGs()
+			}
+			if *flag8Bit {
+				e.ReducePNGBitDepth(*flagDither)
+			}
+			if *flagStripICC {
+				e.StripICCProfiles()
+			}
+			if *flagProgressive {
+				e.ConvertProgressiveJPEGs(*flagJPEGTool)
+			}
+			if recompress {
+				e.RecompressPNGs(*flagPNGTool)
+			}
+		})
+	}
+	if keepLayouts != nil {
+		p.KeepLayouts(keepLayouts)
+	}
+	if *flagRemoveNotes {
+		p.RemoveNotes()
+	}
+	if *flagNoTransitionSounds {
+		p.RemoveTransitionSounds()
+	}
+	removedCustomXML := []string{}
+	if *flagNoCustomXML {
+		removedCustomXML = append(removedCustomXML, p.RemoveUnusedCustomXML()...)
+	}
+	if cleanLayouts {
 		p.RemoveUnusedLayouts()
 		p.RemoveUnusedMasters()
+		p.RemoveUnusedThemes()
 		p.RemoveUnusedMedias()
+	} else if *flagMediaOnly {
+		p.RemoveUnusedMedias()
+	}
+	if cleanLayouts || *flagRemoveNotes {
+		p.UpdateAppProperties()
+	}
+	if *flagSubsetFonts {
+		p.SubsetFonts(*flagFontTool)
+	}
+	if *flagRenameMedias {
+		p.RenameMediaSequential()
+	}
+	if renumber {
+		p.RenumberRelationships()
+	}
+	if minify {
+		p.MinifyXML()
+	}
+	if *flagMark {
+		p.MarkOptimized()
+	}
+	p.CheckCompatibility()
+	if err := p.Err(); err != nil {
+		p.Close()
+		exitWith(errorExitCode(err), err, ", no output written, use -besteffort to skip what cannot be read")
 	}
 
-	outputFileName := strings.Replace(*flagInputFile, filepath.Ext(*flagInputFile), ".new.pptx", 1)
-	p.SaveFile(outputFileName)
+	if *flagInPlace {
+		tmpFileName := createTmpOutput(tmpdir)
+		if err := p.SaveFile(tmpFileName); err != nil {
+			os.Remove(tmpFileName)
+			exitWith(errorExitCode(err), "cannot write output file:", err, ", input file left untouched")
+		}
+		p.Close() // release the input file before replacing it
+		if *flagSelfTest {
+			if err := selfTestFile(tmpFileName, slides); err != nil {
+				os.Remove(tmpFileName)
+				exitWith(exitValidation, err, ", input file left untouched")
+			}
+		}
+		if *flagNoBloat {
+			if bloat := checkSavings(tmpFileName, oldinfo.Size()); bloat != nil {
+				os.Remove(tmpFileName)
+				exitWith(exitNoSavings, bloat, ", input file left untouched")
+			}
+		}
+		moved := false
+		if *flagBackup > 0 {
+			if moved, err = backupFile(*flagInputFile, *flagBackup); err != nil {
+				os.Remove(tmpFileName)
+				exitWith(exitFailure, "cannot back up input file:", err)
+			}
+			log.Infoln("backed up", *flagInputFile, "as", backupName(*flagInputFile, 0))
+		}
+		err := retry(*flagRetries, *flagRetryDelay, "replace "+*flagInputFile, func() error {
+			return os.Rename(tmpFileName, *flagInputFile)
+		})
+		if err != nil {
+			os.Remove(tmpFileName)
+			if moved {
+				os.Rename(backupName(*flagInputFile, 0), *flagInputFile)
+			}
+			exitWith(exitFailure, "cannot replace input file:", err)
+		}
+	} else {
+		if err := p.SaveFile(outputFileName); errors.Is(err, os.ErrExist) {
+			exitWith(exitUsage, "output file", outputFileName, "already exists, use -force to overwrite it")
+		} else if err != nil {
+			os.Remove(outputFileName)
+			exitWith(errorExitCode(err), "cannot write output file:", err)
+		}
+		if *flagSelfTest {
+			if err := selfTestFile(outputFileName, slides); err != nil {
+				os.Remove(outputFileName)
+				exitWith(exitValidation, err, ", no output written")
+			}
+		}
+		if *flagNoBloat {
+			if bloat := checkSavings(outputFileName, oldinfo.Size()); bloat != nil {
+				os.Remove(outputFileName)
+				exitWith(exitNoSavings, bloat, ", no output written")
+			}
+		}
+	}
+
+	if *flagDiff {
+		p.ReportRelationshipChanges(relsBefore)
+	}
+
+	if *flagManifest {
+		if err := p.SaveManifest(outputFileName+".manifest.json", filepath.Base(outputFileName)); err != nil {
+			exitWith(exitFailure, "cannot write manifest:", err)
+		}
+	}
 
 	newinfo, err := os.Stat(outputFileName)
 	if err != nil {
-		log.Fatal(err)
+		exitWith(exitFailure, "cannot read output file:", err)
 	}
 
+	if skipped := p.SkippedTiffs(); len(skipped) > 0 {
+		log.Warnln(len(skipped), "tiff pictures could not be converted:", strings.Join(skipped, ", "))
+	}
 	log.Infoln("size", *flagInputFile, oldinfo.Size(), outputFileName, newinfo.Size())
+	if *flagSummaryOnly {
+		fmt.Println(summaryLine(*flagInputFile, oldinfo.Size(), newinfo.Size()))
+	}
+
+	if *flagReportFormat != "" {
+		report := Report{Input: *flagInputFile, Output: outputFileName, SizeBefore: oldinfo.Size(), SizeAfter: newinfo.Size(),
+			Slides: p.SlideCount(), MediasBefore: mediasBefore, MediasAfter: len(p.MediaNames()),
+			SkippedTiffs: append([]string{}, p.SkippedTiffs()...), Problems: []string{}, Warnings: warnings.Count(),
+			DedupedMedias: dedupedMedias, DedupedEmbeddings: dedupedEmbeddings, RemovedCustomXML: removedCustomXML, SlideListMismatch: slideList}
+		for _, err := range p.Problems() {
+			report.Problems = append(report.Problems, err.Error())
+		}
+		if err := writeReport(report, *flagReportFile, *flagReportFormat); err != nil {
+			exitWith(exitFailure, "cannot write report:", err)
+		}
+	}
+
+	if problems := p.Problems(); len(problems) > 0 {
+		for _, err := range problems {
+			log.Errorln(err)
+		}
+		p.Close()
+		exitWith(errorExitCode(problems[0]), len(problems), "problems occurred")
+	}
+	if n := warnings.Count(); *flagFailOnWarn && n > 0 {
+		p.Close()
+		exitWith(exitValidation, n, "warnings occurred")
+	}
 }
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"io/ioutil"
+)
+
+type ManifestEntry struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type manifestWriter struct {
+	w     io.Writer
+	size  int64
+	hash  hash.Hash
+	entry *ManifestEntry
+}
+
+func (m *manifestWriter) Write(b []byte) (int, error) {
+	n, err := m.w.Write(b)
+	m.size += int64(n)
+	m.hash.Write(b[:n])
+	return n, err
+}
+
+func (m *manifestWriter) finish() {
+	m.entry.Size = m.size
+	m.entry.SHA256 = hex.EncodeToString(m.hash.Sum(nil))
+}
+
+// packageWriter is a zip writer which optionally hashes every entry as it is written
+type packageWriter struct {
+	*zip.Writer
+	manifest bool
+	current  *manifestWriter
+	entries  []*ManifestEntry
+	names    []string
+	stage    bool
+	staged   []*stagedEntry
+
+	// source archive, whose unchanged entries are copied without compressing them again
+	source    map[string]*zip.File
+	sourceAt  io.ReaderAt
+	raw       io.Reader // compressed data of the entry being copied
+	rawCopies int
+}
+
+func newPackageWriter(w io.Writer, manifest bool) *packageWriter {
+	return &packageWriter{Writer: zip.NewWriter(w), manifest: manifest}
+}
+
+func (pw *packageWriter) finishEntry() {
+	if pw.current != nil {
+		pw.current.finish()
+		pw.current = nil
+	}
+}
+
+func (pw *packageWriter) Create(name string) (io.Writer, error) {
+	pw.finishEntry()
+	var w io.Writer
+	var err error
+	if pw.stage {
+		w = pw.stageEntry(name)
+	} else {
+		w, err = pw.Writer.Create(name)
+	}
+	if err == nil {
+		pw.names = append(pw.names, name)
+	}
+	if err != nil || !pw.manifest {
+		return w, err
+	}
+	entry := &ManifestEntry{Name: name}
+	pw.entries = append(pw.entries, entry)
+	pw.current = &manifestWriter{w: w, hash: sha256.New(), entry: entry}
+	return pw.current, nil
+}
+
+func (pw *packageWriter) Close() error {
+	pw.finishEntry()
+	if pw.stage {
+		if err := pw.flushStaged(); err != nil {
+			return err
+		}
+	}
+	return pw.Writer.Close()
+}
+
+func (pw *packageWriter) Names() []string {
+	return pw.names
+}
+
+func (pw *packageWriter) Manifest() []ManifestEntry {
+	pw.finishEntry()
+	manifest := make([]ManifestEntry, len(pw.entries))
+	for i, e := range pw.entries {
+		manifest[i] = *e
+	}
+	return manifest
+}
+
+func (p *PowerpointDoc) SetManifest(manifest bool) {
+	p.manifestEnabled = manifest
+}
+
+func (p *PowerpointDoc) Manifest() []ManifestEntry {
+	return p.manifest
+}
+
+func (p *PowerpointDoc) SaveManifest(f string, pptxfile string) error {
+	out, err := json.MarshalIndent(struct {
+		File  string          `json:"file"`
+		Parts []ManifestEntry `json:"parts"`
+	}{pptxfile, p.manifest}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(f, out, 0644)
+}
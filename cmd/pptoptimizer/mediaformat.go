@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultJPEGQuality = 90
+
+// MediaFormat is the format requested for a specific media: keep (left untouched by all optimizations), png or jpeg
+type MediaFormat struct {
+	Format  string
+	Quality int // jpeg quality, 0 for the default
+}
+
+// ParseMediaFormats reads lines of media base name, format and optional jpeg quality, such as
+// "image7.png jpeg 70", "image3.png keep" or "image2.jpeg png". Empty lines and lines starting with # are ignored.
+func ParseMediaFormats(r io.Reader) (map[string]MediaFormat, error) {
+	formats := make(map[string]MediaFormat)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("line %d: expected media name, format and optional quality", n)
+		}
+		f := MediaFormat{Format: strings.ToLower(fields[1])}
+		if f.Format == "jpg" {
+			f.Format = "jpeg"
+		}
+		if f.Format != "keep" && f.Format != "png" && f.Format != "jpeg" {
+			return nil, fmt.Errorf("line %d: unknown format %s, expected keep, png or jpeg", n, fields[1])
+		}
+		if len(fields) == 3 {
+			q, err := strconv.Atoi(fields[2])
+			if err != nil || q < 1 || q > 100 || f.Format != "jpeg" {
+				return nil, fmt.Errorf("line %d: invalid quality %s, expected 1 to 100 for jpeg", n, fields[2])
+			}
+			f.Quality = q
+		}
+		formats[fields[0]] = f
+	}
+	return formats, scanner.Err()
+}
+
+func (p *PowerpointDoc) SetMediaFormats(formats map[string]MediaFormat) {
+	p.mediaFormats = formats
+}
+
+func (p *PowerpointDoc) mediaFormat(name string) (MediaFormat, bool) {
+	if f, ok := p.convertedFormats[name]; ok {
+		return f, ok
+	}
+	f, ok := p.mediaFormats[path.Base(name)]
+	return f, ok
+}
+
+// isKeptByFormat tells whether -formats lists a media as kept
+func (p *PowerpointDoc) isKeptByFormat(name string) bool {
+	f, ok := p.mediaFormat(name)
+	return ok && f.Format == "keep"
+}
+
+// isMediaKept tells whether a media must be left untouched by optimizations, kept by -formats or too small for -toppct
+func (p *PowerpointDoc) isMediaKept(name string) bool {
+	return p.isKeptByFormat(name) || p.inMediaTail(name)
+}
+
+func (p *PowerpointDoc) jpegQuality(name string) int {
+	if f, ok := p.mediaFormat(name); ok && f.Quality > 0 {
+		return f.Quality
+	}
+	return defaultJPEGQuality
+}
+
+// flattenOnWhite removes transparency, which jpeg does not support
+func flattenOnWhite(img image.Image) image.Image {
+	dst := image.NewRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Over)
+	return dst
+}
+
+// ConvertMediaFormats converts the medias to the formats set with SetMediaFormats.
+// Medias already in the requested format are re-encoded only when it makes them smaller.
+func (p *PowerpointDoc) ConvertMediaFormats() {
+	for _, name := range p.MediaNames() {
+		f, ok := p.mediaFormat(name)
+		if !ok || f.Format == "keep" {
+			continue
+		}
+		format, err := p.SniffMedia(name)
+		if err != nil {
+			p.Problem(err)
+			continue
+		}
+		if format == "" {
+			log.Warnln("cannot convert", name, "to", f.Format, ": not a picture")
+			continue
+		}
+		if !p.formatSupported(name, f.Format) {
+			continue
+		}
+		data, err := p.ReadMedia(name)
+		if err != nil {
+			p.Problem(err)
+			continue
+		}
+		img, err := p.decodeMedia(name, format, data)
+		if err != nil {
+			p.mediaDecodeFailed(name, err)
+			continue
+		}
+		if f.Format == "jpeg" {
+			img = flattenOnWhite(img)
+		}
+		out, err := encodeImage(img, f.Format, p.jpegQuality(name))
+		if err != nil {
+			log.Warnln("cannot encode", name, ":", err)
+			continue
+		}
+
+		if format == f.Format {
+			if len(out) >= len(data) {
+				log.Debugln("re-encoded", name, "is not smaller, keep original")
+				continue
+			}
+			log.Infoln("re-encoded", name, len(data), "->", len(out))
+			p.ReplaceMedia(name, out, "re-encoded as "+f.Format)
+			continue
+		}
+		newname := replaceExtension(name, f.Format)
+		if _, ok := p.medias[newname]; ok && newname != name {
+			newname = p.newMediaName(f.Format)
+		}
+		p.contentTypes.RemoveOverride(name)
+		p.contentTypes.AddDefault(f.Format, imageContentTypes[f.Format])
+		log.Infoln("converted", name, len(data), "to", newname, len(out))
+		p.auditMedia(name, newname, "converted from "+format+" to "+f.Format)
+		p.RenameMedia(name, newname, p.newMedia(out))
+		// the requested format follows the media, and only this one
+		p.convertedFormats[newname] = f
+	}
+}
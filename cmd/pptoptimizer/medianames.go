@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// sequentialMediaName returns the name PowerPoint would give to the n-th media of a kind, image or media
+func sequentialMediaName(kind string, n int, ext string) string {
+	if ext == "" {
+		return fmt.Sprintf("ppt/media/%s%d", kind, n)
+	}
+	return fmt.Sprintf("ppt/media/%s%d.%s", kind, n, ext)
+}
+
+// mediasInUseOrder returns the medias in the order the slides, layouts, masters and other parts reference them,
+// followed by those no part references
+func (p *PowerpointDoc) mediasInUseOrder() []string {
+	names := make([]string, 0, len(p.medias))
+	seen := make(map[string]bool, len(p.medias))
+	add := func(name string) {
+		if _, ok := p.medias[name]; ok && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	p.forEachPartRels(func(source string, rels *Relationships) {
+		for _, rel := range rels.Relationship {
+			if rel.TargetMode != "External" {
+				add(resolveTarget(source, rel.Target))
+			}
+		}
+	})
+	for _, name := range p.MediaNames() {
+		add(name)
+	}
+	return names
+}
+
+// RenameMediaSequential renames the medias to image1..imageN for pictures and media1..mediaN for audio and video,
+// in the order of the slides using them, with the extension of their actual format, and retargets all relationships.
+// The medias referenced by rels copied verbatim, or left untouched by -formats, keep their name.
+func (p *PowerpointDoc) RenameMediaSequential() {
+	parsed := func(source string) bool {
+		return source == "" || isParsedRels(relsPartName(source))
+	}
+	verbatim := p.referencedParts(parsed)
+
+	type rename struct {
+		old, tmp, new string
+		contentType   string
+	}
+	renames := []rename{}
+	// by name without extension, so that image1.png and image1.jpeg are not both taken
+	reserved := make(map[string]bool)
+	stem := func(name string) string {
+		return strings.TrimSuffix(name, path.Ext(name))
+	}
+	for _, name := range p.MediaNames() {
+		if verbatim[name] || p.isKeptByFormat(name) {
+			reserved[stem(name)] = true
+		}
+	}
+	counts := map[string]int{}
+	for _, name := range p.mediasInUseOrder() {
+		if verbatim[name] || p.isKeptByFormat(name) {
+			log.Debugln("keep name of", name)
+			continue
+		}
+		contentType := p.contentTypes.ContentTypeOf(name)
+		ext := strings.ToLower(strings.TrimPrefix(path.Ext(name), "."))
+		format, err := p.SniffMedia(name)
+		if err != nil {
+			// a media left out could keep a name another one takes
+			p.Problem(err)
+			return
+		}
+		if format != "" {
+			ext, contentType = format, imageContentTypes[format]
+		}
+		kind := "media"
+		if imageContentTypes[ext] != "" || strings.HasPrefix(contentType, "image/") {
+			kind = "image"
+		}
+		newname := ""
+		for newname == "" || reserved[stem(newname)] {
+			counts[kind]++
+			newname = sequentialMediaName(kind, counts[kind], ext)
+		}
+		reserved[stem(newname)] = true
+		if newname != name || contentType != p.contentTypes.ContentTypeOf(name) {
+			renames = append(renames, rename{old: name, new: newname, contentType: contentType})
+		}
+	}
+	if len(renames) == 0 {
+		return
+	}
+
+	// medias still read from the input file by their name are loaded first, none is renamed if one cannot be read
+	for _, r := range renames {
+		if m := p.medias[r.old]; m.data == nil && m.file == "" {
+			data, err := p.ReadMedia(r.old)
+			if err != nil {
+				p.Problem(err)
+				return
+			}
+			p.medias[r.old] = p.newMedia(data)
+		}
+	}
+
+	// through temporary names, since a media may take the name another one is leaving
+	for i, r := range renames {
+		renames[i].tmp = fmt.Sprintf("ppt/media/pptoptimizer-rename%d", i)
+		log.Infoln("rename media", r.old, "as", r.new)
+		p.contentTypes.RemoveOverride(r.old)
+		p.decoded.remove(r.old)
+		p.auditMedia(r.old, renames[i].tmp, "renamed to "+path.Base(r.new))
+		p.RenameMedia(r.old, renames[i].tmp, p.medias[r.old])
+	}
+	for _, r := range renames {
+		if entry, ok := p.audit[r.tmp]; ok {
+			delete(p.audit, r.tmp)
+			p.audit[r.new] = entry
+		}
+		p.RenameMedia(r.tmp, r.new, p.medias[r.tmp])
+		if ext := strings.TrimPrefix(path.Ext(r.new), "."); ext != "" && r.contentType != "" {
+			p.contentTypes.AddDefault(ext, r.contentType)
+		}
+		if r.contentType != "" && p.contentTypes.ContentTypeOf(r.new) != r.contentType {
+			p.contentTypes.Override = append(p.contentTypes.Override, TypeOverride{PartName: "/" + r.new, ContentType: r.contentType})
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/beevik/etree"
+)
+
+func TestSequentialMediaName(t *testing.T) {
+	tests := []struct {
+		kind string
+		n    int
+		ext  string
+		want string
+	}{
+		{"image", 1, "png", "ppt/media/image1.png"},
+		{"image", 12, "jpeg", "ppt/media/image12.jpeg"},
+		{"media", 3, "mp4", "ppt/media/media3.mp4"},
+		{"media", 2, "", "ppt/media/media2"},
+	}
+	for _, tt := range tests {
+		if got := sequentialMediaName(tt.kind, tt.n, tt.ext); got != tt.want {
+			t.Errorf("sequentialMediaName(%s, %d, %s) = %s, want %s", tt.kind, tt.n, tt.ext, got, tt.want)
+		}
+	}
+}
+
+// referencedContents returns the content of the part targeted by each relationship attribute of the xml parts,
+// by part name and position of the attribute
+func referencedContents(t *testing.T, parts map[string][]byte) map[string][]byte {
+	t.Helper()
+	contents := make(map[string][]byte)
+	for name, data := range parts {
+		if path.Ext(name) != ".xml" || parts[relsPartName(name)] == nil {
+			continue
+		}
+		rels := Relationships{}
+		if err := xml.Unmarshal(parts[relsPartName(name)], &rels); err != nil {
+			t.Fatal(err)
+		}
+		doc := etree.NewDocument()
+		if err := doc.ReadFromBytes(data); err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for _, e := range doc.FindElements("//*") {
+			for _, a := range e.Attr {
+				if a.Space != "r" {
+					continue
+				}
+				n++
+				for _, rel := range rels.Relationship {
+					if rel.Id == a.Value && rel.TargetMode != "External" {
+						contents[name+"#"+strconv.Itoa(n)] = parts[resolveTarget(name, rel.Target)]
+						break
+					}
+				}
+			}
+		}
+	}
+	return contents
+}
+
+func TestRenameMediaSequential(t *testing.T) {
+	d := newTestDeck(2)
+	photo := testPNG(30, 20)
+	d.image("ppt/slides/slide2.xml", "ppt/media/image9.png", photo)
+	d.image("ppt/slides/slide1.xml", "ppt/media/image5.png", testPNG(20, 30))
+	// a duplicate, removed by DeduplicateMedias
+	d.image("ppt/slides/slide1.xml", "ppt/media/image7.png", photo)
+	// a png with a wrong name and a content type override
+	d.image("ppt/slides/slide1.xml", "ppt/media/picture.dat", testPNG(10, 10))
+	d.types.Override = append(d.types.Override, TypeOverride{PartName: "/ppt/media/picture.dat", ContentType: "image/png"})
+	// an audio file, through both the audio and media relationships
+	d.addBytes("ppt/media/sound.wav", "audio/wav", []byte("RIFF\x00\x00\x00\x00WAVEfmt "))
+	audio := d.rel("ppt/slides/slide1.xml", "audio", "../media/sound.wav")
+	d.rels["ppt/slides/slide1.xml"] = append(d.rels["ppt/slides/slide1.xml"], Relationship{Id: "rId99", Type: mediaRelType, Target: "../media/sound.wav"})
+	d.shapes["ppt/slides/slide1.xml"] = append(d.shapes["ppt/slides/slide1.xml"],
+		`<p:pic><p:nvPicPr><p:cNvPr id="9" name="Sound"/><p:cNvPicPr/><p:nvPr><a:audioFile r:link="`+audio+`"/></p:nvPr></p:nvPicPr><p:blipFill/><p:spPr/></p:pic>`)
+	// a chart, whose relationships are parsed and retargeted
+	d.add("ppt/charts/chart1.xml", relationshipContentTypes["chart"], `<c:chartSpace xmlns:c="http://schemas.openxmlformats.org/drawingml/2006/chart" `+testNamespaces+`>`+
+		`<c:spPr><a:blipFill><a:blip r:embed="rId1"/></a:blipFill></c:spPr><c:chart r:id="rId2"/></c:chartSpace>`)
+	d.rel("ppt/charts/chart1.xml", "image", "../media/image4.png")
+	d.rel("ppt/charts/chart1.xml", "image", "/ppt/media/image9.png")
+	d.addBytes("ppt/media/image4.png", "", testPNG(12, 14))
+	d.rel("ppt/slides/slide2.xml", "chart", "../charts/chart1.xml")
+	// notes, whose relationships are copied verbatim, so their media keeps its name
+	d.add("ppt/notesSlides/notesSlide1.xml", relationshipContentTypes["notesSlide"], `<p:notes `+testNamespaces+`><p:cSld><p:spTree>{shapes}</p:spTree></p:cSld></p:notes>`)
+	d.rel("ppt/notesSlides/notesSlide1.xml", "slide", "../slides/slide2.xml")
+	d.image("ppt/notesSlides/notesSlide1.xml", "ppt/media/image1.png", testPNG(16, 16))
+	d.rel("ppt/slides/slide2.xml", "notesSlide", "../notesSlides/notesSlide1.xml")
+
+	p := d.parse(t)
+	p.SetMediaFormats(map[string]MediaFormat{"image5.png": {Format: "jpeg"}})
+	p.ConvertMediaFormats()
+	p.DeduplicateMedias()
+	before, err := p.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer before.Close()
+	_, beforeParts := saveTestFile(t, before)
+
+	p.RenameMediaSequential()
+	out, after := saveTestFile(t, p)
+
+	assertReferencesResolve(t, after)
+	if err := selfTestFile(out, 2); err != nil {
+		t.Error(err)
+	}
+	want, got := referencedContents(t, beforeParts), referencedContents(t, after)
+	for ref, data := range want {
+		if !bytes.Equal(got[ref], data) {
+			t.Errorf("%s references other content after renaming", ref)
+		}
+	}
+
+	medias := []string{}
+	for name := range after {
+		if strings.HasPrefix(name, "ppt/media/") {
+			medias = append(medias, name)
+		}
+	}
+	sort.Strings(medias)
+	reName := regexp.MustCompile(`^ppt/media/(image|media)([0-9]+)\.([a-z]+)$`)
+	numbers := map[string][]bool{"image": make([]bool, len(medias)+1), "media": make([]bool, len(medias)+1)}
+	for _, name := range medias {
+		m := reName.FindStringSubmatch(name)
+		if m == nil {
+			t.Errorf("media %s not renamed", name)
+			continue
+		}
+		n, _ := strconv.Atoi(m[2])
+		if numbers[m[1]][n] {
+			t.Errorf("%s%d is used twice in %v", m[1], n, medias)
+		}
+		numbers[m[1]][n] = true
+	}
+	for kind, used := range numbers {
+		for n := 1; n < len(used); n++ {
+			if !used[n] && n < len(used)-1 && used[n+1] {
+				t.Errorf("%s%d is missing in %v", kind, n, medias)
+			}
+		}
+	}
+	if len(medias) != 6 {
+		t.Errorf("medias %v, want 6 after removing the duplicate", medias)
+	}
+	if after["ppt/media/image1.png"] == nil {
+		t.Errorf("media of the notes renamed, medias %v", medias)
+	}
+	if after["ppt/media/media1.wav"] == nil {
+		t.Errorf("audio not renamed media1.wav, medias %v", medias)
+	}
+
+	types := Types{}
+	if err := xml.Unmarshal(after["[Content_Types].xml"], &types); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range medias {
+		want := map[string]string{".png": "image/png", ".jpeg": "image/jpeg", ".wav": "audio/wav"}[path.Ext(name)]
+		if got := types.ContentTypeOf(name); got != want {
+			t.Errorf("content type of %s is %q, want %q", name, got, want)
+		}
+	}
+	for _, o := range types.Override {
+		if after[strings.TrimPrefix(o.PartName, "/")] == nil {
+			t.Errorf("content type override of the missing part %s", o.PartName)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/beevik/etree"
+	log "github.com/sirupsen/logrus"
+)
+
+// preservesSpace tells whether the whitespace of an element is significant: text runs, or xml:space="preserve"
+func preservesSpace(e *etree.Element) bool {
+	return e.Tag == "t" || e.SelectAttrValue("xml:space", "") == "preserve"
+}
+
+// minifyElement removes the whitespace-only text between child elements, like etree's Indent(etree.NoIndent),
+// which would also drop the significant spaces of text runs such as <a:t> </a:t>
+func minifyElement(e *etree.Element) {
+	if preservesSpace(e) {
+		return
+	}
+	if len(e.ChildElements()) > 0 {
+		for _, c := range e.Child {
+			if cd, ok := c.(*etree.CharData); ok && cd.IsWhitespace() {
+				e.RemoveChild(cd)
+			}
+		}
+	}
+	for _, c := range e.ChildElements() {
+		minifyElement(c)
+	}
+}
+
+// minifyDocument strips the insignificant whitespace of a document, and returns the number of bytes saved
+func minifyDocument(doc *etree.Document) int {
+	before, _ := doc.WriteToBytes()
+	for _, c := range doc.Child {
+		if cd, ok := c.(*etree.CharData); ok && cd.IsWhitespace() {
+			doc.RemoveChild(cd)
+		}
+	}
+	minifyElement(doc.Root())
+	after, _ := doc.WriteToBytes()
+	return len(before) - len(after)
+}
+
+// MinifyXML strips the insignificant whitespace and indentation of the presentation, slide masters
+// and other xml parts under ppt/, which are then rewritten on save
+func (p *PowerpointDoc) MinifyXML() {
+	if p.xmlLocked("xml minification") {
+		return
+	}
+	saved := minifyDocument(p.presentation)
+	p.presentationEdit = p.presentationEdit || saved > 0
+	for i, sm := range p.slideMasters {
+		if sm != nil && !p.IsMasterRemoved(i) {
+			saved += minifyDocument(sm)
+		}
+	}
+	for _, f := range p.sourceFileReader.File {
+		if !strings.HasPrefix(f.Name, "ppt/") || !strings.HasSuffix(f.Name, ".xml") ||
+			f.Name == "ppt/presentation.xml" || strings.HasPrefix(f.Name, "ppt/slideMasters/") {
+			continue
+		}
+		if _, ok := p.replacedParts[f.Name]; ok || p.removedParts[f.Name] {
+			continue
+		}
+		if n, err := getObjectNumberFromFilename(f.Name); err == nil &&
+			((strings.HasPrefix(f.Name, "ppt/slides/") && p.IsSlideRemoved(n-1)) ||
+				(strings.HasPrefix(f.Name, "ppt/slideLayouts/") && p.IsLayoutRemoved(n-1))) {
+			continue
+		}
+		n := minifyDocument(p.LoadPart(f.Name))
+		log.Debugln("minified", f.Name, "saved", n, "bytes")
+		saved += n
+	}
+	log.Infoln("minified xml parts, saved", saved, "bytes")
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+// RemoveNotes removes the speaker notes of all slides, and the notes master with its theme when no other
+// part uses it. p:notesSz is kept, the presentation schema requires it.
+func (p *PowerpointDoc) RemoveNotes() {
+	if p.xmlLocked("remove notes") {
+		return
+	}
+	for i := range p.slideRels {
+		if p.IsSlideRemoved(i) {
+			continue
+		}
+		rels := p.slideRels[i].Relationship[:0]
+		for _, rel := range p.slideRels[i].Relationship {
+			if rel.Is("notesSlide") && rel.TargetMode != "External" {
+				target := resolveTarget(partName("slide", i), rel.Target)
+				log.Infoln("remove notes", target)
+				p.removedParts[target] = true
+				p.contentTypes.RemoveOverride(target)
+				delete(p.parts, target)
+				continue
+			}
+			rels = append(rels, rel)
+		}
+		p.slideRels[i].Relationship = rels
+	}
+
+	themes := []string{}
+	rels := p.presentationRels.Relationship[:0]
+	for _, rel := range p.presentationRels.Relationship {
+		if !rel.Is("notesMaster") || rel.TargetMode == "External" {
+			rels = append(rels, rel)
+			continue
+		}
+		target := resolveTarget("ppt/presentation.xml", rel.Target)
+		log.Infoln("remove notes master", target)
+		for _, mrel := range p.otherRels[target].Relationship {
+			if mrel.Is("theme") && mrel.TargetMode != "External" {
+				themes = append(themes, resolveTarget(target, mrel.Target))
+			}
+		}
+		p.removedParts[target] = true
+		p.contentTypes.RemoveOverride(target)
+		delete(p.otherRels, target) // its medias become unused
+		delete(p.parts, target)
+	}
+	p.presentationRels.Relationship = rels
+	for _, e := range p.presentation.FindElements("//p:notesMasterIdLst") {
+		e.Parent().RemoveChild(e)
+		p.presentationEdit = true
+	}
+
+	used := p.FindUsedThemes()
+	for _, theme := range themes {
+		if used[theme] == 0 && !p.removedParts[theme] {
+			log.Infoln("remove theme", theme, "of notes master")
+			p.removeTheme(theme)
+		}
+	}
+}
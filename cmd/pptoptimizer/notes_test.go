@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"testing"
+)
+
+// notes adds a notes master using a theme, and notes to each slide
+func (d *testDeck) notes(slides int, theme string) {
+	master := "ppt/notesMasters/notesMaster1.xml"
+	d.add(master, relationshipContentTypes["notesMaster"], `<p:notesMaster `+testNamespaces+`><p:cSld><p:spTree>{shapes}</p:spTree></p:cSld></p:notesMaster>`)
+	d.rel(master, "theme", "../theme/"+path.Base(theme))
+	d.image(master, "ppt/media/notes-logo.png", testPNG(6, 6))
+	id := d.rel("ppt/presentation.xml", "notesMaster", "notesMasters/notesMaster1.xml")
+	d.parts["ppt/presentation.xml"] = []byte(strings.Replace(string(d.parts["ppt/presentation.xml"]), "</p:sldMasterIdLst>",
+		`</p:sldMasterIdLst><p:notesMasterIdLst><p:notesMasterId r:id="`+id+`"/></p:notesMasterIdLst>`, 1))
+	for i := 1; i <= slides; i++ {
+		name := fmt.Sprintf("ppt/notesSlides/notesSlide%d.xml", i)
+		d.add(name, relationshipContentTypes["notesSlide"], `<p:notes `+testNamespaces+`><p:cSld><p:spTree>{shapes}</p:spTree></p:cSld></p:notes>`)
+		d.rel(name, "notesMaster", "../notesMasters/notesMaster1.xml")
+		d.rel(name, "slide", fmt.Sprintf("../slides/slide%d.xml", i))
+		d.rel(fmt.Sprintf("ppt/slides/slide%d.xml", i), "notesSlide", "../notesSlides/"+path.Base(name))
+	}
+}
+
+func TestRemoveNotes(t *testing.T) {
+	tests := []struct {
+		theme string
+		kept  bool
+	}{
+		{"ppt/theme/theme2.xml", false},
+		{"ppt/theme/theme1.xml", true}, // shared with the slide master
+	}
+	for _, tt := range tests {
+		t.Run(tt.theme, func(t *testing.T) {
+			d := newTestDeck(2)
+			if tt.theme != "ppt/theme/theme1.xml" {
+				d.add(tt.theme, relationshipContentTypes["theme"], `<a:theme `+testNamespaces+` name="Notes"/>`)
+			}
+			d.notes(2, tt.theme)
+			p := d.parse(t)
+			p.RemoveNotes()
+			p.RemoveUnusedMedias()
+			_, parts := saveTestFile(t, p)
+
+			assertReferencesResolve(t, parts)
+			for name := range parts {
+				if strings.HasPrefix(name, "ppt/notes") || name == "ppt/media/notes-logo.png" {
+					t.Errorf("%s kept", name)
+				}
+			}
+			if got := parts[tt.theme] != nil; got != tt.kept {
+				t.Errorf("%s in output: %v, want %v", tt.theme, got, tt.kept)
+			}
+			if parts["ppt/theme/theme1.xml"] == nil {
+				t.Error("theme of the slide master removed")
+			}
+			for name, data := range parts {
+				if strings.Contains(string(data), "notesMaster") || strings.Contains(string(data), "notesSlide") {
+					t.Errorf("%s still refers to the notes:\n%s", name, data)
+				}
+			}
+			if !strings.Contains(string(parts["ppt/presentation.xml"]), "p:notesSz") {
+				t.Error("p:notesSz removed from the presentation")
+			}
+		})
+	}
+}
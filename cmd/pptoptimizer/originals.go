@@ -0,0 +1,90 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const originalsPartName = "pptoptimizer/originals.xml"
+const originalsDir = "pptoptimizer/originals/"
+const originalsContentType = "application/vnd.pptoptimizer.originals+xml"
+const originalsRelationshipType = "https://github.com/gillesgagniard/pptoptimizer/relationships/originals"
+const originalRelationshipType = "https://github.com/gillesgagniard/pptoptimizer/relationships/original"
+
+type OriginalMedia struct {
+	Name     string `xml:"name,attr"`     // media in the optimized file
+	Original string `xml:"original,attr"` // part keeping its original content
+	Id       string `xml:"id,attr"`       // relationship of the index to the original part
+}
+
+type Originals struct {
+	XMLName xml.Name        `xml:"urn:pptoptimizer:originals originals"`
+	Medias  []OriginalMedia `xml:"media"`
+}
+
+// SetKeepOriginals stores the original content of the optimized medias in the output, so that they can be restored
+func (p *PowerpointDoc) SetKeepOriginals(keep bool) {
+	p.keepOriginals = keep
+}
+
+// saveOriginals copies the source entries of the medias changed or renamed by the optimizations under pptoptimizer/originals/,
+// with an index mapping each media of the output to its original
+func (p *PowerpointDoc) saveOriginals(outz *packageWriter) error {
+	if !p.keepOriginals || len(p.audit) == 0 {
+		return nil
+	}
+	source := make(map[string]*zip.File, len(p.sourceFileReader.File))
+	for _, f := range p.sourceFileReader.File {
+		source[f.Name] = f
+	}
+	if _, ok := source[originalsPartName]; ok {
+		log.Infoln("input file already keeps the originals of its medias, leave them as is")
+		return nil
+	}
+	names := make([]string, 0, len(p.audit))
+	for name := range p.audit {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var originals Originals
+	var rels Relationships
+	for _, name := range names {
+		f, ok := source[p.audit[name].Original.Name]
+		if !ok {
+			continue
+		}
+		part := originalsDir + f.Name
+		if err := outz.CopyFileAs(f, part); err != nil {
+			return err
+		}
+		id := rels.NewId()
+		rels.Relationship = append(rels.Relationship, Relationship{Id: id, Type: originalRelationshipType, Target: "originals/" + f.Name})
+		originals.Medias = append(originals.Medias, OriginalMedia{Name: name, Original: part, Id: id})
+		log.Debugln("keep original of", name, "as", part)
+	}
+	if len(originals.Medias) == 0 {
+		return nil
+	}
+	xmlout, _ := xml.Marshal(originals)
+	if err := outz.WritePart(originalsPartName, append([]byte(xmlHeader), xmlout...)); err != nil {
+		return err
+	}
+	if err := saveRelationships(rels, relsPartName(originalsPartName), outz); err != nil {
+		return err
+	}
+	log.Infoln("kept the originals of", len(originals.Medias), "medias in", originalsDir)
+
+	p.contentTypes.RemoveOverride(originalsPartName)
+	p.contentTypes.Override = append(p.contentTypes.Override, TypeOverride{PartName: "/" + originalsPartName, ContentType: originalsContentType})
+	for _, rel := range p.packageRels.Relationship {
+		if rel.Type == originalsRelationshipType {
+			return nil
+		}
+	}
+	p.packageRels.Relationship = append(p.packageRels.Relationship, Relationship{Id: p.packageRels.NewId(), Type: originalsRelationshipType, Target: originalsPartName})
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// checkTmpDir makes sure temporary files can be created in tmpdir and later renamed into destdir
+func checkTmpDir(tmpdir string, destdir string) error {
+	probe, err := ioutil.TempFile(tmpdir, ".pptoptimizer-probe-*")
+	if err != nil {
+		return errors.New("temp dir " + tmpdir + " is not writable: " + err.Error())
+	}
+	probe.Close()
+	defer os.Remove(probe.Name())
+
+	// a rename only works within the same filesystem
+	moved := filepath.Join(destdir, filepath.Base(probe.Name()))
+	if err := os.Rename(probe.Name(), moved); err != nil {
+		return errors.New("temp dir " + tmpdir + " is not on the same filesystem as " + destdir)
+	}
+	os.Remove(moved)
+	return nil
+}
+
+func createTmpOutput(tmpdir string) string {
+	tmpf, err := ioutil.TempFile(tmpdir, "pptoptimizer-*.pptx")
+	if err != nil {
+		exitWith(exitFailure, "cannot create temporary output file:", err)
+	}
+	tmpf.Close()
+	return tmpf.Name()
+}
+
+// checkSavings returns an error if the output is not smaller than the input
+func checkSavings(output string, inputSize int64) error {
+	info, err := os.Stat(output)
+	if err != nil {
+		return err
+	}
+	if info.Size() >= inputSize {
+		return errors.New("no savings, the output is " + strconv.FormatInt(info.Size(), 10) + " bytes, the input " + strconv.FormatInt(inputSize, 10) + " bytes")
+	}
+	return nil
+}
+
+func backupName(f string, i int) string {
+	if i == 0 {
+		return f + ".bak"
+	}
+	return f + ".bak" + strconv.Itoa(i)
+}
+
+// backupFile keeps the current content of f as f.bak, the previous backups being shifted to f.bak1 .. f.bak<n-1>
+// and the oldest one dropped. The backup is a hard link when possible, so that f stays in place until replaced,
+// it tells whether f was moved instead.
+func backupFile(f string, n int) (moved bool, err error) {
+	os.Remove(backupName(f, n-1))
+	for i := n - 2; i >= 0; i-- {
+		if err := os.Rename(backupName(f, i), backupName(f, i+1)); err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+	if err := os.Link(f, backupName(f, 0)); err == nil {
+		return false, nil
+	}
+	return true, os.Rename(f, backupName(f, 0))
+}
+
+// retry runs op up to 1+retries times, doubling the delay between attempts, for transient errors of network filesystems;
+// an existing file is not transient
+func retry(retries int, delay time.Duration, what string, op func() error) error {
+	err := op()
+	for i := 0; err != nil && !errors.Is(err, os.ErrExist) && i < retries; i++ {
+		log.Warnln(what, "failed:", err, ", retry in", delay)
+		time.Sleep(delay)
+		delay *= 2
+		err = op()
+	}
+	return err
+}
+
+// SetNoClobber makes SaveFile fail instead of overwriting an existing file, checked atomically when creating it
+func (p *PowerpointDoc) SetNoClobber(noClobber bool) {
+	p.noClobber = noClobber
+}
+
+// SetRetries sets how many times the creation of the output file is retried, and the initial delay between attempts
+func (p *PowerpointDoc) SetRetries(retries int, delay time.Duration) {
+	p.retries, p.retryDelay = retries, delay
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"path"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var numberedKinds = []string{"slide", "slideLayout", "slideMaster"}
+
+// isPartOfKind tells whether a part is stored in the folder of one of the kinds, such as ppt/notesSlides
+// for notesSlide
+func isPartOfKind(name string, kinds []string) bool {
+	for _, kind := range kinds {
+		if path.Dir(name) == "ppt/"+kind+"s" {
+			return true
+		}
+	}
+	return false
+}
+
+// findNonStandardPartNames maps the slides, layouts and masters named like slide01.xml or slide-1.xml
+// to the slideN.xml names the rest of the tool relies on, and warns about those which cannot be numbered
+func findNonStandardPartNames(r *zip.Reader) map[string]string {
+	names := make(map[string]bool, len(r.File))
+	for _, f := range r.File {
+		names[f.Name] = true
+	}
+	renamed := make(map[string]string)
+	for _, f := range r.File {
+		for _, kind := range numberedKinds {
+			if path.Dir(f.Name) != "ppt/"+kind+"s" || path.Ext(f.Name) != ".xml" {
+				continue
+			}
+			n, err := getObjectNumberFromFilename(f.Name)
+			if err != nil || n < 1 {
+				log.Warnln("cannot number", kind, f.Name, ", it may be mishandled")
+				continue
+			}
+			canonical := partName(kind, n-1)
+			if canonical == f.Name {
+				continue
+			}
+			if names[canonical] {
+				log.Warnln(kind, f.Name, "has the same number as", canonical, ", it may be mishandled")
+				continue
+			}
+			log.Warnln("non-standard", kind, "name", f.Name, ", renamed", canonical)
+			renamed[f.Name] = canonical
+			renamed[relsPartName(f.Name)] = relsPartName(canonical)
+			names[canonical] = true
+		}
+	}
+	return renamed
+}
+
+// renameSourceParts renames the entries of the source archive, only their names are read afterwards
+func renameSourceParts(r *zip.Reader, renamed map[string]string) {
+	for _, f := range r.File {
+		if name, ok := renamed[f.Name]; ok {
+			f.Name = name
+		}
+	}
+}
+
+// retargetRenamedParts updates the content types and all relationships to the renamed parts, the rels which
+// are copied verbatim otherwise are replaced
+func (p *PowerpointDoc) retargetRenamedParts() {
+	if len(p.renamedParts) == 0 {
+		return
+	}
+	for i, o := range p.contentTypes.Override {
+		if name, ok := p.renamedParts[o.PartName[1:]]; ok {
+			p.contentTypes.Override[i].PartName = "/" + name
+		}
+	}
+	retarget := func(rels *Relationships, source string) {
+		for old, name := range p.renamedParts {
+			rels.ReplaceTarget(source, old, name)
+		}
+	}
+	retarget(&p.packageRels, "")
+	retarget(&p.presentationRels, "ppt/presentation.xml")
+	for kind, all := range map[string][]Relationships{"slide": p.slideRels, "slideLayout": p.slideLayoutRels, "slideMaster": p.slideMasterRels} {
+		for i := range all {
+			retarget(&all[i], partName(kind, i))
+		}
+	}
+	for source, rels := range p.otherRels {
+		retarget(&rels, source)
+		p.otherRels[source] = rels
+	}
+	for _, f := range p.sourceFileReader.File {
+		if path.Ext(f.Name) != ".rels" || isParsedRels(f.Name) {
+			continue
+		}
+		rels, err := parseRelationships(f)
+		if err != nil {
+			log.Warnln(err, ", relationships to renamed parts left as is")
+			continue
+		}
+		before, _ := xml.Marshal(rels)
+		retarget(&rels, relsSourcePart(f.Name))
+		after, _ := xml.Marshal(rels)
+		if string(before) != string(after) {
+			log.Debugln("retarget renamed parts in", f.Name)
+			p.replacedParts[f.Name] = append([]byte(xmlHeader), after...)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"path"
+	"strings"
+	"testing"
+)
+
+// renamePart renames a part of the test deck, with its relationships, content type and the targets to it
+func (d *testDeck) renamePart(old string, name string) {
+	d.parts[name] = d.parts[old]
+	delete(d.parts, old)
+	d.rels[name], d.shapes[name] = d.rels[old], d.shapes[old]
+	delete(d.rels, old)
+	delete(d.shapes, old)
+	for source, rels := range d.rels {
+		for i, rel := range rels {
+			if resolveTarget(source, rel.Target) == old {
+				rels[i].Target = strings.TrimSuffix(rel.Target, path.Base(old)) + path.Base(name)
+			}
+		}
+	}
+	for i, o := range d.types.Override {
+		if o.PartName == "/"+old {
+			d.types.Override[i].PartName = "/" + name
+		}
+	}
+}
+
+func TestNonStandardPartNames(t *testing.T) {
+	d := newTestDeck(3)
+	d.image("ppt/slides/slide1.xml", "ppt/media/image1.png", testPNG(10, 10))
+	d.image("ppt/slides/slide2.xml", "ppt/media/image2.png", testPNG(12, 10))
+	d.layout(false) // unused
+	d.renamePart("ppt/slides/slide1.xml", "ppt/slides/slide01.xml")
+	d.renamePart("ppt/slides/slide2.xml", "ppt/slides/slide-2.xml")
+	d.renamePart("ppt/slideLayouts/slideLayout1.xml", "ppt/slideLayouts/slideLayout01.xml")
+	in := d.write(t)
+
+	p := parseTestFile(t, in)
+	for old, name := range map[string]string{
+		"ppt/slides/slide01.xml":             "ppt/slides/slide1.xml",
+		"ppt/slides/slide-2.xml":             "ppt/slides/slide2.xml",
+		"ppt/slideLayouts/slideLayout01.xml": "ppt/slideLayouts/slideLayout1.xml",
+	} {
+		if p.renamedParts[old] != name {
+			t.Errorf("%s renamed %q, want %s", old, p.renamedParts[old], name)
+		}
+	}
+	if n := p.SlideCount(); n != 3 {
+		t.Fatalf("%d slides, want 3", n)
+	}
+	p.RemoveUnusedLayouts()
+	p.RemoveUnusedMasters()
+	p.RemoveUnusedMedias()
+	p.RenumberRelationships()
+	out, parts := saveTestFile(t, p)
+
+	assertReferencesResolve(t, parts)
+	if err := selfTestFile(out, 3); err != nil {
+		t.Error(err)
+	}
+	for _, name := range []string{"ppt/slides/slide1.xml", "ppt/slides/slide2.xml", "ppt/slideLayouts/slideLayout1.xml", "ppt/media/image1.png", "ppt/media/image2.png"} {
+		if parts[name] == nil {
+			t.Errorf("%s missing from the output", name)
+		}
+	}
+	for name := range parts {
+		if strings.Contains(name, "01.xml") || strings.Contains(name, "-2.xml") || name == "ppt/slideLayouts/slideLayout2.xml" {
+			t.Errorf("%s in the output", name)
+		}
+	}
+}
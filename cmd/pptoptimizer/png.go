@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os/exec"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func encodePNG(img image.Image) ([]byte, error) {
+	out := bytes.NewBuffer(nil)
+	enc := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := enc.Encode(out, img); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// pngHasAlpha tells from the IHDR chunk whether the png stores an alpha channel
+func pngHasAlpha(data []byte) bool {
+	if len(data) < 26 || string(data[12:16]) != "IHDR" {
+		return false
+	}
+	colorType := data[25]
+	return colorType == 4 || colorType == 6 // gray + alpha, rgb + alpha
+}
+
+func hasOpaqueAlpha(img image.Image) bool {
+	switch m := img.(type) {
+	case *image.NRGBA:
+		return m.Opaque()
+	case *image.NRGBA64:
+		return m.Opaque()
+	case *image.RGBA:
+		return m.Opaque()
+	case *image.RGBA64:
+		return m.Opaque()
+	}
+	return false
+}
+
+// FlattenOpaquePNGs re-encodes PNGs whose alpha channel is fully opaque,
+// the png encoder then writes them without alpha
+func (p *PowerpointDoc) FlattenOpaquePNGs() {
+	for _, name := range p.MediaNames() {
+		data, format := p.readMediaOfFormat(name, "png")
+		if format == "" || !pngHasAlpha(data) {
+			continue
+		}
+		img, err := p.decodeMedia(name, "png", data)
+		if err != nil {
+			p.mediaDecodeFailed(name, err)
+			continue
+		}
+		if !hasOpaqueAlpha(img) {
+			continue
+		}
+		flat, err := encodePNG(img)
+		if err != nil {
+			log.Warnln("cannot encode png", name, ":", err)
+			continue
+		}
+		if len(flat) >= len(data) {
+			log.Debugln("flattened png", name, "is not smaller, keep original")
+			continue
+		}
+		log.Infoln("flattened opaque alpha of", name, len(data), "->", len(flat))
+		p.ReplaceMedia(name, flat, "dropped opaque alpha channel")
+	}
+}
+
+// RecompressPNGs runs every PNG picture through an external optimizer such as optipng or zopflipng,
+// or through the internal encoder when no tool is given, and keeps the smaller result
+func (p *PowerpointDoc) RecompressPNGs(tool string) {
+	if args := strings.Fields(tool); len(args) > 0 {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			log.Warnln("png optimizer", args[0], "not found, use internal encoder")
+			tool = ""
+		}
+	}
+	for _, name := range p.MediaNames() {
+		data, format := p.readMediaOfFormat(name, "png")
+		if format == "" {
+			continue
+		}
+		var out []byte
+		var err error
+		if tool != "" {
+			out, err = runExternalTool(tool, "png", data, "", outputInPlace)
+			if err != nil {
+				log.Warnln("png optimizer failed on", name, ":", err, ", use internal encoder")
+			} else if sniffImageFormat(out) != "png" {
+				log.Warnln("png optimizer did not produce a png for", name, ", use internal encoder")
+				out = nil
+			}
+		}
+		if out == nil {
+			img, err := p.decodeMedia(name, "png", data)
+			if err != nil {
+				p.mediaDecodeFailed(name, err)
+				continue
+			}
+			if out, err = encodePNG(img); err != nil {
+				log.Warnln("cannot encode png", name, ":", err)
+				continue
+			}
+		}
+		if len(out) >= len(data) {
+			log.Debugln("recompressed png", name, "is not smaller, keep original")
+			continue
+		}
+		log.Infoln("recompressed png", name, len(data), "->", len(out))
+		p.ReplaceMedia(name, out, "recompressed")
+	}
+}
@@ -3,16 +3,21 @@ package main
 import (
 	"archive/zip"
 	"bytes"
+	"encoding/base64"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"image/png"
+	"io"
 	"io/ioutil"
+	"net/url"
 	"os"
-	"path/filepath"
+	"path"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -27,15 +32,71 @@ type Relationship struct {
 	TargetMode string `xml:"TargetMode,attr,omitempty"`
 }
 
+// relationship types of the transitional and strict formats
+const relTypeTransitional = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/"
+const relTypeStrict = "http://purl.oclc.org/ooxml/officeDocument/relationships/"
+
+// Is tells whether a relationship is of a type such as image or slideLayout, in the transitional or strict format
+func (r Relationship) Is(kind string) bool {
+	return r.Type == relTypeTransitional+kind || r.Type == relTypeStrict+kind
+}
+
+// relationship of PowerPoint 2010 and later to the file of an audio or video, alongside an audio or video relationship
+const mediaRelType = "http://schemas.microsoft.com/office/2007/relationships/media"
+
+// isMediaFile tells whether a relationship targets an audio or video file, through either of the paired relationships
+func (r Relationship) isMediaFile() bool {
+	return r.Type == mediaRelType || r.Is("audio") || r.Is("video")
+}
+
 type Relationships struct {
 	XMLName      xml.Name `xml:"http://schemas.openxmlformats.org/package/2006/relationships Relationships"`
 	Relationship []Relationship
 }
 
-func (r *Relationships) ReplaceTarget(oldbasename string, newbasename string) {
+// resolveTarget returns the part name targeted by a relationship of the source part,
+// whether the target is relative (../media/image1.png) or absolute (/ppt/media/image1.png),
+// percent-encoded characters such as %20 are decoded, and fragments are ignored
+func resolveTarget(source string, target string) string {
+	if i := strings.Index(target, "#"); i >= 0 {
+		target = target[:i]
+	}
+	if unescaped, err := url.PathUnescape(target); err == nil {
+		target = unescaped
+	}
+	if strings.HasPrefix(target, "/") {
+		return strings.TrimPrefix(path.Clean(target), "/")
+	}
+	return path.Join(path.Dir(source), target)
+}
+
+// NewId returns an unused relationship id
+func (r *Relationships) NewId() string {
+	for n := len(r.Relationship) + 1; ; n++ {
+		id := fmt.Sprintf("rId%d", n)
+		free := true
+		for _, rel := range r.Relationship {
+			if rel.Id == id {
+				free = false
+				break
+			}
+		}
+		if free {
+			return id
+		}
+	}
+}
+
+func (r *Relationships) ReplaceTarget(source string, oldpart string, newpart string) {
 	for i, rel := range r.Relationship {
-		if strings.HasSuffix(rel.Target, oldbasename) {
-			r.Relationship[i].Target = strings.Replace(rel.Target, oldbasename, newbasename, 1)
+		if rel.TargetMode != "External" && resolveTarget(source, rel.Target) == oldpart {
+			if path.Dir(oldpart) != path.Dir(newpart) {
+				// such as a duplicate media replaced by one in another directory
+				r.Relationship[i].Target = (&url.URL{Path: "/" + newpart}).EscapedPath()
+				continue
+			}
+			// keep the original form of the target, only swap the file name
+			r.Relationship[i].Target = path.Join(path.Dir(rel.Target), (&url.URL{Path: path.Base(newpart)}).EscapedPath())
 		}
 	}
 }
@@ -43,45 +104,152 @@ func (r *Relationships) ReplaceTarget(oldbasename string, newbasename string) {
 type Media struct {
 	size uint64
 	data []byte
+	file string // temporary file holding the content when over the memory budget
+}
+
+type TypeDefault struct {
+	Extension   string `xml:"Extension,attr"`
+	ContentType string `xml:"ContentType,attr"`
+}
+
+type TypeOverride struct {
+	PartName    string `xml:"PartName,attr"`
+	ContentType string `xml:"ContentType,attr"`
 }
 
 type Types struct {
-	XMLName xml.Name `xml:"http://schemas.openxmlformats.org/package/2006/content-types Types"`
-	Default []struct {
-		Extension   string `xml:"Extension,attr"`
-		ContentType string `xml:"ContentType,attr"`
-	}
-	Override []struct {
-		PartName    string `xml:"PartName,attr"`
-		ContentType string `xml:"ContentType,attr"`
+	XMLName  xml.Name `xml:"http://schemas.openxmlformats.org/package/2006/content-types Types"`
+	Default  []TypeDefault
+	Override []TypeOverride
+}
+
+func (t *Types) AddDefault(extension string, contentType string) {
+	for _, d := range t.Default {
+		if strings.EqualFold(d.Extension, extension) {
+			return
+		}
 	}
+	t.Default = append(t.Default, TypeDefault{Extension: extension, ContentType: contentType})
 }
 
 type PowerpointDoc struct {
-	sourceFileReader *zip.ReadCloser
+	sourceFileName   string
+	sourceFileReader *zip.Reader
+	sourceCloser     io.Closer                  // nil when parsed from a reader owned by the caller
+	sourceAt         io.ReaderAt                // underlying source, to copy compressed entries as is
+	parts            map[string]*etree.Document // other xml parts loaded for editing, rewritten on save
 	medias           map[string]Media
 	slideRels        []Relationships
 	slideLayoutRels  []Relationships
 	slideMasterRels  []Relationships
 	presentationRels Relationships
+	otherRels        map[string]Relationships // relationships of other parts referencing medias, by source part name
+	keptLayouts      []string
+	removedSlides    []bool
+	removedLayouts   []bool
+	removedMasters   []bool
+	removedParts     map[string]bool   // other parts removed, with their relationships
+	replacedParts    map[string][]byte // other parts with a new content, such as repacked embeddings
+	bestEffort       bool
+	auditEnabled     bool
+	audit            map[string]*AuditEntry // by current media name
+	auditOrder       []*AuditEntry
+	keepOriginals    bool
+	mediaParts       map[string]bool // parts of the source file parsed as medias, in ppt/media or elsewhere
+	signatures       []string        // digital signature parts, which any repackaging invalidates
+	sourceSlideParts int             // slide parts of the source file, listed in the presentation or not
+	packageRels      Relationships
+	manifestEnabled  bool
+	manifest         []ManifestEntry
+	problems         []error
+	skippedTiffs     []string
+	mediaFormats     map[string]MediaFormat // by media base name, as given with -formats
+	convertedFormats map[string]MediaFormat // formats of the medias converted by -formats, by part name
+	mediaTail        map[string]bool        // small medias left untouched by -toppct
+	mediaOnly        bool
+	retries          int
+	noClobber        bool // SaveFile fails on an existing file instead of overwriting it
+	memBudget        int64
+	spilled          []string // temporary files of medias over the memory budget
+	decoded          *decodeCache
+	streamOrder      bool
+	mediaErrors      []error
+	minVersion       string            // oldest PowerPoint version which must display the output
+	renamedParts     map[string]string // non-standard slide, layout and master names, to slideN.xml names
+	retryDelay       time.Duration
 	slideMasters     []*etree.Document
 	presentation     *etree.Document
+	presentationEdit bool // the presentation is rewritten on save, copied verbatim otherwise
 	contentTypes     Types
 }
 
-var reSlideNumber = regexp.MustCompile(`/[a-zA-Z]+([0-9]+)\.xml`)
+// other parts whose relationships can reference medias
+var otherRelsDirs = []string{"ppt/notesMasters/", "ppt/handoutMasters/", "ppt/diagrams/", "ppt/theme/", "ppt/charts/"}
+
+var reSlideNumber = regexp.MustCompile(`/[a-zA-Z]+-?([0-9]+)\.xml`)
 var xmlHeader = "<?xml version=\"1.0\" encoding=\"UTF-8\" standalone=\"yes\"?>\n"
 
 func NewPowerpointDoc() *PowerpointDoc {
 	pptx := PowerpointDoc{}
 	pptx.medias = make(map[string]Media)
+	pptx.mediaParts = make(map[string]bool)
+	pptx.parts = make(map[string]*etree.Document)
+	pptx.otherRels = make(map[string]Relationships)
+	pptx.audit = make(map[string]*AuditEntry)
+	pptx.removedParts = make(map[string]bool)
+	pptx.replacedParts = make(map[string][]byte)
+	pptx.convertedFormats = make(map[string]MediaFormat)
+	pptx.decoded = newDecodeCache(defaultDecodeCacheSize)
 	return &pptx
 }
 
 func (p *PowerpointDoc) Close() {
-	if p.sourceFileReader != nil {
-		p.sourceFileReader.Close()
+	if p.sourceCloser != nil {
+		p.sourceCloser.Close()
+		p.sourceCloser = nil
+	}
+	p.sourceFileReader = nil
+	p.removeSpilled()
+}
+
+// SetMediaOnly restricts the changes to medias and relationships to them, other xml parts are copied verbatim
+func (p *PowerpointDoc) SetMediaOnly(mediaOnly bool) {
+	p.mediaOnly = mediaOnly
+}
+
+// xmlLocked tells whether a pass editing xml parts must be skipped
+func (p *PowerpointDoc) xmlLocked(pass string) bool {
+	if p.mediaOnly {
+		log.Warnln("media only mode, skip", pass)
+	}
+	return p.mediaOnly
+}
+
+func (p *PowerpointDoc) SetBestEffort(bestEffort bool) {
+	p.bestEffort = bestEffort
+}
+
+// Problem reports an error once, the passes skipping what it concerns; see Err for when it fails the run
+func (p *PowerpointDoc) Problem(err error) {
+	for _, known := range p.problems {
+		if known.Error() == err.Error() {
+			return
+		}
 	}
+	log.Warnln(err)
+	p.problems = append(p.problems, err)
+}
+
+func (p *PowerpointDoc) Problems() []error {
+	return p.problems
+}
+
+// Err returns the first problem reported, which must not be saved over when not running in best effort mode
+func (p *PowerpointDoc) Err() error {
+	if p.bestEffort || len(p.problems) == 0 {
+		return nil
+	}
+	return p.problems[0]
 }
 
 func updateRelationships(rels []Relationships, pos int, r Relationships) []Relationships {
@@ -95,6 +263,15 @@ func updateRelationships(rels []Relationships, pos int, r Relationships) []Relat
 	return newrels
 }
 
+func growRelationships(rels []Relationships, n int) []Relationships {
+	if n > len(rels) {
+		newrels := make([]Relationships, n)
+		copy(newrels, rels)
+		return newrels
+	}
+	return rels
+}
+
 func updateSlideMasters(sms []*etree.Document, pos int, sm *etree.Document) []*etree.Document {
 	// increase length if needed
 	newsms := sms
@@ -106,6 +283,44 @@ func updateSlideMasters(sms []*etree.Document, pos int, sm *etree.Document) []*e
 	return newsms
 }
 
+func partName(reltype string, i int) string {
+	return fmt.Sprintf("ppt/%ss/%s%d.xml", reltype, reltype, i+1)
+}
+
+// isParsedRels tells whether a rels file is parsed and rewritten on save, instead of being copied
+func isParsedRels(name string) bool {
+	return name == "_rels/.rels" || strings.HasPrefix(name, "ppt/_rels/") ||
+		strings.HasPrefix(name, "ppt/slides/_rels/") || strings.HasPrefix(name, "ppt/slideLayouts/_rels/") ||
+		strings.HasPrefix(name, "ppt/slideMasters/_rels/") || isOtherRels(name)
+}
+
+func isOtherRels(name string) bool {
+	for _, dir := range otherRelsDirs {
+		if strings.HasPrefix(name, dir+"_rels/") {
+			return true
+		}
+	}
+	return false
+}
+
+// relsSourcePart returns the part described by a rels file, ppt/x/_rels/y.xml.rels -> ppt/x/y.xml
+func relsSourcePart(relpath string) string {
+	return path.Join(path.Dir(path.Dir(relpath)), strings.TrimSuffix(path.Base(relpath), ".rels"))
+}
+
+func relsPartName(source string) string {
+	return path.Join(path.Dir(source), "_rels", path.Base(source)+".rels")
+}
+
+func (p *PowerpointDoc) otherRelsSources() []string {
+	sources := make([]string, 0, len(p.otherRels))
+	for k := range p.otherRels {
+		sources = append(sources, k)
+	}
+	sort.Strings(sources)
+	return sources
+}
+
 func getObjectNumberFromFilename(fname string) (int, error) {
 	matches := reSlideNumber.FindStringSubmatch(fname)
 	if len(matches) != 2 {
@@ -118,263 +333,666 @@ func getObjectNumberFromFilename(fname string) (int, error) {
 	return slideNumber, nil
 }
 
-func parseRelationships(f *zip.File) Relationships {
+func parseRelationships(f *zip.File) (Relationships, error) {
+	rel := Relationships{}
 	relf, err := f.Open()
 	if err != nil {
-		log.Fatal(err)
+		return rel, &PartError{Part: f.Name, Err: err}
 	}
 	defer relf.Close()
 	relfxml, err := ioutil.ReadAll(relf)
 	if err != nil {
-		log.Fatal(err)
+		return rel, &PartError{Part: f.Name, Err: err}
+	}
+	if err := xml.Unmarshal(relfxml, &rel); err != nil {
+		return rel, &PartError{Part: f.Name, Err: err}
+	}
+	return rel, nil
+}
+
+// copiedRelationships parses a rels file which is copied verbatim, as replaced by an earlier pass if it was
+func (p *PowerpointDoc) copiedRelationships(f *zip.File) (Relationships, error) {
+	data, ok := p.replacedParts[f.Name]
+	if !ok {
+		return parseRelationships(f)
 	}
 	rel := Relationships{}
-	err = xml.Unmarshal(relfxml, &rel)
-	if err != nil {
-		log.Fatal(err)
+	if err := xml.Unmarshal(data, &rel); err != nil {
+		return rel, &PartError{Part: f.Name, Err: err}
 	}
-	return rel
+	return rel, nil
 }
 
-func parseAllRelationships(rels []Relationships, reltype string, f *zip.File) []Relationships {
+func parseAllRelationships(rels []Relationships, reltype string, f *zip.File) ([]Relationships, error) {
 	if strings.HasPrefix(f.Name, fmt.Sprintf("ppt/%ss/_rels/", reltype)) {
-		rel := parseRelationships(f)
+		rel, err := parseRelationships(f)
+		if err != nil {
+			return rels, err
+		}
 		objNumber, _ := getObjectNumberFromFilename(f.Name)
 		rels = updateRelationships(rels, objNumber, rel)
 	}
-	return rels
+	return rels, nil
+}
+
+func saveRelationships(rel Relationships, relpath string, outz *packageWriter) error {
+	xmlout, _ := xml.Marshal(rel)
+	return outz.WritePart(relpath, append([]byte(xmlHeader), xmlout...))
 }
 
-func saveRelationships(rel Relationships, relpath string, outz *zip.Writer) {
-	fo, err := outz.Create(relpath)
+// writeDocument writes an xml part, which is copied from the source when unchanged
+func (p *PowerpointDoc) writeDocument(outz *packageWriter, name string, doc *etree.Document) error {
+	data, err := doc.WriteToBytes()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	xmlout, _ := xml.Marshal(rel)
-	fo.Write([]byte(xmlHeader))
-	fo.Write(xmlout)
+	return outz.WritePart(name, data)
 }
 
-func saveAllRelationships(rels []Relationships, reltype string, outz *zip.Writer) {
+func (p *PowerpointDoc) saveAllRelationships(rels []Relationships, reltype string, removed []bool, outz *packageWriter) error {
 	for i, r := range rels {
-		if len(r.Relationship) == 0 { // skip empty
+		relpath := relsPartName(partName(reltype, i))
+		if isRemoved(removed, i) {
+			continue
+		}
+		if len(r.Relationship) == 0 && !p.hasSourcePart(relpath) { // no part with this number
 			continue
 		}
 		log.Debugln("new", reltype, "rels", i+1)
-		saveRelationships(r, fmt.Sprintf("ppt/%ss/_rels/%s%d.xml.rels", reltype, reltype, i+1), outz)
+		if err := saveRelationships(r, relpath, outz); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 func (p *PowerpointDoc) ParseFile(f string) error {
-	r, err := zip.OpenReader(f)
+	r, file, err := openZipFile(f)
 	if err != nil {
-		log.Fatalln("pptx is an invalid zip file", err)
 		return err
 	}
+	p.sourceFileName = f
+	p.sourceCloser = file
+	p.sourceAt = file
+	return p.parse(r)
+}
+
+// ParseReader parses a pptx from memory or any other source, r must stay readable until the document is saved
+func (p *PowerpointDoc) ParseReader(r io.ReaderAt, size int64) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return openError(r, err)
+	}
+	p.sourceAt = r
+	return p.parse(zr)
+}
+
+// Materialize reads the whole source file in memory and closes it, so that other processes can modify
+// or delete it before the document is saved. This costs as much memory as the size of the source file.
+func (p *PowerpointDoc) Materialize() error {
+	if p.sourceCloser == nil {
+		return nil // already in memory, or owned by the caller
+	}
+	data, err := ioutil.ReadFile(p.sourceFileName)
+	if err != nil {
+		return err
+	}
+	at := bytes.NewReader(data)
+	r, err := zip.NewReader(at, int64(len(data)))
+	if err != nil {
+		return err
+	}
+	renameSourceParts(r, p.renamedParts)
+	p.sourceCloser.Close()
+	p.sourceCloser = nil
 	p.sourceFileReader = r
+	p.sourceAt = at
+	return nil
+}
+
+// ParseBase64 parses a base64 encoded pptx
+func (p *PowerpointDoc) ParseBase64(s string) error {
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return fmt.Errorf("pptx is not valid base64: %w", err)
+	}
+	return p.ParseReader(bytes.NewReader(data), int64(len(data)))
+}
+
+func (p *PowerpointDoc) parse(r *zip.Reader) error {
+	p.sourceFileReader = r
+	p.renamedParts = findNonStandardPartNames(r)
+	renameSourceParts(r, p.renamedParts)
 
 	// parse archive contents
+	var err error
+	hasContentTypes := false
 	for _, f := range p.sourceFileReader.File {
+		if strings.HasPrefix(f.Name, "_xmlsignatures/") && path.Ext(f.Name) != ".rels" {
+			p.signatures = append(p.signatures, f.Name)
+		}
 		if strings.HasPrefix(f.Name, "ppt/media/") {
 			p.medias[f.Name] = Media{size: f.UncompressedSize64}
+			p.mediaParts[f.Name] = true
 		} else if f.Name == "[Content_Types].xml" {
 			ctf, err := f.Open()
 			if err != nil {
-				log.Fatal(err)
+				return &PartError{Part: f.Name, Err: err}
 			}
 			defer ctf.Close()
 			ctxml, err := ioutil.ReadAll(ctf)
 			if err != nil {
-				log.Fatal(err)
+				return &PartError{Part: f.Name, Err: err}
+			}
+			if len(bytes.TrimSpace(ctxml)) == 0 {
+				continue
 			}
+			hasContentTypes = true
 			err = xml.Unmarshal(ctxml, &p.contentTypes)
 			if err != nil {
-				log.Fatal(err)
+				return &PartError{Part: f.Name, Err: err}
 			}
 		} else if strings.HasPrefix(f.Name, "ppt/slideMasters/slideMaster") {
 			smf, err := f.Open()
 			if err != nil {
-				log.Fatal(err)
+				return &PartError{Part: f.Name, Err: err}
 			}
 			defer smf.Close()
 			doc := etree.NewDocument()
 			if _, err := doc.ReadFrom(smf); err != nil {
-				log.Fatal(err)
+				return &PartError{Part: f.Name, Err: err}
 			}
 			masterNumber, _ := getObjectNumberFromFilename(f.Name)
 			p.slideMasters = updateSlideMasters(p.slideMasters, masterNumber, doc)
+		} else if f.Name == "_rels/.rels" {
+			if p.packageRels, err = parseRelationships(f); err != nil {
+				return err
+			}
 		} else if f.Name == "ppt/_rels/presentation.xml.rels" {
-			p.presentationRels = parseRelationships(f)
+			if p.presentationRels, err = parseRelationships(f); err != nil {
+				return err
+			}
+		} else if isOtherRels(f.Name) {
+			rels, err := parseRelationships(f)
+			if err != nil {
+				return err
+			}
+			p.otherRels[relsSourcePart(f.Name)] = rels
 		} else if f.Name == "ppt/presentation.xml" {
 			pf, err := f.Open()
 			if err != nil {
-				log.Fatal(err)
+				return &PartError{Part: f.Name, Err: err}
 			}
 			defer pf.Close()
 			doc := etree.NewDocument()
 			if _, err := doc.ReadFrom(pf); err != nil {
-				log.Fatal(err)
+				return &PartError{Part: f.Name, Err: err}
 			}
 			p.presentation = doc
 		} else {
-			p.slideRels = parseAllRelationships(p.slideRels, "slide", f)
-			p.slideLayoutRels = parseAllRelationships(p.slideLayoutRels, "slideLayout", f)
-			p.slideMasterRels = parseAllRelationships(p.slideMasterRels, "slideMaster", f)
+			if strings.HasPrefix(f.Name, "ppt/slideLayouts/slideLayout") {
+				// a layout may have no rels file at all
+				layoutNumber, _ := getObjectNumberFromFilename(f.Name)
+				p.slideLayoutRels = growRelationships(p.slideLayoutRels, layoutNumber)
+			}
+			if p.slideRels, err = parseAllRelationships(p.slideRels, "slide", f); err != nil {
+				return err
+			}
+			if p.slideLayoutRels, err = parseAllRelationships(p.slideLayoutRels, "slideLayout", f); err != nil {
+				return err
+			}
+			if p.slideMasterRels, err = parseAllRelationships(p.slideMasterRels, "slideMaster", f); err != nil {
+				return err
+			}
 		}
 	}
+	if p.presentation == nil {
+		return fmt.Errorf("%w: no ppt/presentation.xml part", ErrNotAPresentation)
+	}
+	if !hasContentTypes {
+		log.Warnln("no content types in the input file, rebuilt from the relationships and part extensions")
+		p.rebuildContentTypes()
+	}
+	p.retargetRenamedParts()
+	p.addMediasOutsideMediaDir()
+	p.checkSlideList()
+	if p.IsSigned() {
+		log.Warnln("input file is digitally signed, saving it will invalidate the signature")
+	}
 
 	return nil
 }
 
+// ReadPart parses an xml part of the source file, without keeping it for rewrite,
+// it returns nil for a missing part and a *PartError for a part which cannot be read or parsed
+func (p *PowerpointDoc) ReadPart(name string) (*etree.Document, error) {
+	for _, f := range p.sourceFileReader.File {
+		if f.Name == name {
+			pf, err := f.Open()
+			if err != nil {
+				return nil, &PartError{Part: name, Err: err}
+			}
+			defer pf.Close()
+			doc := etree.NewDocument()
+			if _, err := doc.ReadFrom(pf); err != nil {
+				return nil, &PartError{Part: name, Err: err}
+			}
+			return doc, nil
+		}
+	}
+	return nil, nil
+}
+
+// LoadPart parses an xml part for editing, it is rewritten on save;
+// a part which cannot be parsed is reported as a problem, and nil returned as for a missing part
+func (p *PowerpointDoc) LoadPart(name string) *etree.Document {
+	if doc, ok := p.parts[name]; ok {
+		return doc
+	}
+	doc, err := p.ReadPart(name)
+	if err != nil {
+		p.Problem(err)
+		return nil
+	}
+	if doc != nil {
+		p.parts[name] = doc
+	}
+	return doc
+}
+
+// SaveFile writes the output file, it returns an error if the file cannot be created or any part written,
+// the output being incomplete then. With SetNoClobber, an existing file is left untouched and the error matches os.ErrExist.
 func (p *PowerpointDoc) SaveFile(f string) error {
 	log.Debugln("save pptx", f)
-	outf, err := os.Create(f)
+	var outf *os.File
+	flags := os.O_CREATE | os.O_TRUNC | os.O_WRONLY
+	if p.noClobber {
+		flags = os.O_CREATE | os.O_EXCL | os.O_WRONLY
+	}
+	err := retry(p.retries, p.retryDelay, "create "+f, func() (err error) {
+		outf, err = os.OpenFile(f, flags, 0666)
+		return err
+	})
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	defer outf.Close()
-	outz := zip.NewWriter(outf)
-	defer outz.Close()
+	outz := newPackageWriter(outf, p.manifestEnabled)
+	outz.stage = p.streamOrder
+	outz.setSource(p.sourceFileReader, p.sourceAt)
+	if err := p.writePackage(outz); err != nil {
+		outz.discardStaged()
+		outf.Close()
+		return err
+	}
+	// the central directory is written on close, and buffered data flushed
+	if err := outz.Close(); err != nil {
+		outf.Close()
+		return err
+	}
+	if err := outf.Close(); err != nil {
+		return err
+	}
+	log.Debugln(outz.rawCopies, "parts copied without compressing them again")
+	p.manifest = outz.Manifest()
+	return nil
+}
 
+// writePackage writes all the parts of the output
+func (p *PowerpointDoc) writePackage(outz *packageWriter) error {
 	for _, f := range p.sourceFileReader.File {
-		if f.Name == "[Content_Types].xml" ||
-			strings.HasPrefix(f.Name, "ppt/slides/_rels/") || strings.HasPrefix(f.Name, "ppt/slideLayouts/_rels/") || strings.HasPrefix(f.Name, "ppt/_rels/") ||
-			strings.HasPrefix(f.Name, "ppt/slideMasters/") || f.Name == "ppt/presentation.xml" {
+		if f.Name == "[Content_Types].xml" || isParsedRels(f.Name) ||
+			(!p.mediaOnly && strings.HasPrefix(f.Name, "ppt/slideMasters/")) || (f.Name == "ppt/presentation.xml" && p.presentationEdit) {
 			log.Debugln("do not copy", f.Name, ", rewrite instead")
 			continue
 		}
-		if _, ok := p.medias[f.Name]; strings.HasPrefix(f.Name, "ppt/media/") && !ok {
+		if _, ok := p.parts[f.Name]; ok {
+			log.Debugln("part", f.Name, "has been edited, rewrite instead")
+			continue
+		}
+		if p.removedParts[f.Name] || (strings.HasSuffix(f.Name, ".rels") && p.removedParts[relsSourcePart(f.Name)]) {
+			log.Debugln("part", f.Name, "has been removed, skip it")
+			continue
+		}
+		if _, ok := p.replacedParts[f.Name]; ok {
+			log.Debugln("part", f.Name, "has been replaced, skip it")
+			continue
+		}
+		if m, ok := p.medias[f.Name]; p.mediaParts[f.Name] && !ok {
 			log.Debugln("media", f.Name, "has been removed, skip it")
 			continue
+		} else if m.replaced() {
+			log.Debugln("media", f.Name, "has been replaced, skip it")
+			continue
 		}
 		if strings.HasPrefix(f.Name, "ppt/slideLayouts/") {
 			layoutNumber, _ := getObjectNumberFromFilename(f.Name)
-			if len(p.slideLayoutRels[layoutNumber-1].Relationship) < 1 {
+			if p.IsLayoutRemoved(layoutNumber - 1) {
 				log.Debugln("slide layout", f.Name, "has been removed, skip it")
 				continue
 			}
 		}
-		log.Debugln("copy file", f.Name)
-		fi, err := f.Open()
-		if err != nil {
-			log.Fatal(err)
+		if strings.HasPrefix(f.Name, "ppt/slides/") {
+			slideNumber, _ := getObjectNumberFromFilename(f.Name)
+			if p.IsSlideRemoved(slideNumber - 1) {
+				log.Debugln("slide", f.Name, "has been removed, skip it")
+				continue
+			}
 		}
-		fo, err := outz.Create(f.Name)
-		if err != nil {
-			log.Fatal(err)
+		log.Debugln("copy file", f.Name)
+		// stream the entry, large medias may not fit in memory
+		if err := outz.CopyFile(f); err != nil {
+			return err
 		}
-		idata, _ := ioutil.ReadAll(fi)
-		fo.Write(idata)
-		fi.Close()
 	}
 
 	// add new media files
-	for k, m := range p.medias {
-		if m.data != nil {
+	for _, k := range p.MediaNames() {
+		if m := p.medias[k]; m.replaced() {
 			log.Debugln("add new media file", k, m.size)
 			fo, err := outz.Create(k)
 			if err != nil {
-				log.Fatal(err)
+				return err
+			}
+			mf, err := p.OpenMedia(k)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(fo, mf)
+			mf.Close()
+			if err != nil {
+				return err
 			}
-			fo.Write(m.data)
 		}
 	}
 
-	// rewrite all rels
-	saveAllRelationships(p.slideRels, "slide", outz)
-	saveAllRelationships(p.slideLayoutRels, "slideLayout", outz)
-	saveAllRelationships(p.slideMasterRels, "slideMaster", outz)
-	saveRelationships(p.presentationRels, "ppt/_rels/presentation.xml.rels", outz)
+	// add replaced parts
+	replacedNames := make([]string, 0, len(p.replacedParts))
+	for name := range p.replacedParts {
+		replacedNames = append(replacedNames, name)
+	}
+	sort.Strings(replacedNames)
+	for _, name := range replacedNames {
+		if p.removedParts[name] || (path.Ext(name) == ".rels" && p.removedParts[relsSourcePart(name)]) {
+			log.Debugln("replaced part", name, "has been removed, skip it")
+			continue
+		}
+		log.Debugln("add replaced part", name)
+		if err := outz.WritePart(name, p.replacedParts[name]); err != nil {
+			return err
+		}
+	}
 
-	// rewrite content types
-	fo, err := outz.Create("[Content_Types].xml")
-	if err != nil {
-		log.Fatal(err)
+	// rewrite all rels
+	if err := p.saveAllRelationships(p.slideRels, "slide", p.removedSlides, outz); err != nil {
+		return err
+	}
+	if err := p.saveAllRelationships(p.slideLayoutRels, "slideLayout", p.removedLayouts, outz); err != nil {
+		return err
+	}
+	if err := p.saveAllRelationships(p.slideMasterRels, "slideMaster", p.removedMasters, outz); err != nil {
+		return err
+	}
+	if err := saveRelationships(p.presentationRels, "ppt/_rels/presentation.xml.rels", outz); err != nil {
+		return err
+	}
+	for _, source := range p.otherRelsSources() {
+		log.Debugln("new rels for", source)
+		if err := saveRelationships(p.otherRels[source], relsPartName(source), outz); err != nil {
+			return err
+		}
 	}
-	xmlout, _ := xml.Marshal(p.contentTypes)
-	fo.Write([]byte(xmlHeader))
-	fo.Write(xmlout)
 
 	// rewrite slide masters
 	for i, sm := range p.slideMasters {
-		if sm == nil {
+		if p.mediaOnly {
+			break
+		}
+		if sm == nil || p.IsMasterRemoved(i) {
 			log.Debugln("slide master", i+1, "has been removed")
 			continue
 		}
-		fo, err := outz.Create(fmt.Sprintf("ppt/slideMasters/slideMaster%d.xml", i+1))
-		if err != nil {
-			log.Fatal(err)
+		if err := p.writeDocument(outz, fmt.Sprintf("ppt/slideMasters/slideMaster%d.xml", i+1), sm); err != nil {
+			return err
 		}
-		sm.WriteTo(fo)
 	}
 
-	// rewrite presentation
-	fo, err = outz.Create("ppt/presentation.xml")
+	// rewrite edited parts
+	partNames := make([]string, 0, len(p.parts))
+	for name := range p.parts {
+		partNames = append(partNames, name)
+	}
+	sort.Strings(partNames)
+	for _, name := range partNames {
+		log.Debugln("rewrite part", name)
+		if err := p.writeDocument(outz, name, p.parts[name]); err != nil {
+			return err
+		}
+	}
+
+	if err := p.saveAudit(outz); err != nil {
+		return err
+	}
+	if err := p.saveOriginals(outz); err != nil {
+		return err
+	}
+	if err := saveRelationships(p.packageRels, "_rels/.rels", outz); err != nil {
+		return err
+	}
+
+	// rewrite presentation, only when edited to keep its original form
+	if p.presentationEdit {
+		if err := p.writeDocument(outz, "ppt/presentation.xml", p.presentation); err != nil {
+			return err
+		}
+	}
+
+	// rewrite content types last, matching the parts actually written
+	p.contentTypes.Normalize(outz.Names())
+	xmlout, _ := xml.Marshal(p.contentTypes)
+	return outz.WritePart("[Content_Types].xml", append([]byte(xmlHeader), xmlout...))
+}
+
+func (p *PowerpointDoc) hasSourcePart(name string) bool {
+	for _, f := range p.sourceFileReader.File {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *PowerpointDoc) MediaNames() []string {
+	names := make([]string, 0, len(p.medias))
+	for k := range p.medias {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (p *PowerpointDoc) OpenMedia(name string) (io.ReadCloser, error) {
+	if m, ok := p.medias[name]; ok && m.file != "" {
+		return os.Open(m.file)
+	} else if ok && m.data != nil {
+		return ioutil.NopCloser(bytes.NewReader(m.data)), nil
+	}
+	for _, f := range p.sourceFileReader.File {
+		if f.Name == name {
+			return f.Open()
+		}
+	}
+	return nil, errors.New("no media " + name)
+}
+
+func (p *PowerpointDoc) ReadMedia(name string) ([]byte, error) {
+	mf, err := p.OpenMedia(name)
+	if err != nil {
+		return nil, p.mediaReadError(name, err)
+	}
+	defer mf.Close()
+	data, err := ioutil.ReadAll(mf)
 	if err != nil {
-		log.Fatal(err)
+		return nil, p.mediaReadError(name, err)
 	}
-	p.presentation.WriteTo(fo)
+	return data, nil
+}
 
-	return nil
+// mediaReadError wraps the error of reading a media, an entry of the source file being a *PartError
+func (p *PowerpointDoc) mediaReadError(name string, err error) error {
+	if m, ok := p.medias[name]; ok && (m.file != "" || m.data != nil) {
+		return fmt.Errorf("cannot read media %s: %w", name, err)
+	}
+	return &PartError{Part: name, Err: err}
 }
 
-func (p *PowerpointDoc) GetSlideMediaSize() {
+// SlideMediaSizes returns the total size of the pictures, audio and videos of each slide
+func (p *PowerpointDoc) SlideMediaSizes() []uint64 {
+	sizes := make([]uint64, len(p.slideRels))
 	for i, r := range p.slideRels {
-		slideSize := uint64(0)
+		if p.IsSlideRemoved(i) {
+			continue
+		}
+		counted := make(map[string]bool)
 		for _, r2 := range r.Relationship {
-			if r2.Type == "http://schemas.openxmlformats.org/officeDocument/2006/relationships/image" {
-				slideSize += p.medias["ppt/media/"+filepath.Base(r2.Target)].size
+			if (r2.Is("image") || r2.isMediaFile()) && r2.TargetMode != "External" {
+				// a video is referenced by both a media and a video relationship
+				target := resolveTarget(partName("slide", i), r2.Target)
+				if !counted[target] {
+					counted[target] = true
+					sizes[i] += p.medias[target].size
+				}
 			}
 		}
+	}
+	return sizes
+}
+
+func (p *PowerpointDoc) GetSlideMediaSize() {
+	for i, slideSize := range p.SlideMediaSizes() {
 		log.Debugln("slide", i+1, "total media size", slideSize)
 	}
 }
 
-func (p *PowerpointDoc) ConvertPictures() {
-	for _, f := range p.sourceFileReader.File {
-		if strings.HasPrefix(f.Name, "ppt/media/") {
-			log.Debugln("media file", f.Name, f.UncompressedSize64)
-			if strings.ToLower(filepath.Ext(f.Name)) == ".tiff" {
-				log.Infoln("converting media", f.Name, f.UncompressedSize64, "to png ...")
-				tiffFile, err := f.Open()
-				if err != nil {
-					log.Fatal(err)
-				}
-				defer tiffFile.Close()
-				tiffimg, err := tiff.Decode(tiffFile)
-				if err != nil {
-					log.Fatal(err)
-				}
-				pngout := bytes.NewBuffer(nil)
-				err = png.Encode(pngout, tiffimg)
-				if err != nil {
-					log.Fatal(err)
-				}
-				newfilename := strings.Replace(f.Name, ".tiff", ".png", 1)
-				p.medias[newfilename] = Media{size: uint64(pngout.Len()), data: pngout.Bytes()}
-				delete(p.medias, f.Name)
-				for i := range p.slideRels {
-					p.slideRels[i].ReplaceTarget(filepath.Base(f.Name), strings.Replace(filepath.Base(f.Name), ".tiff", ".png", 1))
-				}
-				for i := range p.slideLayoutRels {
-					p.slideLayoutRels[i].ReplaceTarget(filepath.Base(f.Name), strings.Replace(filepath.Base(f.Name), ".tiff", ".png", 1))
-				}
-				for i := range p.slideMasterRels {
-					p.slideMasterRels[i].ReplaceTarget(filepath.Base(f.Name), strings.Replace(filepath.Base(f.Name), ".tiff", ".png", 1))
-				}
-				log.Infoln("converted media", newfilename, p.medias[newfilename].size)
+// RenameMedia moves a media to a new part name and retargets all relationships to it
+func (p *PowerpointDoc) RenameMedia(oldname string, newname string, m Media) {
+	delete(p.medias, oldname)
+	p.medias[newname] = m
+	if p.mediaTail[oldname] {
+		delete(p.mediaTail, oldname)
+		p.mediaTail[newname] = true
+	}
+	if f, ok := p.convertedFormats[oldname]; ok {
+		delete(p.convertedFormats, oldname)
+		p.convertedFormats[newname] = f
+	}
+	for i := range p.slideRels {
+		p.slideRels[i].ReplaceTarget(partName("slide", i), oldname, newname)
+	}
+	for i := range p.slideLayoutRels {
+		p.slideLayoutRels[i].ReplaceTarget(partName("slideLayout", i), oldname, newname)
+	}
+	for i := range p.slideMasterRels {
+		p.slideMasterRels[i].ReplaceTarget(partName("slideMaster", i), oldname, newname)
+	}
+	for _, source := range p.otherRelsSources() {
+		r := p.otherRels[source]
+		r.ReplaceTarget(source, oldname, newname)
+		p.otherRels[source] = r
+	}
+}
+
+func convertTiffToPNG(data []byte) ([]byte, error) {
+	tiffimg, err := tiff.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	pngout := bytes.NewBuffer(nil)
+	err = png.Encode(pngout, tiffimg)
+	if err != nil {
+		return nil, err
+	}
+	return pngout.Bytes(), nil
+}
+
+// convertTiffWithTool converts a tiff the internal decoder does not support with an external converter
+func convertTiffWithTool(tool string, data []byte) ([]byte, error) {
+	out, err := runExternalTool(tool, "tiff", data, "", outputInPlace)
+	if err != nil {
+		return nil, err
+	}
+	if sniffImageFormat(out) != "png" {
+		return nil, errors.New("converter did not produce a png")
+	}
+	return out, nil
+}
+
+// ConvertPictures converts tiff pictures to png, with the external tiffTool when they cannot be decoded,
+// tiffs that cannot be converted are left as is
+func (p *PowerpointDoc) ConvertPictures(fixExtensions bool, tiffTool string) {
+	for _, name := range p.MediaNames() {
+		log.Debugln("media file", name, p.medias[name].size)
+		if p.isMediaKept(name) {
+			continue
+		}
+		format, err := p.SniffMedia(name)
+		if err != nil {
+			p.Problem(err)
+			continue
+		}
+		format = p.checkMediaFormat(name, format)
+		if format == "tiff" {
+			data, err := p.ReadMedia(name)
+			if err != nil {
+				p.Problem(err)
+				continue
+			}
+			log.Infoln("converting media", name, len(data), "to png ...")
+			pngdata, err := convertTiffToPNG(data)
+			if err != nil && tiffTool != "" {
+				log.Infoln("cannot decode media", name, ":", err, ", use tiff converter")
+				pngdata, err = convertTiffWithTool(tiffTool, data)
+			}
+			if err != nil {
+				p.mediaDecodeFailed(name, err)
+				log.Infoln("media", name, "left as tiff")
+				p.skippedTiffs = append(p.skippedTiffs, name)
+				continue
+			}
+			newfilename := replaceExtension(name, "png")
+			if _, ok := p.medias[newfilename]; ok && newfilename != name {
+				newfilename = p.newMediaName("png")
 			}
+			p.contentTypes.RemoveOverride(name)
+			p.contentTypes.AddDefault("png", imageContentTypes["png"])
+			p.auditMedia(name, newfilename, "converted from tiff to png")
+			p.RenameMedia(name, newfilename, p.newMedia(pngdata))
+			log.Infoln("converted media", newfilename, p.medias[newfilename].size)
+		} else if format != "" && fixExtensions {
+			p.FixMediaExtension(name, format)
+		} else if want := imageContentTypes[format]; want != "" && isGenericContentType(p.contentTypes.ContentTypeOf(name)) {
+			// the other passes sniff the format, only the declared type needs a fix
+			p.fixContentType(name, want)
 		}
 	}
 }
 
+// SkippedTiffs returns the tiff pictures which could not be converted
+func (p *PowerpointDoc) SkippedTiffs() []string {
+	return p.skippedTiffs
+}
+
 func (p *PowerpointDoc) FindUsedLayouts() []bool {
 	usedSlideLayouts := make([]bool, len(p.slideLayoutRels))
-	for _, rels := range p.slideRels {
+	for i, rels := range p.slideRels {
+		if p.IsSlideRemoved(i) {
+			continue
+		}
 		for _, rel := range rels.Relationship {
-			if rel.Type == "http://schemas.openxmlformats.org/officeDocument/2006/relationships/slideLayout" {
+			if rel.Is("slideLayout") {
 				layoutNumber, _ := getObjectNumberFromFilename(rel.Target)
-				usedSlideLayouts[layoutNumber-1] = true
+				if layoutNumber > 0 && layoutNumber <= len(usedSlideLayouts) {
+					usedSlideLayouts[layoutNumber-1] = true
+				}
 			}
 		}
 	}
@@ -383,11 +1001,16 @@ func (p *PowerpointDoc) FindUsedLayouts() []bool {
 
 func (p *PowerpointDoc) FindUsedMasters() []bool {
 	usedSlideMasters := make([]bool, len(p.slideMasterRels))
-	for _, rels := range p.slideLayoutRels {
+	for i, rels := range p.slideLayoutRels {
+		if p.IsLayoutRemoved(i) {
+			continue
+		}
 		for _, rel := range rels.Relationship {
-			if rel.Type == "http://schemas.openxmlformats.org/officeDocument/2006/relationships/slideMaster" {
+			if rel.Is("slideMaster") {
 				masterNumber, _ := getObjectNumberFromFilename(rel.Target)
-				usedSlideMasters[masterNumber-1] = true
+				if masterNumber > 0 && masterNumber <= len(usedSlideMasters) {
+					usedSlideMasters[masterNumber-1] = true
+				}
 			}
 		}
 	}
@@ -397,16 +1020,129 @@ func (p *PowerpointDoc) FindUsedMasters() []bool {
 func removeLayoutFromMaster(master *etree.Document, id string) {
 	for _, e := range master.FindElements(fmt.Sprintf("//p:sldLayoutId[@r:id='%s']", id)) {
 		log.Debugln("found layout id", id, "in master -> remove")
-		if result := e.Parent().RemoveChild(e); result == nil {
-			log.Fatal("cannot remove child !!", *e.Parent(), *e)
+		e.Parent().RemoveChild(e)
+	}
+}
+
+// KeepLayouts protects layouts from removal, by number, by name, or all of them with "all"
+func (p *PowerpointDoc) KeepLayouts(layouts []string) {
+	p.keptLayouts = append(p.keptLayouts, layouts...)
+}
+
+func (p *PowerpointDoc) LayoutName(i int) string {
+	doc, ok := p.parts[partName("slideLayout", i)]
+	if !ok {
+		var err error
+		if doc, err = p.ReadPart(partName("slideLayout", i)); err != nil {
+			p.Problem(err)
 		}
 	}
+	if doc == nil {
+		return ""
+	}
+	if csld := doc.FindElement("//p:cSld"); csld != nil {
+		return csld.SelectAttrValue("name", "")
+	}
+	return ""
+}
+
+func (p *PowerpointDoc) isLayoutKept(i int) bool {
+	if len(p.keptLayouts) == 0 {
+		return false
+	}
+	name := p.LayoutName(i)
+	for _, k := range p.keptLayouts {
+		if k == "all" || k == strconv.Itoa(i+1) || (name != "" && strings.EqualFold(k, name)) {
+			return true
+		}
+	}
+	return false
+}
+
+func isRemoved(removed []bool, i int) bool {
+	return i >= 0 && i < len(removed) && removed[i]
+}
+
+func markRemoved(removed []bool, i int) []bool {
+	if i >= len(removed) {
+		removed = append(removed, make([]bool, i+1-len(removed))...)
+	}
+	removed[i] = true
+	return removed
+}
+
+func (p *PowerpointDoc) IsSlideRemoved(i int) bool {
+	return isRemoved(p.removedSlides, i)
+}
+
+func (p *PowerpointDoc) IsLayoutRemoved(i int) bool {
+	return isRemoved(p.removedLayouts, i)
+}
+
+func (p *PowerpointDoc) IsMasterRemoved(i int) bool {
+	return isRemoved(p.removedMasters, i)
+}
+
+// IsSigned returns true if the source file has digital signature parts
+func (p *PowerpointDoc) IsSigned() bool {
+	return len(p.signatures) > 0
+}
+
+// SlideCount returns the number of slides listed in the presentation
+func (p *PowerpointDoc) SlideCount() int {
+	return len(p.presentation.FindElements("//p:sldIdLst/p:sldId"))
 }
 
 func (p *PowerpointDoc) RemoveUnusedLayouts() {
+	p.removeUnusedLayouts(func(i int) bool { return true })
+}
+
+// MasterLayouts returns the indexes of the layouts belonging to a master, according to its relationships
+func (p *PowerpointDoc) MasterLayouts(master int) []int {
+	var layouts []int
+	if master < 0 || master >= len(p.slideMasterRels) {
+		return layouts
+	}
+	for _, rel := range p.slideMasterRels[master].Relationship {
+		if rel.Is("slideLayout") {
+			if n, err := getObjectNumberFromFilename(resolveTarget(partName("slideMaster", master), rel.Target)); err == nil {
+				layouts = append(layouts, n-1)
+			}
+		}
+	}
+	return layouts
+}
+
+// RemoveUnusedLayoutsForMaster removes the unused layouts of one master only
+func (p *PowerpointDoc) RemoveUnusedLayoutsForMaster(master int) {
+	if master < 0 || master >= len(p.slideMasterRels) || p.IsMasterRemoved(master) {
+		log.Warnln("no slide master", master+1)
+		return
+	}
+	owned := make(map[int]bool)
+	for _, i := range p.MasterLayouts(master) {
+		owned[i] = true
+	}
+	p.removeUnusedLayouts(func(i int) bool { return owned[i] })
+}
+
+// removeUnusedLayouts removes the unused layouts selected by the filter
+func (p *PowerpointDoc) removeUnusedLayouts(selected func(i int) bool) {
+	if p.xmlLocked("remove unused layouts") {
+		return
+	}
+	if p.SlideCount() == 0 {
+		// removing everything would gut a blank template
+		log.Warnln("presentation has no slides, keep all layouts and masters")
+		return
+	}
 	usedSlideLayouts := p.FindUsedLayouts()
 	for i, b := range usedSlideLayouts {
-		if !b { // unused -> remove
+		if p.IsLayoutRemoved(i) || !selected(i) {
+			continue
+		} else if !b && p.isLayoutKept(i) {
+			log.Infoln("keep unused slide layout", i+1, p.LayoutName(i))
+		} else if !b { // unused -> remove
 			log.Infoln("remove unused slide layout", i+1)
 
 			// remove from content types
@@ -421,7 +1157,7 @@ func (p *PowerpointDoc) RemoveUnusedLayouts() {
 			// remove from slide master
 			for j, relsm := range p.slideMasterRels {
 				for k, relm := range relsm.Relationship {
-					if relm.Target == fmt.Sprintf("../slideLayouts/slideLayout%d.xml", i+1) {
+					if resolveTarget(partName("slideMaster", j), relm.Target) == partName("slideLayout", i) {
 						layoutid := relm.Id
 						removeLayoutFromMaster(p.slideMasters[j], layoutid) // remove layout reference in slide master xml
 						copy(p.slideMasterRels[j].Relationship[k:], p.slideMasterRels[j].Relationship[k+1:])
@@ -433,6 +1169,8 @@ func (p *PowerpointDoc) RemoveUnusedLayouts() {
 
 			// remove slide layout itself
 			p.slideLayoutRels[i] = Relationships{}
+			p.removedLayouts = markRemoved(p.removedLayouts, i)
+			delete(p.parts, fmt.Sprintf("ppt/slideLayouts/slideLayout%d.xml", i+1))
 		}
 	}
 }
@@ -440,16 +1178,19 @@ func (p *PowerpointDoc) RemoveUnusedLayouts() {
 func removeMasterFromPresentation(presentation *etree.Document, id string) {
 	for _, e := range presentation.FindElements(fmt.Sprintf("//p:sldMasterId[@r:id='%s']", id)) {
 		log.Debugln("found master id", id, "in presentation -> remove")
-		if result := e.Parent().RemoveChild(e); result == nil {
-			log.Fatal("cannot remove child !!", *e.Parent(), *e)
-		}
+		e.Parent().RemoveChild(e)
 	}
 }
 
 func (p *PowerpointDoc) RemoveUnusedMasters() {
+	if p.xmlLocked("remove unused masters") {
+		return
+	}
 	usedSlideMasters := p.FindUsedMasters()
 	for i, b := range usedSlideMasters {
-		if !b { // unused -> remove
+		if p.IsMasterRemoved(i) {
+			continue
+		} else if !b { // unused -> remove
 			log.Infoln("remove unused slide master", i+1)
 
 			// remove from content types
@@ -463,9 +1204,10 @@ func (p *PowerpointDoc) RemoveUnusedMasters() {
 
 			// remove from presentation
 			for k, relm := range p.presentationRels.Relationship {
-				if relm.Target == fmt.Sprintf("slideMasters/slideMaster%d.xml", i+1) {
+				if resolveTarget("ppt/presentation.xml", relm.Target) == partName("slideMaster", i) {
 					layoutid := relm.Id
 					removeMasterFromPresentation(p.presentation, layoutid) // remove master reference in presentation xml
+					p.presentationEdit = true
 					copy(p.presentationRels.Relationship[k:], p.presentationRels.Relationship[k+1:])
 					p.presentationRels.Relationship = p.presentationRels.Relationship[:len(p.presentationRels.Relationship)-1]
 					break
@@ -474,30 +1216,272 @@ func (p *PowerpointDoc) RemoveUnusedMasters() {
 
 			// remove slide master itself
 			p.slideMasterRels[i] = Relationships{}
-			p.slideMasters[i] = nil
+			p.removedMasters = markRemoved(p.removedMasters, i)
 		}
 	}
 }
 
+// forEachPartRels calls f with the relationships of the remaining slides, layouts, masters and other parts
+// referencing medias, in order, or given kinds such as "slide" or "notesSlide", only those of the parts of these kinds.
+// Changes f makes to the relationships are kept.
+func (p *PowerpointDoc) forEachPartRels(f func(source string, rels *Relationships), kinds ...string) {
+	allrels := map[string][]Relationships{"slide": p.slideRels, "slideLayout": p.slideLayoutRels, "slideMaster": p.slideMasterRels}
+	removed := map[string][]bool{"slide": p.removedSlides, "slideLayout": p.removedLayouts, "slideMaster": p.removedMasters}
+	for _, reltype := range numberedKinds {
+		for i := range allrels[reltype] {
+			if name := partName(reltype, i); !isRemoved(removed[reltype], i) && (len(kinds) == 0 || isPartOfKind(name, kinds)) {
+				f(name, &allrels[reltype][i])
+			}
+		}
+	}
+	for _, source := range p.otherRelsSources() {
+		if len(kinds) == 0 || isPartOfKind(source, kinds) {
+			rels := p.otherRels[source]
+			f(source, &rels)
+			p.otherRels[source] = rels
+		}
+	}
+}
+
+// forEachCopiedRels calls f with the relationships copied verbatim, of the parts which are not removed,
+// and failed with those which cannot be parsed. Changes f makes to the relationships are lost, unless it
+// stores them in replacedParts.
+func (p *PowerpointDoc) forEachCopiedRels(f func(source string, rels *Relationships), failed func(source string, err error)) {
+	for _, file := range p.sourceFileReader.File {
+		source := relsSourcePart(file.Name)
+		if path.Ext(file.Name) != ".rels" || isParsedRels(file.Name) || p.removedParts[source] {
+			continue
+		}
+		rels, err := p.copiedRelationships(file)
+		if err != nil {
+			failed(source, err)
+			continue
+		}
+		f(source, &rels)
+	}
+}
+
+// addMediasOutsideMediaDir adds the pictures, audio and videos stored outside ppt/media to the medias, by their
+// actual part name, such as media/image1.png at the root of the package or ppt/slides/media/image1.png
+func (p *PowerpointDoc) addMediasOutsideMediaDir() {
+	sizes := make(map[string]uint64, len(p.sourceFileReader.File))
+	for _, f := range p.sourceFileReader.File {
+		sizes[f.Name] = f.UncompressedSize64
+	}
+	p.forEachPartRels(func(source string, rels *Relationships) {
+		for _, rel := range rels.Relationship {
+			if (!rel.Is("image") && !rel.isMediaFile()) || rel.TargetMode == "External" {
+				continue
+			}
+			target := resolveTarget(source, rel.Target)
+			size, ok := sizes[target]
+			if _, known := p.medias[target]; known || !ok {
+				continue
+			}
+			log.Debugln("media", target, "of", source, "is outside ppt/media")
+			p.medias[target] = Media{size: size}
+			p.mediaParts[target] = true
+		}
+	})
+}
+
 func (p *PowerpointDoc) FindUsedMedias() map[string]bool {
 	usedMedias := make(map[string]bool)
-	allrels := append(p.slideRels, p.slideLayoutRels...)
-	allrels = append(allrels, p.slideMasterRels...)
-	for _, rels := range allrels {
+	// any relationship type: audio and video use both a media relationship and an audio or video one,
+	// usually to the same file, so removing either breaks playback
+	use := func(source string, rels *Relationships) {
 		for _, rel := range rels.Relationship {
-			if rel.Type == "http://schemas.openxmlformats.org/officeDocument/2006/relationships/image" {
-				usedMedias["ppt/media/"+filepath.Base(rel.Target)] = true
+			if rel.TargetMode != "External" {
+				usedMedias[resolveTarget(source, rel.Target)] = true
 			}
 		}
 	}
+	p.forEachPartRels(use)
+	// rels copied verbatim, such as those of the vml drawings referencing the emf previews of ole objects
+	p.forEachCopiedRels(use, func(source string, err error) {
+		log.Warnln(err, ", keep all medias")
+		for name := range p.medias {
+			usedMedias[name] = true
+		}
+	})
 	return usedMedias
 }
 
+// removeRelationshipsTo removes the relationships of a part targeting one of the given parts, and the references
+// to them in its xml, it returns the number of relationships removed
+func (p *PowerpointDoc) removeRelationshipsTo(rels *Relationships, source string, targets map[string]bool, load func() *etree.Document) int {
+	ids := make(map[string]bool)
+	kept := rels.Relationship[:0]
+	for _, rel := range rels.Relationship {
+		if rel.TargetMode != "External" && targets[resolveTarget(source, rel.Target)] {
+			ids[rel.Id] = true
+		} else {
+			kept = append(kept, rel)
+		}
+	}
+	rels.Relationship = kept
+	if len(ids) == 0 {
+		return 0
+	}
+	doc := load()
+	if doc == nil {
+		return len(ids)
+	}
+	for _, e := range doc.FindElements("//*") {
+		for _, attr := range append([]etree.Attr(nil), e.Attr...) {
+			if attr.Space != "" && ids[attr.Value] && relationshipNamespaces[namespaceURI(e, attr.Space)] {
+				e.RemoveAttr(attr.FullKey())
+			}
+		}
+	}
+	return len(ids)
+}
+
+// referencedRelationshipIds returns the relationship ids referenced by the attributes of a document
+func referencedRelationshipIds(doc *etree.Document) map[string]bool {
+	ids := make(map[string]bool)
+	for _, e := range doc.FindElements("//*") {
+		for _, attr := range e.Attr {
+			if attr.Space != "" && relationshipNamespaces[namespaceURI(e, attr.Space)] {
+				ids[attr.Value] = true
+			}
+		}
+	}
+	return ids
+}
+
+// editMediaReferences applies an edit to the xml of the slides, layouts, masters and other parts referencing medias,
+// then removes the relationships it no longer references, and the medias which are no longer used,
+// recorded in the audit with the given reason
+func (p *PowerpointDoc) editMediaReferences(reason string, edit func(doc *etree.Document) bool) {
+	targets := make(map[string]bool)
+	// parts loaded by an earlier pass must still be rewritten
+	loaded := make(map[string]bool, len(p.parts))
+	for name := range p.parts {
+		loaded[name] = true
+	}
+	apply := func(rels *Relationships, source string, doc *etree.Document) {
+		if doc == nil {
+			return
+		}
+		before := referencedRelationshipIds(doc)
+		if !edit(doc) {
+			if !loaded[source] {
+				delete(p.parts, source)
+			}
+			return
+		}
+		after := referencedRelationshipIds(doc)
+		kept := rels.Relationship[:0]
+		for _, rel := range rels.Relationship {
+			// relationships never referenced from the xml, such as the layout of a slide, are kept
+			if before[rel.Id] && !after[rel.Id] {
+				log.Debugln("drop", rel.Target, "from", source)
+				if rel.TargetMode != "External" {
+					targets[resolveTarget(source, rel.Target)] = true
+				}
+			} else {
+				kept = append(kept, rel)
+			}
+		}
+		rels.Relationship = kept
+	}
+	for i := range p.slideRels {
+		if !p.IsSlideRemoved(i) {
+			apply(&p.slideRels[i], partName("slide", i), p.LoadPart(partName("slide", i)))
+		}
+	}
+	for i := range p.slideLayoutRels {
+		if !p.IsLayoutRemoved(i) {
+			apply(&p.slideLayoutRels[i], partName("slideLayout", i), p.LoadPart(partName("slideLayout", i)))
+		}
+	}
+	for i := range p.slideMasterRels {
+		if !p.IsMasterRemoved(i) && i < len(p.slideMasters) {
+			apply(&p.slideMasterRels[i], partName("slideMaster", i), p.slideMasters[i])
+		}
+	}
+	for _, source := range p.otherRelsSources() {
+		rels := p.otherRels[source]
+		apply(&rels, source, p.LoadPart(source))
+		p.otherRels[source] = rels
+	}
+
+	used := p.FindUsedMedias()
+	for _, name := range p.MediaNames() {
+		if targets[name] && !used[name] {
+			log.Infoln("remove", name, ",", reason)
+			p.auditMedia(name, "", "removed "+reason)
+			delete(p.medias, name)
+		}
+	}
+}
+
+// RemoveEmptyMedias removes zero-byte medias, and the relationships and references to them
+func (p *PowerpointDoc) RemoveEmptyMedias() {
+	if p.xmlLocked("remove empty medias") {
+		return
+	}
+	empty := make(map[string]bool)
+	for _, name := range p.MediaNames() {
+		if p.medias[name].size == 0 {
+			empty[name] = true
+		}
+	}
+	if len(empty) == 0 {
+		return
+	}
+
+	for i := range p.slideRels {
+		if !p.IsSlideRemoved(i) {
+			name := partName("slide", i)
+			if p.removeRelationshipsTo(&p.slideRels[i], name, empty, func() *etree.Document { return p.LoadPart(name) }) > 0 {
+				log.Warnln("slide", i+1, "referenced an empty media")
+			}
+		}
+	}
+	for i := range p.slideLayoutRels {
+		if !p.IsLayoutRemoved(i) {
+			name := partName("slideLayout", i)
+			if p.removeRelationshipsTo(&p.slideLayoutRels[i], name, empty, func() *etree.Document { return p.LoadPart(name) }) > 0 {
+				log.Warnln("layout", i+1, "referenced an empty media")
+			}
+		}
+	}
+	for i := range p.slideMasterRels {
+		if !p.IsMasterRemoved(i) && i < len(p.slideMasters) {
+			doc := p.slideMasters[i]
+			if p.removeRelationshipsTo(&p.slideMasterRels[i], partName("slideMaster", i), empty, func() *etree.Document { return doc }) > 0 {
+				log.Warnln("master", i+1, "referenced an empty media")
+			}
+		}
+	}
+	for _, source := range p.otherRelsSources() {
+		rels := p.otherRels[source]
+		if p.removeRelationshipsTo(&rels, source, empty, func() *etree.Document { return p.LoadPart(source) }) > 0 {
+			log.Warnln(source, "referenced an empty media")
+		}
+		p.otherRels[source] = rels
+	}
+
+	for _, name := range p.MediaNames() {
+		if empty[name] {
+			log.Infoln("remove empty media", name)
+			p.auditMedia(name, "", "removed empty media")
+			delete(p.medias, name)
+		}
+	}
+}
+
 func (p *PowerpointDoc) RemoveUnusedMedias() {
+	if !p.mediaOnly {
+		p.RemoveEmptyMedias()
+	}
 	usedMedias := p.FindUsedMedias()
-	for k := range p.medias {
+	for _, k := range p.MediaNames() {
 		if _, ok := usedMedias[k]; !ok {
 			log.Infoln("remove unused media", k)
+			p.auditMedia(k, "", "removed unused media")
 			delete(p.medias, k)
 		}
 	}
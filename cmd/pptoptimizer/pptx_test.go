@@ -0,0 +1,608 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFindUsedMediasLeavesRelationshipsUntouched(t *testing.T) {
+	d := newTestDeck(2)
+	d.image("ppt/slides/slide1.xml", "ppt/media/image1.png", testPNG(8, 8))
+	d.image("ppt/slideLayouts/slideLayout1.xml", "ppt/media/image2.png", testPNG(9, 8))
+	d.image("ppt/slideMasters/slideMaster1.xml", "ppt/media/image3.png", testPNG(10, 8))
+	d.addBytes("ppt/media/image4.png", "", testPNG(11, 8))
+	p := d.parse(t)
+	// spare capacity, which an append to the slide rels would write into
+	p.slideRels = append(make([]Relationships, 0, 8), p.slideRels...)
+	slideRels := cloneRelationships(p.slideRels)
+	layoutRels := cloneRelationships(p.slideLayoutRels)
+
+	for i := 0; i < 2; i++ {
+		used := p.FindUsedMedias()
+		for _, name := range []string{"ppt/media/image1.png", "ppt/media/image2.png", "ppt/media/image3.png"} {
+			if !used[name] {
+				t.Errorf("%s not found used", name)
+			}
+		}
+		if used["ppt/media/image4.png"] {
+			t.Error("unreferenced media found used")
+		}
+	}
+	if !reflect.DeepEqual(p.slideRels, slideRels) || !reflect.DeepEqual(p.slideLayoutRels, layoutRels) {
+		t.Errorf("relationships changed:\n%v\nwant:\n%v", p.slideRels, slideRels)
+	}
+	for i, r := range p.slideRels[len(p.slideRels):cap(p.slideRels)] {
+		if len(r.Relationship) > 0 {
+			t.Errorf("spare slide rels %d written: %v", i, r)
+		}
+	}
+}
+
+func TestRemovedDiffersFromEmpty(t *testing.T) {
+	d := newTestDeck(3)
+	d.layout(false)          // layout 2, unused
+	orphan := d.layout(true) // layout 3, without relationships, used by slide 2
+	d.add("ppt/slideMasters/slideMaster2.xml", relationshipContentTypes["slideMaster"], `<p:sldMaster `+testNamespaces+`><p:cSld><p:spTree/></p:cSld></p:sldMaster>`)
+	d.rels["ppt/slides/slide2.xml"][0].Target = "../slideLayouts/slideLayout3.xml"
+	// slide 3 without any relationship
+	delete(d.rels, "ppt/slides/slide3.xml")
+	p := d.parse(t)
+	p.RemoveUnusedLayouts()
+	p.RemoveUnusedMasters()
+
+	for i, want := range []bool{false, true, false} {
+		if got := p.IsLayoutRemoved(i); got != want {
+			t.Errorf("layout %d removed: %v, want %v", i+1, got, want)
+		}
+	}
+	// the second master has no relationships at all, it is present, not removed
+	if p.IsMasterRemoved(0) || p.IsMasterRemoved(1) {
+		t.Errorf("masters removed: %v, want none", p.removedMasters)
+	}
+	if p.IsSlideRemoved(0) || p.IsSlideRemoved(1) || p.IsSlideRemoved(2) {
+		t.Errorf("slides removed: %v, want none", p.removedSlides)
+	}
+
+	_, parts := saveTestFile(t, p)
+	for name, want := range map[string]bool{
+		"ppt/slides/slide1.xml":             true,
+		"ppt/slides/slide2.xml":             true,
+		"ppt/slides/slide3.xml":             true,
+		"ppt/slideLayouts/slideLayout1.xml": true,
+		"ppt/slideLayouts/slideLayout2.xml": false,
+		orphan:                              true,
+		"ppt/slideMasters/slideMaster1.xml": true,
+		"ppt/slideMasters/slideMaster2.xml": true,
+	} {
+		if got := parts[name] != nil; got != want {
+			t.Errorf("%s in output: %v, want %v", name, got, want)
+		}
+	}
+	assertReferencesResolve(t, parts)
+}
+
+func TestMarkRemoved(t *testing.T) {
+	var removed []bool
+	if isRemoved(removed, 0) || isRemoved(removed, -1) {
+		t.Error("nothing marked, found removed")
+	}
+	removed = markRemoved(removed, 3)
+	removed = markRemoved(removed, 1)
+	for i, want := range []bool{false, true, false, true, false} {
+		if got := isRemoved(removed, i); got != want {
+			t.Errorf("%d removed: %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestResolveTarget(t *testing.T) {
+	tests := []struct {
+		source, target, want string
+	}{
+		{"ppt/slides/slide1.xml", "../media/image1.png", "ppt/media/image1.png"},
+		{"ppt/slides/slide1.xml", "/ppt/media/image1.png", "ppt/media/image1.png"},
+		{"ppt/slides/slide1.xml", "/ppt/slides/../media/image1.png", "ppt/media/image1.png"},
+		{"ppt/presentation.xml", "slides/slide1.xml", "ppt/slides/slide1.xml"},
+		{"ppt/presentation.xml", "/ppt/slides/slide1.xml", "ppt/slides/slide1.xml"},
+		{"", "ppt/presentation.xml", "ppt/presentation.xml"},
+		{"", "/ppt/presentation.xml", "ppt/presentation.xml"},
+		{"ppt/slides/slide1.xml", "../media/image%20one.png", "ppt/media/image one.png"},
+		{"ppt/slides/slide1.xml", "/ppt/media/image%20one.png", "ppt/media/image one.png"},
+		{"ppt/slides/slide1.xml", "../media/image1.png#frame2", "ppt/media/image1.png"},
+		{"ppt/slides/slide1.xml", "slide3.xml#slide", "ppt/slides/slide3.xml"},
+		{"ppt/slides/slide1.xml", "../media/100%25.png", "ppt/media/100%.png"},
+	}
+	for _, tt := range tests {
+		if got := resolveTarget(tt.source, tt.target); got != tt.want {
+			t.Errorf("resolveTarget(%s, %s) = %s, want %s", tt.source, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestReplaceTargetKeepsForm(t *testing.T) {
+	rels := Relationships{Relationship: []Relationship{
+		{Id: "rId1", Target: "../media/image1.png"},
+		{Id: "rId2", Target: "/ppt/media/image1.png"},
+		{Id: "rId3", Target: "../media/image2.png"},
+		{Id: "rId4", Target: "https://example.com/ppt/media/image1.png", TargetMode: "External"},
+	}}
+	rels.ReplaceTarget("ppt/slides/slide1.xml", "ppt/media/image1.png", "ppt/media/image1.jpeg")
+	for i, want := range []string{"../media/image1.jpeg", "/ppt/media/image1.jpeg", "../media/image2.png", "https://example.com/ppt/media/image1.png"} {
+		if got := rels.Relationship[i].Target; got != want {
+			t.Errorf("target %d is %s, want %s", i+1, got, want)
+		}
+	}
+	// to another directory, the target becomes absolute
+	rels.ReplaceTarget("ppt/slides/slide1.xml", "ppt/media/image2.png", "ppt/images/image2.png")
+	if got := rels.Relationship[2].Target; got != "/ppt/images/image2.png" {
+		t.Errorf("target moved to another directory is %s, want /ppt/images/image2.png", got)
+	}
+}
+
+func TestAbsoluteTargets(t *testing.T) {
+	d := newTestDeck(2)
+	d.addBytes("ppt/media/image1.png", "", testPNG(20, 20))
+	d.picture("ppt/slides/slide1.xml", "r:embed", d.rel("ppt/slides/slide1.xml", "image", "/ppt/media/image1.png"))
+	d.image("ppt/slides/slide2.xml", "ppt/media/image2.png", testPNG(10, 20))
+	d.addBytes("ppt/media/image3.png", "", testPNG(30, 20))
+	p := d.parse(t)
+	p.SetMediaFormats(map[string]MediaFormat{"image1.png": {Format: "jpeg"}})
+	p.ConvertMediaFormats()
+	p.RemoveUnusedMedias()
+
+	_, parts := saveTestFile(t, p)
+	assertReferencesResolve(t, parts)
+	if parts["ppt/media/image1.jpeg"] == nil || parts["ppt/media/image2.png"] == nil || parts["ppt/media/image3.png"] != nil {
+		t.Errorf("medias of the output: image1.jpeg %v, image2.png %v, image3.png %v, want true true false",
+			parts["ppt/media/image1.jpeg"] != nil, parts["ppt/media/image2.png"] != nil, parts["ppt/media/image3.png"] != nil)
+	}
+	if !strings.Contains(string(parts["ppt/slides/_rels/slide1.xml.rels"]), `Target="/ppt/media/image1.jpeg"`) {
+		t.Errorf("absolute target not kept absolute:\n%s", parts["ppt/slides/_rels/slide1.xml.rels"])
+	}
+	if !strings.Contains(string(parts["ppt/slides/_rels/slide2.xml.rels"]), `Target="../media/image2.png"`) {
+		t.Errorf("relative target not kept relative:\n%s", parts["ppt/slides/_rels/slide2.xml.rels"])
+	}
+}
+
+func TestDiagramMediasKept(t *testing.T) {
+	d := newTestDeck(1)
+	d.add("ppt/diagrams/data1.xml", "application/vnd.openxmlformats-officedocument.drawingml.diagramData+xml",
+		`<dgm:dataModel xmlns:dgm="http://schemas.openxmlformats.org/drawingml/2006/diagram" `+testNamespaces+`>`+
+			`<dgm:ptLst><dgm:pt modelId="1"><dgm:spPr><a:blipFill><a:blip r:embed="rId1"/></a:blipFill></dgm:spPr></dgm:pt></dgm:ptLst></dgm:dataModel>`)
+	d.rel("ppt/diagrams/data1.xml", "image", "../media/image1.png")
+	d.addBytes("ppt/media/image1.png", "", testPNG(12, 12))
+	d.add("ppt/diagrams/drawing1.xml", "application/vnd.ms-office.drawingml.diagramDrawing+xml",
+		`<dsp:drawing xmlns:dsp="http://schemas.microsoft.com/office/drawing/2008/diagram" `+testNamespaces+`>`+
+			`<dsp:spTree><dsp:sp><dsp:spPr><a:blipFill><a:blip r:embed="rId1"/></a:blipFill></dsp:spPr></dsp:sp></dsp:spTree></dsp:drawing>`)
+	d.rel("ppt/diagrams/drawing1.xml", "image", "../media/image2.png")
+	d.addBytes("ppt/media/image2.png", "", testPNG(14, 12))
+	d.rel("ppt/slides/slide1.xml", "diagramData", "../diagrams/data1.xml")
+	d.rels["ppt/slides/slide1.xml"] = append(d.rels["ppt/slides/slide1.xml"],
+		Relationship{Id: "rId3", Type: "http://schemas.microsoft.com/office/2007/relationships/diagramDrawing", Target: "../diagrams/drawing1.xml"})
+	d.addBytes("ppt/media/image3.png", "", testPNG(16, 12))
+	p := d.parse(t)
+	p.RemoveUnusedMedias()
+
+	_, parts := saveTestFile(t, p)
+	assertReferencesResolve(t, parts)
+	for name, want := range map[string]bool{"ppt/media/image1.png": true, "ppt/media/image2.png": true, "ppt/media/image3.png": false} {
+		if got := parts[name] != nil; got != want {
+			t.Errorf("%s in output: %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestPercentEncodedTargets(t *testing.T) {
+	d := newTestDeck(1)
+	d.addBytes("ppt/media/image one.png", "", testPNG(20, 20))
+	d.picture("ppt/slides/slide1.xml", "r:embed", d.rel("ppt/slides/slide1.xml", "image", "../media/image%20one.png"))
+	d.addBytes("ppt/media/image two.png", "", testPNG(20, 10))
+	d.picture("ppt/slides/slide1.xml", "r:embed", d.rel("ppt/slides/slide1.xml", "image", "../media/image%20two.png#crop"))
+	d.rel("ppt/slides/slide1.xml", "hyperlink", "https://example.com/a%20b.html#top")
+	d.addBytes("ppt/media/image three.png", "", testPNG(10, 20))
+	p := d.parse(t)
+	used := p.FindUsedMedias()
+	if !used["ppt/media/image one.png"] || !used["ppt/media/image two.png"] || used["ppt/media/image three.png"] {
+		t.Errorf("used medias %v, want image one.png and image two.png", used)
+	}
+	p.SetMediaFormats(map[string]MediaFormat{"image one.png": {Format: "jpeg"}})
+	p.ConvertMediaFormats()
+	p.RemoveUnusedMedias()
+
+	_, parts := saveTestFile(t, p)
+	assertReferencesResolve(t, parts)
+	rels := string(parts["ppt/slides/_rels/slide1.xml.rels"])
+	for _, target := range []string{`Target="../media/image%20one.jpeg"`, `Target="../media/image%20two.png#crop"`, `Target="https://example.com/a%20b.html#top"`} {
+		if !strings.Contains(rels, target) {
+			t.Errorf("%s missing from the slide relationships:\n%s", target, rels)
+		}
+	}
+	if parts["ppt/media/image one.jpeg"] == nil || parts["ppt/media/image two.png"] == nil || parts["ppt/media/image three.png"] != nil {
+		t.Errorf("medias of the output: image one.jpeg %v, image two.png %v, image three.png %v, want true true false",
+			parts["ppt/media/image one.jpeg"] != nil, parts["ppt/media/image two.png"] != nil, parts["ppt/media/image three.png"] != nil)
+	}
+}
+
+func TestPresentationWithoutSlides(t *testing.T) {
+	d := newTestDeck(0)
+	d.layout(false)
+	d.image("ppt/slideLayouts/slideLayout2.xml", "ppt/media/image1.png", testPNG(10, 10))
+	d.image("ppt/slideMasters/slideMaster1.xml", "ppt/media/image2.png", testPNG(12, 10))
+	p := d.parse(t)
+	if p.SlideCount() != 0 {
+		t.Fatalf("%d slides, want none", p.SlideCount())
+	}
+	p.RemoveUnusedLayouts()
+	p.RemoveUnusedMasters()
+	p.RemoveUnusedThemes()
+	p.RemoveUnusedMedias()
+
+	_, parts := saveTestFile(t, p)
+	assertReferencesResolve(t, parts)
+	for _, name := range []string{"ppt/slideLayouts/slideLayout1.xml", "ppt/slideLayouts/slideLayout2.xml", "ppt/slideMasters/slideMaster1.xml",
+		"ppt/theme/theme1.xml", "ppt/media/image1.png", "ppt/media/image2.png"} {
+		if parts[name] == nil {
+			t.Errorf("%s removed from a presentation without slides", name)
+		}
+	}
+}
+
+func TestNonImageMediasPassThrough(t *testing.T) {
+	wav := []byte("RIFF\x24\x00\x00\x00WAVEfmt \x10\x00\x00\x00\x01\x00\x01\x00\x44\xac\x00\x00\x88\x58\x01\x00\x02\x00\x10\x00data\x00\x00\x00\x00")
+	ttf := append([]byte{0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, []byte("not really a font")...)
+	d := newTestDeck(1)
+	d.types.Default = append(d.types.Default, TypeDefault{Extension: "wav", ContentType: "audio/wav"})
+	d.addBytes("ppt/media/sound.wav", "", wav)
+	d.rel("ppt/slides/slide1.xml", "audio", "../media/sound.wav")
+	d.addBytes("ppt/media/font.ttf", "application/x-font-ttf", ttf)
+	d.rel("ppt/slides/slide1.xml", "font", "../media/font.ttf")
+	// a sound with the extension of a picture
+	clip := append(append([]byte(nil), wav...), 0, 0)
+	d.image("ppt/slides/slide1.xml", "ppt/media/clip.png", clip)
+	d.image("ppt/slides/slide1.xml", "ppt/media/image1.png", testPNG(64, 64))
+	p := d.parse(t)
+
+	p.ConvertPictures(true, "")
+	p.FixContentTypes()
+	p.FlattenOpaquePNGs()
+	p.ConvertCMYKJPEGs()
+	p.ReducePNGBitDepth(false)
+	p.StripICCProfiles()
+	p.DownscaleImages(10, defaultScaleFilter)
+	p.RecompressPNGs("")
+	p.DeduplicateMedias()
+	p.RemoveUnusedMedias()
+
+	_, parts := saveTestFile(t, p)
+	assertReferencesResolve(t, parts)
+	for name, data := range map[string][]byte{"ppt/media/sound.wav": wav, "ppt/media/font.ttf": ttf, "ppt/media/clip.png": clip} {
+		if !bytes.Equal(parts[name], data) {
+			t.Errorf("%s changed", name)
+		}
+	}
+	if img := parts["ppt/media/image1.png"]; img == nil || bytes.Equal(img, d.parts["ppt/media/image1.png"]) {
+		t.Errorf("picture not optimized along with the other medias")
+	}
+}
+
+func TestStrictFormat(t *testing.T) {
+	d := newTestDeck(2)
+	d.strict = true
+	d.layout(false) // unused
+	d.image("ppt/slides/slide1.xml", "ppt/media/image1.png", testPNG(10, 10))
+	d.image("ppt/slideLayouts/slideLayout1.xml", "ppt/media/image2.png", testPNG(12, 10))
+	d.image("ppt/slideLayouts/slideLayout2.xml", "ppt/media/image3.png", testPNG(14, 10))
+	d.addBytes("ppt/media/image4.png", "", testPNG(16, 10))
+	d.setRelationshipIds("ppt/slides/slide1.xml", []string{"rId7", "rId3"})
+	p := d.parse(t)
+	if !p.presentationRels.Relationship[0].Is("slideMaster") {
+		t.Fatalf("strict relationship %s not recognized", p.presentationRels.Relationship[0].Type)
+	}
+	if used := p.FindUsedLayouts(); len(used) != 2 || !used[0] || used[1] {
+		t.Errorf("used layouts %v, want [true false]", used)
+	}
+	p.RemoveUnusedLayouts()
+	p.RemoveUnusedMasters()
+	p.RemoveUnusedThemes()
+	p.RemoveUnusedMedias()
+	p.RenumberRelationships()
+
+	_, parts := saveTestFile(t, p)
+	assertReferencesResolve(t, parts)
+	for name, want := range map[string]bool{
+		"ppt/slideLayouts/slideLayout1.xml": true,
+		"ppt/slideLayouts/slideLayout2.xml": false,
+		"ppt/slideMasters/slideMaster1.xml": true,
+		"ppt/theme/theme1.xml":              true,
+		"ppt/media/image1.png":              true,
+		"ppt/media/image2.png":              true,
+		"ppt/media/image3.png":              false,
+		"ppt/media/image4.png":              false,
+	} {
+		if got := parts[name] != nil; got != want {
+			t.Errorf("%s in output: %v, want %v", name, got, want)
+		}
+	}
+	if rels := string(parts["ppt/slides/_rels/slide1.xml.rels"]); strings.Contains(rels, relTypeTransitional) || !strings.Contains(rels, `Id="rId1"`) {
+		t.Errorf("slide relationships not strict or not renumbered:\n%s", rels)
+	}
+}
+
+func TestPairedMediaRelationships(t *testing.T) {
+	d := newTestDeck(2)
+	video := bytes.Repeat([]byte("\x00\x00\x00\x18ftypmp42"), 100)
+	d.addBytes("ppt/media/media1.mp4", "video/mp4", video)
+	slide := "ppt/slides/slide1.xml"
+	link := d.rel(slide, "video", "../media/media1.mp4")
+	embed := d.rel(slide, "", "../media/media1.mp4")
+	d.rels[slide][len(d.rels[slide])-1].Type = mediaRelType
+	poster := d.rel(slide, "image", "../media/image1.png")
+	d.addBytes("ppt/media/image1.png", "", testPNG(16, 9))
+	d.shapes[slide] = append(d.shapes[slide], `<p:pic><p:nvPicPr><p:cNvPr id="2" name="Video"/><p:cNvPicPr/><p:nvPr><a:videoFile r:link="`+link+`"/>`+
+		`<p:extLst><p:ext uri="{DAA4B4D4-6D71-4841-9C94-3DE7FCFB9230}"><p14:media xmlns:p14="http://schemas.microsoft.com/office/powerpoint/2010/main" r:embed="`+embed+`"/></p:ext></p:extLst>`+
+		`</p:nvPr></p:nvPicPr><p:blipFill><a:blip r:embed="`+poster+`"/></p:blipFill><p:spPr/></p:pic>`)
+	d.setRelationshipIds(slide, []string{"rId4", "rId9", "rId2", "rId7"})
+
+	p := d.parse(t)
+	if sizes := p.SlideMediaSizes(); sizes[0] != uint64(len(video)+len(testPNG(16, 9))) {
+		t.Errorf("slide media size %d, want the video counted once", sizes[0])
+	}
+	p.RemoveUnusedMedias()
+	p.DeduplicateMedias()
+	p.RenumberRelationships()
+	_, parts := saveTestFile(t, p)
+
+	assertReferencesResolve(t, parts)
+	if !bytes.Equal(parts["ppt/media/media1.mp4"], video) {
+		t.Error("video removed or changed")
+	}
+	rels := Relationships{}
+	if err := xml.Unmarshal(parts[relsPartName(slide)], &rels); err != nil {
+		t.Fatal(err)
+	}
+	kinds := map[string]int{}
+	for _, rel := range rels.Relationship {
+		if resolveTarget(slide, rel.Target) == "ppt/media/media1.mp4" {
+			kinds[rel.Type]++
+		}
+	}
+	if kinds[mediaRelType] != 1 || kinds[relTypeTransitional+"video"] != 1 {
+		t.Errorf("relationships to the video %v, want one media and one video relationship", kinds)
+	}
+}
+
+func TestMetafilesPassThrough(t *testing.T) {
+	emf := append([]byte{1, 0, 0, 0, 108, 0, 0, 0}, bytes.Repeat([]byte{0}, 32)...)
+	emf = append(emf, []byte(" EMF")...)
+	wmf := []byte{0xd7, 0xcd, 0xc6, 0x9a, 0, 0, 0, 0, 0, 0, 0x40, 0x01, 0xf0, 0}
+	preview := append(append([]byte(nil), emf...), 1)
+	d := newTestDeck(1)
+	d.types.Default = append(d.types.Default, TypeDefault{Extension: "emf", ContentType: "image/x-emf"}, TypeDefault{Extension: "wmf", ContentType: "image/x-wmf"})
+	d.image("ppt/slides/slide1.xml", "ppt/media/image1.emf", emf)
+	d.image("ppt/slideLayouts/slideLayout1.xml", "ppt/media/image2.wmf", wmf)
+	// the preview of an ole object, only referenced by the rels of a vml drawing, which are copied verbatim
+	d.addBytes("ppt/drawings/vmlDrawing1.vml", "", []byte(`<xml xmlns:v="urn:schemas-microsoft-com:vml"><v:shape><v:imagedata o:relid="rId1"/></v:shape></xml>`))
+	d.rel("ppt/drawings/vmlDrawing1.vml", "image", "../media/image3.emf")
+	d.addBytes("ppt/media/image3.emf", "", preview)
+	d.rel("ppt/slides/slide1.xml", "vmlDrawing", "../drawings/vmlDrawing1.vml")
+	p := d.parse(t)
+
+	if removed := p.removalCascade(false, true); removed["ppt/media/image3.emf"] {
+		t.Error("preview of the ole object removed by the cascade")
+	}
+	p.ConvertPictures(true, "")
+	p.FixContentTypes()
+	p.DownscaleImages(10, defaultScaleFilter)
+	p.RecompressPNGs("")
+	p.DeduplicateMedias()
+	p.RemoveUnusedMedias()
+
+	_, parts := saveTestFile(t, p)
+	assertReferencesResolve(t, parts)
+	for name, data := range map[string][]byte{"ppt/media/image1.emf": emf, "ppt/media/image2.wmf": wmf, "ppt/media/image3.emf": preview} {
+		if !bytes.Equal(parts[name], data) {
+			t.Errorf("%s removed or changed", name)
+		}
+	}
+	types := Types{}
+	if err := xml.Unmarshal(parts["[Content_Types].xml"], &types); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"ppt/media/image1.emf":         "image/x-emf",
+		"ppt/media/image2.wmf":         "image/x-wmf",
+		"ppt/drawings/vmlDrawing1.vml": "application/vnd.openxmlformats-officedocument.vmlDrawing",
+	} {
+		if got := types.ContentTypeOf(name); got != want {
+			t.Errorf("content type of %s is %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestSaveFileReturnsErrors(t *testing.T) {
+	d := newTestDeck(1)
+	d.image("ppt/slides/slide1.xml", "ppt/media/image1.png", testPNG(64, 64))
+	p := d.parse(t)
+	p.SetRetries(1, time.Millisecond)
+	if err := p.SaveFile(filepath.Join(t.TempDir(), "missing", "out.pptx")); err == nil {
+		t.Error("no error creating the output in a missing directory")
+	}
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("no /dev/full to fail writes")
+	}
+	for _, stream := range []bool{false, true} {
+		p.SetStreamOrder(stream)
+		if err := p.SaveFile("/dev/full"); err == nil {
+			t.Errorf("stream order %v: no error writing to a full device", stream)
+		}
+	}
+}
+
+// corruptChecksum changes the checksum of an entry in the central directory of a zip file, which then fails to read
+func corruptChecksum(t *testing.T, data []byte, name string) {
+	t.Helper()
+	header := []byte("PK\x01\x02")
+	for i := 0; ; i++ {
+		next := bytes.Index(data[i:], header)
+		if next < 0 {
+			break
+		}
+		i += next
+		n := int(binary.LittleEndian.Uint16(data[i+28:]))
+		if string(data[i+46:i+46+n]) == name {
+			data[i+16] ^= 0xff
+			return
+		}
+	}
+	t.Fatalf("no entry %s", name)
+}
+
+func TestUnreadableMediaIsMalformedPart(t *testing.T) {
+	d := newTestDeck(3)
+	d.image("ppt/slides/slide1.xml", "ppt/media/image1.png", testPNG(64, 64))
+	d.image("ppt/slides/slide2.xml", "ppt/media/image2.png", testPNG(32, 32))
+	d.image("ppt/slides/slide3.xml", "ppt/media/image3.png", testPNG(32, 32))
+	data := d.bytes(t)
+	corruptChecksum(t, data, "ppt/media/image1.png")
+	name := filepath.Join(t.TempDir(), "deck.pptx")
+	if err := ioutil.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	p := parseTestFile(t, name)
+
+	_, err := p.ReadMedia("ppt/media/image1.png")
+	var perr *PartError
+	if !errors.Is(err, ErrMalformedPart) || !errors.As(err, &perr) || perr.Part != "ppt/media/image1.png" {
+		t.Fatalf("reading the corrupted media returned %v, want a malformed part error naming it", err)
+	}
+
+	// the pass skips the corrupted media and goes on with the others
+	if reclaimed := p.DeduplicateMedias(); reclaimed == 0 {
+		t.Error("identical medias not deduplicated after the corrupted one")
+	}
+	if problems := p.Problems(); len(problems) != 1 || !errors.Is(problems[0], ErrMalformedPart) {
+		t.Errorf("problems are %v, want the corrupted media", problems)
+	}
+	if err := p.Err(); !errors.Is(err, ErrMalformedPart) {
+		t.Errorf("run error is %v, want the corrupted media", err)
+	}
+	p.SetBestEffort(true)
+	if err := p.Err(); err != nil {
+		t.Errorf("run error is %v in best effort mode", err)
+	}
+	if err := p.SaveFile(filepath.Join(t.TempDir(), "out.pptx")); !errors.Is(err, ErrMalformedPart) {
+		t.Errorf("saving the corrupted media returned %v, want a malformed part error", err)
+	}
+}
+
+func TestSaveFileNoClobber(t *testing.T) {
+	d := newTestDeck(1)
+	p := d.parse(t)
+	p.SetRetries(1, time.Millisecond)
+	p.SetNoClobber(true)
+	name := filepath.Join(t.TempDir(), "out.pptx")
+	if err := p.SaveFile(name); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(name, []byte("previous run"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SaveFile(name); !errors.Is(err, os.ErrExist) {
+		t.Errorf("saving over an existing file returned %v, want os.ErrExist", err)
+	}
+	if data, err := ioutil.ReadFile(name); err != nil || string(data) != "previous run" {
+		t.Errorf("existing file overwritten: %q, %v", data, err)
+	}
+	p.SetNoClobber(false)
+	if err := p.SaveFile(name); err != nil {
+		t.Errorf("cannot overwrite an existing file: %v", err)
+	}
+}
+
+func TestOptimizeIsDeterministic(t *testing.T) {
+	d := newTestDeck(3)
+	for i := 1; i <= 6; i++ {
+		d.image(fmt.Sprintf("ppt/slides/slide%d.xml", 1+i%3), fmt.Sprintf("ppt/media/image%d.png", 10-i), testPNG(40+i, 30))
+	}
+	d.image("ppt/slides/slide1.xml", "ppt/media/copy.png", testPNG(41, 30))
+	d.image("ppt/slideMasters/slideMaster1.xml", "ppt/media/logo.png", testPNG(12, 12))
+	d.layout(false)
+	d.addBytes("ppt/media/unused.png", "", testPNG(8, 8))
+	d.appProperties(3, testAppProperties)
+	in := d.write(t)
+
+	var outputs [][]byte
+	for run := 0; run < 3; run++ {
+		p := parseTestFile(t, in)
+		p.SetAudit(true)
+		p.SetManifest(true)
+		p.ConvertPictures(true, "")
+		p.FixContentTypes()
+		p.FlattenOpaquePNGs()
+		p.ReducePNGBitDepth(false)
+		p.StripICCProfiles()
+		p.DownscaleImages(10, defaultScaleFilter)
+		p.RecompressPNGs("")
+		p.DeduplicateMedias()
+		p.RemoveSlide(2)
+		p.RemoveUnusedLayouts()
+		p.RemoveUnusedMasters()
+		p.RemoveUnusedThemes()
+		p.RemoveUnusedMedias()
+		p.UpdateAppProperties()
+		p.RenameMediaSequential()
+		p.RenumberRelationships()
+		p.MinifyXML()
+		out, _ := saveTestFile(t, p)
+		data, err := ioutil.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, data)
+	}
+	for run := 1; run < len(outputs); run++ {
+		if !bytes.Equal(outputs[run], outputs[0]) {
+			t.Errorf("output of run %d differs from the first one", run+1)
+		}
+	}
+}
+
+func TestRemoveEmptyMedias(t *testing.T) {
+	d := newTestDeck(2)
+	d.image("ppt/slides/slide1.xml", "ppt/media/image1.png", []byte{})
+	d.image("ppt/slides/slide1.xml", "ppt/media/image2.png", testPNG(8, 8))
+	d.rel("ppt/slides/slide2.xml", "image", "../media/image1.png")
+	d.picture("ppt/slides/slide2.xml", "r:embed", "rId2")
+	p := d.parse(t)
+	p.RemoveEmptyMedias()
+	_, parts := saveTestFile(t, p)
+
+	if _, ok := parts["ppt/media/image1.png"]; ok {
+		t.Error("empty media kept")
+	}
+	if _, ok := parts["ppt/media/image2.png"]; !ok {
+		t.Error("media image2.png removed")
+	}
+	for _, slide := range []string{"ppt/slides/slide1.xml", "ppt/slides/slide2.xml"} {
+		if rels := string(parts[relsPartName(slide)]); strings.Contains(rels, "image1.png") {
+			t.Errorf("%s keeps the relationship to the empty media: %s", slide, rels)
+		}
+	}
+	if slide := string(parts["ppt/slides/slide1.xml"]); strings.Count(slide, "r:embed=") != 1 || !strings.Contains(slide, `r:embed="rId3"`) {
+		t.Errorf("slide1 should only embed image2.png as rId3: %s", slide)
+	}
+	if slide := string(parts["ppt/slides/slide2.xml"]); strings.Contains(slide, "r:embed=") {
+		t.Errorf("slide2 keeps the reference to the empty media: %s", slide)
+	}
+	assertReferencesResolve(t, parts)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Profile is a named combination of optimizations
+type Profile struct {
+	// optimizations enabled as with -a, unless explicitly disabled
+	Enabled []string
+	// lossy or destructive options which cannot be combined with the profile
+	Forbidden []string
+}
+
+var profiles = map[string]Profile{
+	// tidy for projection: lossless conversions and removal of unused parts only, keeping the picture quality,
+	// the notes, transitions, animations and medias needed to present
+	"presenter": {
+		Enabled:   []string{"convert", "fixtypes", "flatten", "recompress", "svg", "layouts", "dedupmedias", "dedupembeddings", "renumber", "minify"},
+		Forbidden: []string{"dpi", "cmyk2rgb", "8bit", "stripicc", "formats", "svgmode", "removenotes", "notransitionsounds"},
+	},
+}
+
+func profileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkProfile returns the profile of a name, or an error if it is unknown or one of its forbidden options
+// is set to another value than its default
+func checkProfile(name string, fs *flag.FlagSet) (Profile, error) {
+	if name == "" {
+		return Profile{}, nil
+	}
+	prof, ok := profiles[name]
+	if !ok {
+		return prof, fmt.Errorf("unknown profile %s, expected %s", name, strings.Join(profileNames(), ", "))
+	}
+	for _, option := range prof.Forbidden {
+		if f := fs.Lookup(option); f != nil && f.Value.String() != f.DefValue {
+			return prof, fmt.Errorf("-%s cannot be used with the %s profile, which keeps the quality and content of the presentation", option, name)
+		}
+	}
+	return prof, nil
+}
+
+// enables tells whether the profile enables an optimization
+func (prof Profile) enables(name string) bool {
+	for _, n := range prof.Enabled {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/binary"
+	"os/exec"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// isProgressiveJPEG tells whether the frame of a jpeg is progressive (SOF2, SOF6, SOF10 or SOF14)
+func isProgressiveJPEG(data []byte) bool {
+	if len(data) < 2 || data[0] != 0xff || data[1] != 0xd8 {
+		return false
+	}
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xff {
+		m := data[pos+1]
+		if m == 0xff { // fill byte
+			pos++
+			continue
+		}
+		if m == 0x01 || (m >= 0xd0 && m <= 0xd7) { // markers without length
+			pos += 2
+			continue
+		}
+		switch m {
+		case 0xc2, 0xc6, 0xca, 0xce:
+			return true
+		case 0xc0, 0xc1, 0xc3, 0xc5, 0xc7, 0xc9, 0xcb, 0xcd, 0xcf, 0xda:
+			return false
+		}
+		pos += 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+	}
+	return false
+}
+
+// ConvertProgressiveJPEGs re-encodes baseline jpegs as progressive with an external tool, since the standard library
+// only writes baseline ones, and keeps the result when it is smaller. jpegtran -progressive does it without loss.
+func (p *PowerpointDoc) ConvertProgressiveJPEGs(tool string) {
+	args := strings.Fields(tool)
+	if len(args) == 0 {
+		log.Warnln("progressive jpeg needs a -jpegtool such as \"jpegtran -progressive -copy all\", skipped")
+		return
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		log.Warnln("jpeg tool", args[0], "not found, progressive jpeg skipped")
+		return
+	}
+	for _, name := range p.MediaNames() {
+		data, format := p.readMediaOfFormat(name, "jpeg")
+		if format == "" || isProgressiveJPEG(data) {
+			continue
+		}
+		out, err := runExternalTool(tool, "jpeg", data, "", outputInPlace)
+		if err != nil {
+			log.Warnln("jpeg tool failed on", name, ":", err)
+			continue
+		}
+		if sniffImageFormat(out) != "jpeg" || !isProgressiveJPEG(out) {
+			log.Warnln("jpeg tool did not produce a progressive jpeg for", name)
+			continue
+		}
+		if len(out) >= len(data) {
+			log.Debugln("progressive jpeg", name, "is not smaller, keep original")
+			continue
+		}
+		log.Infoln("converted", name, "to progressive jpeg", len(data), "->", len(out))
+		p.ReplaceMedia(name, out, "converted to progressive")
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"archive/zip"
+	"strings"
+
+	"github.com/beevik/etree"
+	log "github.com/sirupsen/logrus"
+)
+
+// keyword added to the core properties of optimized files
+const optimizedKeyword = "pptoptimized"
+
+func splitKeywords(keywords string) []string {
+	return strings.FieldsFunc(keywords, func(r rune) bool { return r == ';' || r == ',' })
+}
+
+func hasKeyword(doc *etree.Document, keyword string) bool {
+	if e := doc.FindElement("//keywords"); e != nil {
+		for _, k := range splitKeywords(e.Text()) {
+			if strings.EqualFold(strings.TrimSpace(k), keyword) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsMarkedOptimized tells whether the file has already been processed, according to its core properties
+func (p *PowerpointDoc) IsMarkedOptimized() bool {
+	doc := p.ReadDocProps(CoreProperties)
+	return doc != nil && hasKeyword(doc, optimizedKeyword)
+}
+
+// IsFileMarkedOptimized quickly checks whether a file has already been processed, only reading its core properties
+func IsFileMarkedOptimized(f string) (bool, error) {
+	r, err := zip.OpenReader(f)
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+	p := NewPowerpointDoc()
+	p.sourceFileReader = &r.Reader
+	for _, zf := range r.File {
+		if zf.Name == "_rels/.rels" {
+			if p.packageRels, err = parseRelationships(zf); err != nil {
+				return false, err
+			}
+		}
+	}
+	return p.IsMarkedOptimized(), nil
+}
+
+// MarkOptimized adds the pptoptimized keyword to the core properties, so that processed files can be detected
+func (p *PowerpointDoc) MarkOptimized() {
+	if p.xmlLocked("mark optimized") {
+		return
+	}
+	doc := p.LoadDocProps(CoreProperties)
+	if doc == nil || doc.Root() == nil {
+		log.Warnln("no core properties, cannot mark the file as optimized")
+		return
+	}
+	if hasKeyword(doc, optimizedKeyword) {
+		return
+	}
+	e := doc.FindElement("//keywords")
+	if e == nil {
+		root := doc.Root()
+		e = root.CreateElement("keywords")
+		if root.Space != "" {
+			e.Space = root.Space // cp prefix of the core properties namespace
+		}
+	}
+	keywords := strings.TrimSpace(e.Text())
+	if keywords != "" {
+		keywords += "; "
+	}
+	e.SetText(keywords + optimizedKeyword)
+	log.Debugln("marked", p.docPropsPart(CoreProperties), "as optimized")
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// openZipFile opens a zip file, keeping the file to read the compressed data of its entries
+func openZipFile(name string) (*zip.Reader, *os.File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	r, err := zip.NewReader(f, info.Size())
+	if err != nil {
+		err = openError(f, err)
+		f.Close()
+		return nil, nil, err
+	}
+	return r, f, nil
+}
+
+// rawCompressor writes already compressed data in place of what is written to it,
+// which is only read to compute the checksum and size of the entry
+type rawCompressor struct {
+	w   io.Writer
+	raw io.Reader
+}
+
+func (c *rawCompressor) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (c *rawCompressor) Close() error {
+	_, err := io.Copy(c.w, c.raw)
+	return err
+}
+
+// setSource lets the writer copy the entries of the source archive without compressing them again
+func (pw *packageWriter) setSource(r *zip.Reader, at io.ReaderAt) {
+	if r == nil || at == nil {
+		return
+	}
+	pw.source = make(map[string]*zip.File, len(r.File))
+	for _, f := range r.File {
+		pw.source[f.Name] = f
+	}
+	pw.sourceAt = at
+	pw.Writer.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+		if raw := pw.raw; raw != nil {
+			pw.raw = nil
+			return &rawCompressor{w: w, raw: raw}, nil
+		}
+		return flate.NewWriter(w, 5) // level of the default compressor
+	})
+}
+
+// CopyFile copies an entry of the source archive, reusing its compressed data when possible
+func (pw *packageWriter) CopyFile(f *zip.File) error {
+	return pw.CopyFileAs(f, f.Name)
+}
+
+// CopyFileAs copies an entry of the source archive under another name
+func (pw *packageWriter) CopyFileAs(f *zip.File, name string) error {
+	if !pw.stage && pw.sourceAt != nil && f.Method == zip.Deflate {
+		offset, err := f.DataOffset()
+		if err == nil {
+			pw.raw = io.NewSectionReader(pw.sourceAt, offset, int64(f.CompressedSize64))
+			pw.rawCopies++
+		}
+	}
+	fi, err := f.Open()
+	if err != nil {
+		pw.raw = nil
+		return err
+	}
+	defer fi.Close()
+	fo, err := pw.Create(name)
+	pw.raw = nil
+	if err != nil {
+		return err
+	}
+	// the content is still read, to check it and compute the checksum of the entry
+	n, err := io.Copy(fo, partReader{r: fi, name: f.Name})
+	if err != nil {
+		return err
+	}
+	if uint64(n) != f.UncompressedSize64 {
+		return errors.New("truncated copy of " + f.Name)
+	}
+	return nil
+}
+
+// partReader returns the read errors of a source entry as a *PartError, unlike the write errors of a copy
+type partReader struct {
+	r    io.Reader
+	name string
+}
+
+func (r partReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	if err != nil && err != io.EOF {
+		err = &PartError{Part: r.name, Err: err}
+	}
+	return n, err
+}
+
+// sameAsSource tells whether data is the content of a source entry
+func (pw *packageWriter) sameAsSource(f *zip.File, data []byte) bool {
+	if f.UncompressedSize64 != uint64(len(data)) || f.CRC32 != crc32.ChecksumIEEE(data) {
+		return false
+	}
+	fi, err := f.Open()
+	if err != nil {
+		return false
+	}
+	defer fi.Close()
+	source, err := ioutil.ReadAll(fi)
+	return err == nil && bytes.Equal(source, data)
+}
+
+// WritePart writes a part, copying the source entry instead when the part is unchanged
+func (pw *packageWriter) WritePart(name string, data []byte) error {
+	if f, ok := pw.source[name]; ok && pw.sameAsSource(f, data) {
+		return pw.CopyFile(f)
+	}
+	fo, err := pw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = fo.Write(data)
+	return err
+}
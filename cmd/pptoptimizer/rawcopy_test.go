@@ -0,0 +1,55 @@
+package main
+
+import (
+	"archive/zip"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveEntryOver4GB(t *testing.T) {
+	if testing.Short() {
+		t.Skip("writes and reads a 4 GB entry")
+	}
+	const size = 1<<32 + 1<<20
+	d := newTestDeck(1)
+	d.types.Default = append(d.types.Default, TypeDefault{Extension: "mp4", ContentType: "video/mp4"})
+	d.zeros["ppt/media/media1.mp4"] = size
+	d.rel("ppt/slides/slide1.xml", "video", "../media/media1.mp4")
+	d.rels["ppt/slides/slide1.xml"] = append(d.rels["ppt/slides/slide1.xml"], Relationship{Id: "rId3", Type: mediaRelType, Target: "../media/media1.mp4"})
+	p := d.parse(t)
+	if m := p.medias["ppt/media/media1.mp4"]; m.size != size {
+		t.Fatalf("media size %d, want %d", m.size, size)
+	}
+	p.RemoveUnusedMedias()
+
+	out := filepath.Join(t.TempDir(), "out.pptx")
+	if err := p.SaveFile(out); err != nil {
+		t.Fatal(err)
+	}
+	r, err := zip.OpenReader(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		if f.Name != "ppt/media/media1.mp4" {
+			continue
+		}
+		if f.UncompressedSize64 != size || f.UncompressedSize != ^uint32(0) {
+			t.Errorf("entry of %d bytes, 32-bit size %x, want %d bytes in zip64 fields", f.UncompressedSize64, f.UncompressedSize, size)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// reading to the end checks the crc of the entry
+		n, err := io.Copy(io.Discard, rc)
+		rc.Close()
+		if err != nil || n != size {
+			t.Errorf("read %d bytes of the entry (%v), want %d", n, err, size)
+		}
+		return
+	}
+	t.Error("large media missing from the output")
+}
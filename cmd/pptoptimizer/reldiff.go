@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// RelationshipSnapshot is a copy of the relationships of every part, by source part name
+type RelationshipSnapshot map[string][]Relationship
+
+// RelationshipChange describes a relationship added, removed or retargeted in a part
+type RelationshipChange struct {
+	Source string
+	Change string // added, removed or retargeted
+	Old    Relationship
+	New    Relationship
+}
+
+// Relationships returns a snapshot of the current relationships, of parts that are not removed
+func (p *PowerpointDoc) Relationships() RelationshipSnapshot {
+	s := make(RelationshipSnapshot)
+	add := func(source string, rels *Relationships) {
+		if len(rels.Relationship) > 0 {
+			s[source] = append([]Relationship(nil), rels.Relationship...)
+		}
+	}
+	add("", &p.packageRels)
+	add("ppt/presentation.xml", &p.presentationRels)
+	p.forEachPartRels(add)
+	return s
+}
+
+// DiffRelationships compares two snapshots. Relationships only renumbered are not reported as changed.
+func DiffRelationships(before RelationshipSnapshot, after RelationshipSnapshot) []RelationshipChange {
+	sources := make(map[string]bool)
+	for source := range before {
+		sources[source] = true
+	}
+	for source := range after {
+		sources[source] = true
+	}
+	sorted := make([]string, 0, len(sources))
+	for source := range sources {
+		sorted = append(sorted, source)
+	}
+	sort.Strings(sorted)
+
+	same := func(a Relationship, b Relationship) bool {
+		return a.Type == b.Type && a.Target == b.Target && a.TargetMode == b.TargetMode
+	}
+	var changes []RelationshipChange
+	for _, source := range sorted {
+		old := append([]Relationship(nil), before[source]...)
+		matched := make([]bool, len(old))
+		var added []Relationship
+	next:
+		for _, rel := range after[source] {
+			for i := range old {
+				if !matched[i] && same(old[i], rel) {
+					matched[i] = true
+					continue next
+				}
+			}
+			added = append(added, rel)
+		}
+		for _, rel := range added {
+			change := RelationshipChange{Source: source, Change: "added", New: rel}
+			for i := range old {
+				if !matched[i] && old[i].Id == rel.Id && old[i].Type == rel.Type {
+					matched[i] = true
+					change.Change, change.Old = "retargeted", old[i]
+					break
+				}
+			}
+			changes = append(changes, change)
+		}
+		for i := range old {
+			if !matched[i] {
+				changes = append(changes, RelationshipChange{Source: source, Change: "removed", Old: old[i]})
+			}
+		}
+	}
+	return changes
+}
+
+func (p *PowerpointDoc) ReportRelationshipChanges(before RelationshipSnapshot) {
+	changes := DiffRelationships(before, p.Relationships())
+	for _, c := range changes {
+		source := c.Source
+		if source == "" {
+			source = "package"
+		}
+		switch c.Change {
+		case "added":
+			fmt.Printf("%s: added %s %s -> %s\n", source, c.New.Id, c.New.Type, c.New.Target)
+		case "removed":
+			fmt.Printf("%s: removed %s %s -> %s\n", source, c.Old.Id, c.Old.Type, c.Old.Target)
+		case "retargeted":
+			fmt.Printf("%s: retargeted %s %s -> %s\n", source, c.New.Id, c.Old.Target, c.New.Target)
+		}
+	}
+	fmt.Println("relationships changed:", len(changes))
+}
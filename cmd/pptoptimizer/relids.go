@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/beevik/etree"
+	log "github.com/sirupsen/logrus"
+)
+
+// namespaces of the attributes referencing relationship ids, such as r:id, r:embed or r:link
+var relationshipNamespaces = map[string]bool{
+	"http://schemas.openxmlformats.org/officeDocument/2006/relationships": true,
+	"http://purl.oclc.org/ooxml/officeDocument/relationships":             true,
+	"http://schemas.microsoft.com/office/2007/relationships":              true,
+}
+
+// namespaceURI resolves a prefix in the scope of an element
+// (Attr.NamespaceURI in etree returns the namespace of the element instead)
+func namespaceURI(e *etree.Element, prefix string) string {
+	for ; e != nil; e = e.Parent() {
+		for _, a := range e.Attr {
+			if a.Space == "xmlns" && a.Key == prefix {
+				return a.Value
+			}
+		}
+	}
+	return ""
+}
+
+// renumberRelationships assigns rId1..rIdN to the relationships of a part and updates the references in its xml,
+// it returns false when the ids were already compact
+func renumberRelationships(rels *Relationships, doc *etree.Document, source string) bool {
+	mapping := make(map[string]string)
+	changed := false
+	for i := range rels.Relationship {
+		rel := &rels.Relationship[i]
+		id := fmt.Sprintf("rId%d", i+1)
+		if _, ok := mapping[rel.Id]; ok {
+			log.Warnln("duplicate relationship id", rel.Id, "in", source, "renamed to", id)
+		} else {
+			mapping[rel.Id] = id
+		}
+		if rel.Id != id {
+			rel.Id = id
+			changed = true
+		}
+	}
+	if !changed {
+		return false
+	}
+	for _, e := range doc.FindElements("//*") {
+		for i := range e.Attr {
+			attr := &e.Attr[i]
+			if attr.Space == "" || !relationshipNamespaces[namespaceURI(e, attr.Space)] {
+				continue
+			}
+			if id, ok := mapping[attr.Value]; ok {
+				attr.Value = id
+			} else {
+				log.Warnln("reference to unknown relationship id", attr.Value, "in", source)
+			}
+		}
+	}
+	return true
+}
+
+// RenumberRelationships rewrites the relationship ids of the presentation, slides, layouts, masters and other parts
+// referencing medias to a compact rId1..rIdN form
+func (p *PowerpointDoc) RenumberRelationships() {
+	if p.xmlLocked("renumber relationships") {
+		return
+	}
+	renumber := func(rels *Relationships, source string, load func() *etree.Document) {
+		if len(rels.Relationship) == 0 {
+			return
+		}
+		// check first, to avoid loading parts that are already compact
+		compact := true
+		for i, rel := range rels.Relationship {
+			if rel.Id != fmt.Sprintf("rId%d", i+1) {
+				compact = false
+				break
+			}
+		}
+		if compact {
+			return
+		}
+		doc := load()
+		if doc == nil {
+			p.Problem(fmt.Errorf("cannot renumber relationships of missing part %s", source))
+			return
+		}
+		if renumberRelationships(rels, doc, source) {
+			log.Debugln("renumbered relationships of", source)
+		}
+	}
+
+	renumber(&p.presentationRels, "ppt/presentation.xml", func() *etree.Document {
+		p.presentationEdit = true
+		return p.presentation
+	})
+	for i := range p.slideRels {
+		if !p.IsSlideRemoved(i) {
+			name := partName("slide", i)
+			renumber(&p.slideRels[i], name, func() *etree.Document { return p.LoadPart(name) })
+		}
+	}
+	for i := range p.slideLayoutRels {
+		if !p.IsLayoutRemoved(i) {
+			name := partName("slideLayout", i)
+			renumber(&p.slideLayoutRels[i], name, func() *etree.Document { return p.LoadPart(name) })
+		}
+	}
+	for i := range p.slideMasterRels {
+		if !p.IsMasterRemoved(i) && i < len(p.slideMasters) {
+			doc := p.slideMasters[i]
+			renumber(&p.slideMasterRels[i], partName("slideMaster", i), func() *etree.Document { return doc })
+		}
+	}
+	for _, source := range p.otherRelsSources() {
+		rels := p.otherRels[source]
+		renumber(&rels, source, func() *etree.Document { return p.LoadPart(source) })
+		p.otherRels[source] = rels
+	}
+}
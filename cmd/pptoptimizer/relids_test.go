@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/beevik/etree"
+)
+
+var reRelationshipAttr = regexp.MustCompile(`(r:[A-Za-z]+)="([^"]*)"`)
+
+// setRelationshipIds gives new ids to the relationships of a part, in order, and updates the references to them
+func (d *testDeck) setRelationshipIds(source string, ids []string) {
+	mapping := make(map[string]string)
+	for i := range d.rels[source] {
+		mapping[d.rels[source][i].Id] = ids[i]
+		d.rels[source][i].Id = ids[i]
+	}
+	remap := func(s string) string {
+		return reRelationshipAttr.ReplaceAllStringFunc(s, func(attr string) string {
+			m := reRelationshipAttr.FindStringSubmatch(attr)
+			return fmt.Sprintf(`%s="%s"`, m[1], mapping[m[2]])
+		})
+	}
+	d.parts[source] = []byte(remap(string(d.parts[source])))
+	for i, shape := range d.shapes[source] {
+		d.shapes[source][i] = remap(shape)
+	}
+}
+
+// referenceTargets lists the targets of the relationship attributes of a part in document order,
+// the first relationship of an id winning as when reading the part
+func referenceTargets(t *testing.T, parts map[string][]byte, name string) []string {
+	t.Helper()
+	rels := Relationships{}
+	if err := xml.Unmarshal(parts[relsPartName(name)], &rels); err != nil {
+		t.Fatalf("%s: %v", relsPartName(name), err)
+	}
+	targets := make(map[string]string)
+	for _, rel := range rels.Relationship {
+		if _, ok := targets[rel.Id]; !ok {
+			targets[rel.Id] = rel.Type + " " + resolveTarget(name, rel.Target)
+		}
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(parts[name]); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	refs := []string{}
+	for _, e := range doc.FindElements("//*") {
+		for _, a := range e.Attr {
+			if a.Space == "r" {
+				refs = append(refs, e.Tag+" r:"+a.Key+" "+targets[a.Value])
+			}
+		}
+	}
+	return refs
+}
+
+func TestRenumberRelationships(t *testing.T) {
+	parts := map[string]string{
+		"presentation": "ppt/presentation.xml",
+		"slide":        "ppt/slides/slide2.xml",
+		"layout":       "ppt/slideLayouts/slideLayout1.xml",
+		"master":       "ppt/slideMasters/slideMaster1.xml",
+	}
+	// ids of the relationships of each part, in order, which have 5 relationships in the test deck
+	schemes := map[string][]string{
+		"sparse":    {"rId9", "rId3", "rId12", "rId40", "rId41"},
+		"reversed":  {"rId5", "rId4", "rId3", "rId2", "rId1"},
+		"shifted":   {"rId2", "rId3", "rId4", "rId5", "rId6"},
+		"named":     {"R3f2a", "image", "rId1x", "Rb7", "rId"},
+		"duplicate": {"rId4", "rId4", "rId2", "rId7", "rId2"},
+	}
+	for kind, part := range parts {
+		for scheme, ids := range schemes {
+			t.Run(kind+"/"+scheme, func(t *testing.T) {
+				d := newTestDeck(3)
+				for _, source := range []string{"ppt/slides/slide2.xml", "ppt/slideLayouts/slideLayout1.xml", "ppt/slideMasters/slideMaster1.xml"} {
+					base := strings.TrimSuffix(strings.TrimPrefix(source, "ppt/"), ".xml")
+					for len(d.rels[source]) < 4 {
+						d.image(source, fmt.Sprintf("ppt/media/%s-%d.png", strings.Replace(base, "/", "-", -1), len(d.rels[source])), testPNG(8+len(d.rels[source]), 8))
+					}
+					d.picture(source, "r:link", d.rel(source, "image", "https://example.com/linked.png"))
+				}
+				d.setRelationshipIds(part, ids)
+				in := d.write(t)
+				before := readTestZip(t, in)
+
+				p := parseTestFile(t, in)
+				p.RenumberRelationships()
+				_, after := saveTestFile(t, p)
+
+				assertReferencesResolve(t, after)
+				rels := Relationships{}
+				if err := xml.Unmarshal(after[relsPartName(part)], &rels); err != nil {
+					t.Fatal(err)
+				}
+				for i, rel := range rels.Relationship {
+					if want := fmt.Sprintf("rId%d", i+1); rel.Id != want {
+						t.Errorf("relationship %d of %s is %s, want %s", i, part, rel.Id, want)
+					}
+				}
+				for name := range after {
+					if !strings.HasSuffix(name, ".xml") || after[relsPartName(name)] == nil {
+						continue
+					}
+					want, got := referenceTargets(t, before, name), referenceTargets(t, after, name)
+					if strings.Join(got, "\n") != strings.Join(want, "\n") {
+						t.Errorf("references of %s:\n%s\nwant:\n%s", name, strings.Join(got, "\n"), strings.Join(want, "\n"))
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestRenumberKeepsCompactIds(t *testing.T) {
+	d := newTestDeck(1)
+	d.image("ppt/slides/slide1.xml", "ppt/media/image1.png", testPNG(8, 8))
+	p := d.parse(t)
+	p.RenumberRelationships()
+	if p.presentationEdit {
+		t.Error("presentation with compact ids rewritten")
+	}
+	if _, ok := p.parts["ppt/slides/slide1.xml"]; ok {
+		t.Error("slide with compact ids loaded for rewrite")
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var reportFormats = []string{"text", "json", "csv"}
+
+// Report is the result of the optimization of a file
+type Report struct {
+	Input        string   `json:"input"`
+	Output       string   `json:"output"`
+	SizeBefore   int64    `json:"sizeBefore"`
+	SizeAfter    int64    `json:"sizeAfter"`
+	Slides       int      `json:"slides"`
+	MediasBefore int      `json:"mediasBefore"`
+	MediasAfter  int      `json:"mediasAfter"`
+	SkippedTiffs []string `json:"skippedTiffs"`
+	Problems     []string `json:"problems"`
+	Warnings     int      `json:"warnings"`
+	// bytes reclaimed by removing duplicate medias and embedded documents
+	DedupedMedias     uint64 `json:"dedupedMedias"`
+	DedupedEmbeddings int    `json:"dedupedEmbeddings"`
+	// custom xml items removed by -nocustomxml
+	RemovedCustomXML []string `json:"removedCustomXml"`
+	// set when the input lists a number of slides other than its slide parts
+	SlideListMismatch string `json:"slideListMismatch,omitempty"`
+}
+
+func checkReportFormat(format string) error {
+	for _, f := range reportFormats {
+		if format == f {
+			return nil
+		}
+	}
+	return errors.New("unknown report format " + format + ", expected " + strings.Join(reportFormats, ", "))
+}
+
+func savedPercent(before int64, after int64) float64 {
+	if before <= 0 {
+		return 0
+	}
+	return float64(before-after) * 100 / float64(before)
+}
+
+// summaryLine is the result of a file on one line, as printed by -summaryonly and batch
+func summaryLine(input string, before int64, after int64) string {
+	return fmt.Sprintf("%s: %d -> %d bytes, saved %.1f%%", input, before, after, savedPercent(before, after))
+}
+
+// Write writes the report as text, json or csv, with a header line for csv
+func (r Report) Write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		out, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(out))
+		return err
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"input", "output", "size_before", "size_after", "slides", "medias_before", "medias_after", "skipped_tiffs", "problems", "warnings", "deduped_medias", "deduped_embeddings", "removed_custom_xml", "slide_list_mismatch"})
+		cw.Write([]string{r.Input, r.Output, strconv.FormatInt(r.SizeBefore, 10), strconv.FormatInt(r.SizeAfter, 10),
+			strconv.Itoa(r.Slides), strconv.Itoa(r.MediasBefore), strconv.Itoa(r.MediasAfter),
+			strings.Join(r.SkippedTiffs, " "), strings.Join(r.Problems, " | "), strconv.Itoa(r.Warnings), strconv.FormatUint(r.DedupedMedias, 10), strconv.Itoa(r.DedupedEmbeddings),
+			strings.Join(r.RemovedCustomXML, " "), r.SlideListMismatch})
+		cw.Flush()
+		return cw.Error()
+	case "text":
+		fmt.Fprintf(w, "%s -> %s\n", r.Input, r.Output)
+		fmt.Fprintf(w, "  size: %d -> %d, saved %d bytes (%.1f%%)\n", r.SizeBefore, r.SizeAfter, r.SizeBefore-r.SizeAfter, savedPercent(r.SizeBefore, r.SizeAfter))
+		fmt.Fprintf(w, "  slides: %d, medias: %d -> %d\n", r.Slides, r.MediasBefore, r.MediasAfter)
+		if r.DedupedMedias > 0 {
+			fmt.Fprintln(w, "  duplicate medias removed:", r.DedupedMedias, "bytes")
+		}
+		if r.DedupedEmbeddings > 0 {
+			fmt.Fprintln(w, "  duplicate embeddings removed:", r.DedupedEmbeddings, "bytes")
+		}
+		if len(r.RemovedCustomXML) > 0 {
+			fmt.Fprintln(w, "  unused custom xml removed:", strings.Join(r.RemovedCustomXML, ", "))
+		}
+		if r.SlideListMismatch != "" {
+			fmt.Fprintln(w, "  damaged slide list:", r.SlideListMismatch)
+		}
+		if len(r.SkippedTiffs) > 0 {
+			fmt.Fprintln(w, "  skipped tiffs:", strings.Join(r.SkippedTiffs, ", "))
+		}
+		for _, p := range r.Problems {
+			fmt.Fprintln(w, "  problem:", p)
+		}
+		_, err := fmt.Fprintln(w, "  warnings:", r.Warnings)
+		return err
+	}
+	return checkReportFormat(format)
+}
+
+// writeReport writes the report to a file, or to stdout when the file name is empty
+func writeReport(r Report, name string, format string) error {
+	if name == "" {
+		return r.Write(os.Stdout, format)
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := r.Write(f, format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
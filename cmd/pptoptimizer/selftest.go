@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SelfTest checks invariants of an optimized document parsed again from its output file: it has the expected
+// number of slides, the pictures of its slides reference relationships to parts of the package, and every content
+// type override names a part of the package. It returns the violations, which are bugs of the optimizations.
+func (p *PowerpointDoc) SelfTest(slides int) []error {
+	var errs []error
+	if n := p.SlideCount(); n != slides {
+		errs = append(errs, fmt.Errorf("%d slides instead of %d", n, slides))
+	}
+
+	parts := make(map[string]bool, len(p.sourceFileReader.File))
+	for _, f := range p.sourceFileReader.File {
+		parts[f.Name] = true
+	}
+	for i, rels := range p.slideRels {
+		name := partName("slide", i)
+		if !parts[name] {
+			continue // not listed in the presentation, or the slide count is already wrong
+		}
+		ids := make(map[string]Relationship, len(rels.Relationship))
+		for _, rel := range rels.Relationship {
+			ids[rel.Id] = rel
+			if (rel.Is("image") || rel.isMediaFile()) && rel.TargetMode != "External" && !parts[resolveTarget(name, rel.Target)] {
+				errs = append(errs, fmt.Errorf("%s references the missing media %s", name, resolveTarget(name, rel.Target)))
+			}
+		}
+		doc, err := p.ReadPart(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		embedded, _ := imageReferences(doc)
+		missing := []string{}
+		for id := range embedded {
+			if _, ok := ids[id]; !ok {
+				missing = append(missing, id)
+			}
+		}
+		sort.Strings(missing)
+		for _, id := range missing {
+			errs = append(errs, fmt.Errorf("%s embeds a picture through the missing relationship %s", name, id))
+		}
+	}
+
+	for _, o := range p.contentTypes.Override {
+		if !parts[strings.TrimPrefix(o.PartName, "/")] {
+			errs = append(errs, fmt.Errorf("content type of the missing part %s", o.PartName))
+		}
+	}
+	return errs
+}
+
+// selfTestFile parses an output file and runs the self-test on it, logging each violation
+func selfTestFile(name string, slides int) error {
+	out := NewPowerpointDoc()
+	defer out.Close()
+	if err := out.ParseFile(name); err != nil {
+		return fmt.Errorf("self-test cannot parse %s: %w", name, err)
+	}
+	errs := out.SelfTest(slides)
+	for _, err := range errs {
+		log.Errorln("self-test:", name, err)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s failed the self-test with %d errors", name, len(errs))
+	}
+	log.Debugln("self-test of", name, "passed")
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSelfTestMissingSlide(t *testing.T) {
+	d := newTestDeck(2)
+	name := d.write(t)
+	if err := selfTestFile(name, 2); err != nil {
+		t.Errorf("self-test of an intact output failed: %v", err)
+	}
+	if err := selfTestFile(name, 3); err == nil {
+		t.Error("self-test passed an output missing a slide")
+	}
+	errs := parseTestFile(t, name).SelfTest(3)
+	if len(errs) != 1 || errs[0].Error() != "2 slides instead of 3" {
+		t.Errorf("self-test errors are %v, want the missing slide", errs)
+	}
+}
+
+func TestSelfTestDanglingPicture(t *testing.T) {
+	d := newTestDeck(2)
+	d.image("ppt/slides/slide1.xml", "ppt/media/image1.png", testPNG(8, 8))
+	d.picture("ppt/slides/slide2.xml", "r:embed", "rId9")
+	name := d.write(t)
+	if err := selfTestFile(name, 2); err == nil {
+		t.Error("self-test passed an output with a dangling picture relationship")
+	}
+	errs := parseTestFile(t, name).SelfTest(2)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "ppt/slides/slide2.xml") || !strings.Contains(errs[0].Error(), "rId9") {
+		t.Errorf("self-test errors are %v, want the dangling relationship of slide 2", errs)
+	}
+}
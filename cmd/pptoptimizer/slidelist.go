@@ -0,0 +1,69 @@
+package main
+
+import (
+	"path"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// checkSlideList warns when the number of slides listed in the presentation differs from the number of slide parts,
+// a sign of a damaged file which PowerPoint offers to repair
+func (p *PowerpointDoc) checkSlideList() {
+	p.sourceSlideParts = 0
+	for _, f := range p.sourceFileReader.File {
+		if path.Dir(f.Name) == "ppt/slides" && path.Ext(f.Name) == ".xml" {
+			p.sourceSlideParts++
+		}
+	}
+	if listed := p.SlideCount(); listed != p.sourceSlideParts {
+		log.Warnln("presentation lists", listed, "slides but the file has", p.sourceSlideParts, "slide parts, it may be damaged")
+	}
+}
+
+// SourceSlideParts returns the number of slide parts of the input file, which differs from the number of slides
+// listed in a damaged file
+func (p *PowerpointDoc) SourceSlideParts() int {
+	return p.sourceSlideParts
+}
+
+// RepairSlideList removes the entries of the presentation slide list whose relationship or slide is missing,
+// which make PowerPoint offer to repair the file. It returns the number of entries removed.
+func (p *PowerpointDoc) RepairSlideList() int {
+	if p.xmlLocked("repair slide list") {
+		return 0
+	}
+	removed := 0
+	for _, e := range p.presentation.FindElements("//p:sldIdLst/p:sldId") {
+		id := e.SelectAttrValue("r:id", "")
+		var target string
+		relIndex := -1
+		for i, rel := range p.presentationRels.Relationship {
+			if rel.Id == id {
+				target, relIndex = resolveTarget("ppt/presentation.xml", rel.Target), i
+				break
+			}
+		}
+
+		reason := ""
+		if relIndex < 0 {
+			reason = "no relationship " + id
+		} else if !p.hasSourcePart(target) {
+			reason = "missing part " + target
+		} else if n, err := getObjectNumberFromFilename(target); err == nil && p.IsSlideRemoved(n-1) {
+			reason = "removed slide " + target
+		}
+		if reason == "" {
+			continue
+		}
+
+		log.Warnln("remove slide", e.SelectAttrValue("id", ""), "from the presentation:", reason)
+		e.Parent().RemoveChild(e)
+		p.presentationEdit = true
+		if relIndex >= 0 {
+			rels := p.presentationRels.Relationship
+			p.presentationRels.Relationship = append(rels[:relIndex], rels[relIndex+1:]...)
+		}
+		removed++
+	}
+	return removed
+}
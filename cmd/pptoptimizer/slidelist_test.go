@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRepairSlideList(t *testing.T) {
+	d := newTestDeck(3)
+	presentation := "ppt/presentation.xml"
+	missing := d.rel(presentation, "slide", "slides/slide9.xml")
+	d.parts[presentation] = []byte(strings.Replace(string(d.parts[presentation]), "</p:sldIdLst>",
+		`<p:sldId id="300" r:id="rId50"/><p:sldId id="301" r:id="`+missing+`"/></p:sldIdLst>`, 1))
+	p := d.parse(t)
+	if p.SlideCount() != 5 || p.SourceSlideParts() != 3 {
+		t.Errorf("%d slides listed, %d slide parts, want 5 and 3", p.SlideCount(), p.SourceSlideParts())
+	}
+	if n := p.RepairSlideList(); n != 2 {
+		t.Errorf("%d slides removed from the list, want 2", n)
+	}
+	if p.SlideCount() != 3 {
+		t.Errorf("%d slides listed after repair, want 3", p.SlideCount())
+	}
+	if n := p.RepairSlideList(); n != 0 {
+		t.Errorf("%d slides removed from a repaired list", n)
+	}
+
+	_, parts := saveTestFile(t, p)
+	assertReferencesResolve(t, parts)
+	if strings.Contains(string(parts["ppt/_rels/presentation.xml.rels"]), "slide9.xml") {
+		t.Errorf("relationship to the missing slide kept:\n%s", parts["ppt/_rels/presentation.xml.rels"])
+	}
+}
+
+func TestRepairSlideListKeepsValidList(t *testing.T) {
+	p := newTestDeck(2).parse(t)
+	if n := p.RepairSlideList(); n != 0 || p.presentationEdit {
+		t.Errorf("%d slides removed from a valid list, presentation edited: %v", n, p.presentationEdit)
+	}
+}
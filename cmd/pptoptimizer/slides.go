@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SlideOrder returns the slide indexes (slideN.xml -> N-1) in the order of the presentation
+func (p *PowerpointDoc) SlideOrder() []int {
+	order := []int{}
+	for _, e := range p.presentation.FindElements("//p:sldIdLst/p:sldId") {
+		id := e.SelectAttrValue("r:id", "")
+		for _, rel := range p.presentationRels.Relationship {
+			if rel.Id == id && rel.Is("slide") {
+				if n, err := getObjectNumberFromFilename(resolveTarget("ppt/presentation.xml", rel.Target)); err == nil && !p.IsSlideRemoved(n-1) {
+					order = append(order, n-1)
+				}
+				break
+			}
+		}
+	}
+	return order
+}
+
+// RemoveSlide removes a slide (slideN.xml -> N-1) from the presentation, with its notes and comments, and the parts
+// no other part reaches, such as its charts with their workbooks, diagrams and ole objects. Medias are left to
+// RemoveUnusedMedias, and layouts to RemoveUnusedLayouts.
+func (p *PowerpointDoc) RemoveSlide(i int) {
+	if p.xmlLocked("remove slide") || p.IsSlideRemoved(i) {
+		return
+	}
+	name := partName("slide", i)
+	log.Infoln("remove slide", i+1)
+	used, err := p.reachableParts(name)
+
+	rels := p.presentationRels.Relationship[:0]
+	for _, rel := range p.presentationRels.Relationship {
+		if rel.Is("slide") && resolveTarget("ppt/presentation.xml", rel.Target) == name {
+			for _, e := range p.presentation.FindElements(fmt.Sprintf("//p:sldIdLst/p:sldId[@r:id='%s']", rel.Id)) {
+				// sections list slides by id
+				for _, s := range p.presentation.FindElements(fmt.Sprintf("//p14:sldId[@id='%s']", e.SelectAttrValue("id", ""))) {
+					s.Parent().RemoveChild(s)
+				}
+				e.Parent().RemoveChild(e)
+				p.presentationEdit = true
+			}
+			for _, e := range p.presentation.FindElements(fmt.Sprintf("//p:custShow//p:sld[@r:id='%s']", rel.Id)) {
+				e.Parent().RemoveChild(e)
+				p.presentationEdit = true
+			}
+			continue
+		}
+		rels = append(rels, rel)
+	}
+	p.presentationRels.Relationship = rels
+
+	// parts only used by this slide
+	if i < len(p.slideRels) {
+		for _, rel := range p.slideRels[i].Relationship {
+			if rel.TargetMode != "External" && (rel.Is("notesSlide") || rel.Is("comments")) {
+				target := resolveTarget(name, rel.Target)
+				p.removedParts[target] = true
+				p.contentTypes.RemoveOverride(target)
+			}
+		}
+		p.slideRels[i] = Relationships{}
+	}
+	p.contentTypes.RemoveOverride(name)
+	p.removedSlides = markRemoved(p.removedSlides, i)
+	delete(p.parts, name)
+
+	reached := map[string]bool{}
+	if err == nil {
+		reached, err = p.reachableParts("")
+	}
+	if err != nil {
+		log.Warnln(err, ", keep the parts slide", i+1, "used")
+		return
+	}
+	names := make([]string, 0, len(used))
+	for part := range used {
+		names = append(names, part)
+	}
+	sort.Strings(names)
+	for _, part := range names {
+		if reached[part] || p.removedParts[part] || isNumberedPart(part) {
+			continue
+		}
+		if _, ok := p.medias[part]; ok {
+			continue
+		}
+		log.Infoln("remove", part, "only used by slide", i+1)
+		p.removedParts[part] = true
+		p.contentTypes.RemoveOverride(part)
+		delete(p.otherRels, part) // its medias become unused
+		delete(p.parts, part)
+	}
+}
+
+// isNumberedPart tells whether a part is a slide, layout or master, which are removed by number
+func isNumberedPart(name string) bool {
+	return isPartOfKind(name, numberedKinds)
+}
+
+// reachableParts returns the parts reached through relationships from the given sources, following the rels
+// in memory and those copied verbatim, of the parts which are not removed
+func (p *PowerpointDoc) reachableParts(sources ...string) (map[string]bool, error) {
+	rels := p.Relationships()
+	var err error
+	p.forEachCopiedRels(func(source string, copied *Relationships) {
+		rels[source] = copied.Relationship
+	}, func(source string, failed error) {
+		if err == nil {
+			err = failed
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	reached := make(map[string]bool)
+	for len(sources) > 0 {
+		source := sources[0]
+		sources = sources[1:]
+		for _, rel := range rels[source] {
+			if target := resolveTarget(source, rel.Target); rel.TargetMode != "External" && !reached[target] {
+				reached[target] = true
+				sources = append(sources, target)
+			}
+		}
+	}
+	return reached, nil
+}
+
+// ExtractSlides returns a copy of the document with only the given slides, in presentation order (0 for the first one),
+// and the layouts, masters, themes and medias they use
+func (p *PowerpointDoc) ExtractSlides(positions []int) (*PowerpointDoc, error) {
+	order := p.SlideOrder()
+	keep := make(map[int]bool)
+	for _, pos := range positions {
+		if pos < 0 || pos >= len(order) {
+			return nil, fmt.Errorf("no slide %d, the presentation has %d slides", pos+1, len(order))
+		}
+		keep[order[pos]] = true
+	}
+	c, err := p.Clone()
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range order {
+		if !keep[i] {
+			c.RemoveSlide(i)
+		}
+	}
+	c.RemoveUnusedLayouts()
+	c.RemoveUnusedMasters()
+	c.RemoveUnusedThemes()
+	c.RemoveUnusedMedias()
+	c.UpdateAppProperties()
+	if err := c.Err(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// parseSlideRanges parses 1-based slide numbers and ranges such as "1,3-5" into 0-based positions
+func parseSlideRanges(s string) ([]int, error) {
+	positions := []int{}
+	for _, r := range strings.Split(s, ",") {
+		bounds := strings.SplitN(strings.TrimSpace(r), "-", 2)
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid slide number %q", r)
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = strconv.Atoi(bounds[1]); err != nil {
+				return nil, fmt.Errorf("invalid slide range %q", r)
+			}
+		}
+		if first < 1 || last < first {
+			return nil, fmt.Errorf("invalid slide range %q", r)
+		}
+		for n := first; n <= last; n++ {
+			positions = append(positions, n-1)
+		}
+	}
+	return positions, nil
+}
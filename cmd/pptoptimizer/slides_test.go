@@ -0,0 +1,56 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestExtractSlidesRemovesPartsOfOtherSlides(t *testing.T) {
+	d := newTestDeck(3)
+	d.image("ppt/slides/slide1.xml", "ppt/media/image1.png", testPNG(8, 8))
+	// a chart with its workbook and a picture fill, only used by slide 2
+	d.add("ppt/charts/chart1.xml", relationshipContentTypes["chart"], `<c:chartSpace xmlns:c="http://schemas.openxmlformats.org/drawingml/2006/chart" `+testNamespaces+`>`+
+		`<c:spPr><a:blipFill><a:blip r:embed="rId1"/></a:blipFill></c:spPr><c:externalData r:id="rId2"/></c:chartSpace>`)
+	d.rel("ppt/charts/chart1.xml", "image", "../media/image2.png")
+	d.rel("ppt/charts/chart1.xml", "package", "../embeddings/Microsoft_Excel_Worksheet1.xlsx")
+	d.addBytes("ppt/media/image2.png", "", testPNG(9, 8))
+	d.addBytes("ppt/embeddings/Microsoft_Excel_Worksheet1.xlsx", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", []byte("PK\x05\x06"+strings.Repeat("\x00", 18)))
+	d.rel("ppt/slides/slide2.xml", "chart", "../charts/chart1.xml")
+	d.image("ppt/slides/slide3.xml", "ppt/media/image3.png", testPNG(10, 8))
+	p := d.parse(t)
+
+	e, err := p.ExtractSlides([]int{0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	_, parts := saveTestFile(t, e)
+	names := make([]string, 0, len(parts))
+	for name := range parts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	want := []string{
+		"[Content_Types].xml",
+		"_rels/.rels",
+		"ppt/_rels/presentation.xml.rels",
+		"ppt/media/image1.png",
+		"ppt/presentation.xml",
+		"ppt/slideLayouts/_rels/slideLayout1.xml.rels",
+		"ppt/slideLayouts/slideLayout1.xml",
+		"ppt/slideMasters/_rels/slideMaster1.xml.rels",
+		"ppt/slideMasters/slideMaster1.xml",
+		"ppt/slides/_rels/slide1.xml.rels",
+		"ppt/slides/slide1.xml",
+		"ppt/theme/theme1.xml",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("excerpt parts are\n%s\nwant\n%s", strings.Join(names, "\n"), strings.Join(want, "\n"))
+	}
+	if ct := string(parts["[Content_Types].xml"]); strings.Contains(ct, "chart1") || strings.Contains(ct, "Worksheet1") {
+		t.Errorf("content types of removed parts kept: %s", ct)
+	}
+	assertReferencesResolve(t, parts)
+}
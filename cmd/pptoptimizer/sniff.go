@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"path"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// sniffImageFormat returns the actual format of a raster image (png, jpeg, gif, tiff, bmp, webp),
+// or an empty string when the data is not an image we can decode
+func sniffImageFormat(data []byte) string {
+	return sniffImageReader(bytes.NewReader(data))
+}
+
+func sniffImageReader(r io.Reader) string {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(4)
+	_, format, err := image.DecodeConfig(br)
+	if err != nil {
+		// tiffs with a compression we cannot decode may still be converted by an external tool
+		if bytes.Equal(magic, []byte("II*\x00")) || bytes.Equal(magic, []byte("MM\x00*")) {
+			return "tiff"
+		}
+		return ""
+	}
+	return format
+}
+
+// SniffMedia returns the actual format of a media, only reading what is needed from non-image files
+func (p *PowerpointDoc) SniffMedia(name string) (string, error) {
+	mf, err := p.OpenMedia(name)
+	if err != nil {
+		return "", p.mediaReadError(name, err)
+	}
+	defer mf.Close()
+	return sniffImageReader(mf), nil
+}
+
+// readMediaOfFormat reads a media for a pass optimizing some formats and returns its format, which is empty
+// for a media of another format or kept as is, and for a media which cannot be read, reported as a problem
+func (p *PowerpointDoc) readMediaOfFormat(name string, formats ...string) ([]byte, string) {
+	format, err := p.SniffMedia(name)
+	if err != nil {
+		p.Problem(err)
+		return nil, ""
+	}
+	wanted := false
+	for _, f := range formats {
+		wanted = wanted || f == format
+	}
+	if !wanted || p.isMediaKept(name) {
+		return nil, ""
+	}
+	data, err := p.ReadMedia(name)
+	if err != nil {
+		p.Problem(err)
+		return nil, ""
+	}
+	return data, format
+}
+
+func mediaExtension(name string) string {
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(name), "."))
+	if ext == "jpg" {
+		return "jpeg"
+	}
+	if ext == "tif" {
+		return "tiff"
+	}
+	return ext
+}
+
+func replaceExtension(name string, ext string) string {
+	return strings.TrimSuffix(name, path.Ext(name)) + "." + ext
+}
+
+func (t *Types) ContentTypeOf(part string) string {
+	for _, o := range t.Override {
+		if o.PartName == "/"+part {
+			return o.ContentType
+		}
+	}
+	ext := strings.TrimPrefix(path.Ext(part), ".")
+	for _, d := range t.Default {
+		if strings.EqualFold(d.Extension, ext) {
+			return d.ContentType
+		}
+	}
+	return ""
+}
+
+func (t *Types) RemoveOverride(part string) {
+	for j, o := range t.Override {
+		if o.PartName == "/"+part {
+			copy(t.Override[j:], t.Override[j+1:])
+			t.Override = t.Override[:len(t.Override)-1]
+			return
+		}
+	}
+}
+
+// isGenericContentType tells whether a content type says nothing of the format, as declared by some tools for all medias
+func isGenericContentType(contentType string) bool {
+	return contentType == "" || contentType == "application/octet-stream" || contentType == "binary/octet-stream"
+}
+
+// checkMediaFormat compares the actual format of a media with its extension and declared content type
+func (p *PowerpointDoc) checkMediaFormat(name string, format string) string {
+	if format == "" {
+		return ""
+	}
+	if contentType := p.contentTypes.ContentTypeOf(name); isGenericContentType(contentType) {
+		log.Infoln("media", name, "declared as", contentType, "is a", format, "picture")
+	} else if mediaExtension(name) != format {
+		log.Warnln("media", name, "is actually a", format, "picture")
+	} else if contentType := p.contentTypes.ContentTypeOf(name); contentType != imageContentTypes[format] {
+		log.Warnln("media", name, "is declared as", contentType, "but is a", format, "picture")
+	}
+	return format
+}
+
+// FixMediaExtension renames a media whose extension does not match its actual format
+func (p *PowerpointDoc) FixMediaExtension(name string, format string) {
+	if mediaExtension(name) == format && p.contentTypes.ContentTypeOf(name) == imageContentTypes[format] {
+		return
+	}
+	newname := replaceExtension(name, format)
+	if _, ok := p.medias[newname]; ok && newname != name {
+		newname = p.newMediaName(format)
+	}
+	data, err := p.ReadMedia(name)
+	if err != nil {
+		p.Problem(err)
+		return
+	}
+	log.Infoln("fix media", name, "as", newname)
+	p.contentTypes.RemoveOverride(name)
+	p.contentTypes.AddDefault(format, imageContentTypes[format])
+	p.auditMedia(name, newname, "renamed to match "+format+" format")
+	p.RenameMedia(name, newname, p.newMedia(data))
+}
+
+// FixContentTypes corrects the declared content type of pictures whose actual format differs,
+// fixing the default of their extension when it matches the format, or overriding the part otherwise
+func (p *PowerpointDoc) FixContentTypes() {
+	for _, name := range p.MediaNames() {
+		format, err := p.SniffMedia(name)
+		if err != nil {
+			p.Problem(err)
+			continue
+		}
+		want := imageContentTypes[format]
+		if format == "" || want == "" {
+			continue
+		}
+		p.fixContentType(name, want)
+	}
+}
+
+func (p *PowerpointDoc) fixContentType(name string, want string) {
+	got := p.contentTypes.ContentTypeOf(name)
+	if got == want {
+		return
+	}
+	log.Infoln("fix content type of", name, "from", got, "to", want)
+	overridden := false
+	for i, o := range p.contentTypes.Override {
+		if o.PartName == "/"+name {
+			p.contentTypes.Override[i].ContentType = want
+			overridden = true
+		}
+	}
+	if overridden {
+		return
+	}
+	ext := strings.TrimPrefix(path.Ext(name), ".")
+	if imageContentTypes[mediaExtension(name)] == want {
+		fixed := false
+		for i, d := range p.contentTypes.Default {
+			if strings.EqualFold(d.Extension, ext) {
+				p.contentTypes.Default[i].ContentType = want
+				fixed = true
+			}
+		}
+		if !fixed {
+			p.contentTypes.AddDefault(ext, want)
+		}
+	} else {
+		p.contentTypes.Override = append(p.contentTypes.Override, TypeOverride{PartName: "/" + name, ContentType: want})
+	}
+}
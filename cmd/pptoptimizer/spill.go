@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// replaced tells whether the content of a media differs from the source file
+func (m Media) replaced() bool {
+	return m.data != nil || m.file != ""
+}
+
+// SetMemoryBudget sets the maximum size of the new media contents kept in memory, 0 for no limit.
+// Beyond it, new contents are spilled to temporary files, removed by Close.
+func (p *PowerpointDoc) SetMemoryBudget(budget int64) {
+	p.memBudget = budget
+}
+
+func (p *PowerpointDoc) inMemorySize() int64 {
+	size := int64(0)
+	for _, m := range p.medias {
+		size += int64(len(m.data))
+	}
+	return size
+}
+
+// newMedia holds a new media content, in memory or in a temporary file when over the memory budget
+func (p *PowerpointDoc) newMedia(data []byte) Media {
+	m := Media{size: uint64(len(data)), data: data}
+	if p.memBudget <= 0 || p.inMemorySize()+int64(len(data)) <= p.memBudget {
+		return m
+	}
+	f, err := ioutil.TempFile("", "pptoptimizer-media-*")
+	if err != nil {
+		log.Warnln("cannot spill media to a temporary file, keep it in memory:", err)
+		return m
+	}
+	p.spilled = append(p.spilled, f.Name())
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Warnln("cannot spill media to a temporary file, keep it in memory:", err)
+		return m
+	}
+	log.Debugln("spilled", len(data), "bytes to", f.Name())
+	return Media{size: m.size, file: f.Name()}
+}
+
+// copySpilled duplicates a spilled media, for a clone
+func (p *PowerpointDoc) copySpilled(file string) (string, error) {
+	in, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	out, err := ioutil.TempFile("", "pptoptimizer-media-*")
+	if err != nil {
+		return "", err
+	}
+	p.spilled = append(p.spilled, out.Name())
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return out.Name(), err
+}
+
+func (p *PowerpointDoc) removeSpilled() {
+	for _, name := range p.spilled {
+		os.Remove(name)
+	}
+	p.spilled = nil
+}
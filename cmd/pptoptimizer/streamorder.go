@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// stagedEntry is a part held until the package is closed, in memory or in a temporary file for medias
+type stagedEntry struct {
+	name string
+	buf  bytes.Buffer
+	file *os.File
+	size int64
+}
+
+func (e *stagedEntry) Write(b []byte) (int, error) {
+	e.size += int64(len(b))
+	if e.file != nil {
+		return e.file.Write(b)
+	}
+	return e.buf.Write(b)
+}
+
+func isMediaPart(name string) bool {
+	return strings.HasPrefix(name, "ppt/media/") || strings.HasPrefix(name, "ppt/embeddings/")
+}
+
+// streamRank orders the parts for progressive loading: content types, package and presentation
+// relationships and presentation first, then other xml parts, then medias
+func streamRank(name string) int {
+	switch {
+	case name == "[Content_Types].xml":
+		return 0
+	case name == "_rels/.rels":
+		return 1
+	case name == "ppt/presentation.xml" || name == "ppt/_rels/presentation.xml.rels":
+		return 2
+	case isMediaPart(name):
+		return 4
+	}
+	return 3
+}
+
+func (pw *packageWriter) stageEntry(name string) io.Writer {
+	e := &stagedEntry{name: name}
+	if isMediaPart(name) {
+		f, err := ioutil.TempFile("", "pptoptimizer-part-*")
+		if err != nil {
+			log.Warnln("cannot stage", name, "in a temporary file, keep it in memory:", err)
+		} else {
+			e.file = f
+		}
+	}
+	pw.staged = append(pw.staged, e)
+	return e
+}
+
+// flushStaged writes the staged parts in streaming order, smaller medias first
+func (pw *packageWriter) flushStaged() error {
+	defer pw.discardStaged()
+	sort.SliceStable(pw.staged, func(i, j int) bool {
+		a, b := pw.staged[i], pw.staged[j]
+		if ra, rb := streamRank(a.name), streamRank(b.name); ra != rb {
+			return ra < rb
+		}
+		return isMediaPart(a.name) && a.size < b.size
+	})
+	for _, e := range pw.staged {
+		log.Debugln("write", e.name, e.size)
+		w, err := pw.Writer.Create(e.name)
+		if err != nil {
+			return err
+		}
+		var r io.Reader = &e.buf
+		if e.file != nil {
+			if _, err := e.file.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			r = e.file
+		}
+		if _, err := io.Copy(w, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// discardStaged removes the temporary files of the staged parts
+func (pw *packageWriter) discardStaged() {
+	for _, e := range pw.staged {
+		if e.file != nil {
+			e.file.Close()
+			os.Remove(e.file.Name())
+		}
+	}
+	pw.staged = nil
+}
+
+// SetStreamOrder writes the content types and xml parts before the medias, the largest last,
+// so that viewers streaming the file can render it before it is fully downloaded
+func (p *PowerpointDoc) SetStreamOrder(streamOrder bool) {
+	p.streamOrder = streamOrder
+}
+
+// IsStreamOrdered tells whether the source file already has its content types first and its medias last
+func (p *PowerpointDoc) IsStreamOrdered() bool {
+	files := p.sourceFileReader.File
+	if len(files) == 0 || files[0].Name != "[Content_Types].xml" {
+		return false
+	}
+	media := false
+	for _, f := range files {
+		if isMediaPart(f.Name) {
+			media = true
+		} else if media && !strings.HasSuffix(f.Name, "/") {
+			return false
+		}
+	}
+	return true
+}
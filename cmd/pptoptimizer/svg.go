@@ -0,0 +1,145 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/beevik/etree"
+	log "github.com/sirupsen/logrus"
+)
+
+// namespaces of the private data that drawing tools leave in their svg exports, which no viewer renders
+var svgEditorNamespaces = map[string]bool{
+	"http://www.inkscape.org/namespaces/inkscape":            true,
+	"http://sodipodi.sourceforge.net/DTD/sodipodi-0.dtd":     true,
+	"http://www.bohemiancoding.com/sketch/ns":                true,
+	"http://ns.adobe.com/AdobeIllustrator/10.0/":             true,
+	"http://ns.adobe.com/Extensibility/1.0/":                 true,
+	"http://ns.adobe.com/SaveForWeb/1.0/":                    true,
+	"http://ns.adobe.com/Variables/1.0/":                     true,
+	"http://ns.adobe.com/ImageReplacement/1.0/":              true,
+	"http://ns.adobe.com/Graphs/1.0/":                        true,
+	"http://ns.adobe.com/AdobeSVGViewerExtensions/3.0/":      true,
+	"http://ns.adobe.com/Flows/1.0/":                         true,
+	"http://www.serif.com/":                                  true,
+	"http://www.figma.com/figma/ns":                          true,
+	"http://schemas.microsoft.com/visio/2003/SVGExtensions/": true,
+}
+
+// svgPreservesSpace tells whether the whitespace between the children of an svg element is rendered
+func svgPreservesSpace(e *etree.Element) bool {
+	return e.Tag == "text" || e.Tag == "tspan" || e.Tag == "textPath" || e.Tag == "style" ||
+		e.SelectAttrValue("xml:space", "") == "preserve"
+}
+
+// isSVGEditorSpace tells whether a prefix is bound to a drawing tool namespace in the scope of an element
+func isSVGEditorSpace(e *etree.Element, prefix string) bool {
+	return prefix != "" && svgEditorNamespaces[namespaceURI(e, prefix)]
+}
+
+// minifySVGElement removes the comments, metadata, drawing tool elements and attributes, and the whitespace
+// between elements outside of text, and collects the namespace prefixes still in use
+func minifySVGElement(e *etree.Element, preserve bool, used map[string]bool) {
+	attrs := e.Attr[:0]
+	for _, a := range e.Attr {
+		if a.Space != "xmlns" && isSVGEditorSpace(e, a.Space) {
+			continue
+		}
+		if a.Space != "" && a.Space != "xmlns" {
+			used[a.Space] = true
+		}
+		attrs = append(attrs, a)
+	}
+	e.Attr = attrs
+	used[e.Space] = true
+
+	preserve = preserve || svgPreservesSpace(e)
+	keepSpace := preserve || len(e.ChildElements()) == 0
+	for i := 0; i < len(e.Child); i++ {
+		remove := false
+		switch c := e.Child[i].(type) {
+		case *etree.Comment:
+			remove = true
+		case *etree.CharData:
+			remove = !keepSpace && c.IsWhitespace()
+		case *etree.Element:
+			remove = c.Tag == "metadata" || isSVGEditorSpace(c, c.Space)
+			if !remove {
+				minifySVGElement(c, preserve, used)
+			}
+		}
+		if remove {
+			e.RemoveChildAt(i)
+			i--
+		}
+	}
+}
+
+// minifySVG strips an svg of what does not change its rendering, it returns nil if it cannot be parsed,
+// or declares entities, as Illustrator exports do, which the parser does not expand
+func minifySVG(data []byte) []byte {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil || doc.Root() == nil || doc.Root().Tag != "svg" {
+		return nil
+	}
+	for i := 0; i < len(doc.Child); i++ {
+		remove := false
+		switch c := doc.Child[i].(type) {
+		case *etree.Directive:
+			if strings.Contains(c.Data, "ENTITY") {
+				return nil
+			}
+			remove = true // doctype of svg 1.1, not needed
+		case *etree.Comment:
+			remove = true
+		case *etree.CharData:
+			remove = c.IsWhitespace()
+		}
+		if remove {
+			doc.RemoveChildAt(i)
+			i--
+		}
+	}
+	used := make(map[string]bool)
+	minifySVGElement(doc.Root(), false, used)
+	// declarations of the removed namespaces, such as those of the rdf metadata
+	root := doc.Root()
+	attrs := root.Attr[:0]
+	for _, a := range root.Attr {
+		if a.Space == "xmlns" && !used[a.Key] {
+			continue
+		}
+		attrs = append(attrs, a)
+	}
+	root.Attr = attrs
+	out, err := doc.WriteToBytes()
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+// MinifySVGs strips the svg medias, shown by PowerPoint 2016 and later next to their png fallback, of comments,
+// metadata, drawing tool data and indentation, and keeps the result when it is smaller
+func (p *PowerpointDoc) MinifySVGs() {
+	for _, name := range p.MediaNames() {
+		if mediaExtension(name) != "svg" || p.isMediaKept(name) {
+			continue
+		}
+		data, err := p.ReadMedia(name)
+		if err != nil {
+			p.Problem(err)
+			continue
+		}
+		out := minifySVG(data)
+		if out == nil {
+			log.Warnln("cannot minify svg", name, ", keep it as is")
+			continue
+		}
+		if len(out) >= len(data) {
+			log.Debugln("minified svg", name, "is not smaller, keep original")
+			continue
+		}
+		log.Infoln("minified svg", name, len(data), "->", len(out))
+		p.ReplaceMedia(name, out, "minified svg")
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/beevik/etree"
+)
+
+// extension of a:blip holding the svg version of a picture, the blip itself referencing the png fallback
+const svgBlipExtURI = "{96DAC541-7B7A-43D3-8B79-37D633B846F1}"
+
+var svgModes = []string{"svg", "png"}
+
+func checkSVGMode(mode string) error {
+	for _, m := range svgModes {
+		if mode == m {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown svg mode %s, expected svg or png", mode)
+}
+
+// dropBlipAlternates removes from the pictures having both an svg and a png the png fallback when mode is svg,
+// or the svg extension when mode is png, it returns whether the document changed
+func dropBlipAlternates(doc *etree.Document, mode string) bool {
+	changed := false
+	for _, blip := range doc.FindElements("//a:blip") {
+		for _, ext := range blip.FindElements("a:extLst/a:ext[@uri='" + svgBlipExtURI + "']") {
+			svgBlip := ext.SelectElement("asvg:svgBlip")
+			if svgBlip == nil || svgBlip.SelectAttrValue("r:embed", "") == "" || blip.SelectAttrValue("r:embed", "") == "" {
+				continue
+			}
+			changed = true
+			if mode == "svg" {
+				// PowerPoint 2016 and later only read the extension
+				blip.RemoveAttr("r:embed")
+			} else {
+				extLst := ext.Parent()
+				extLst.RemoveChild(ext)
+				if len(extLst.ChildElements()) == 0 {
+					blip.RemoveChild(extLst)
+				}
+			}
+		}
+	}
+	return changed
+}
+
+// DropSVGAlternates keeps a single version of the pictures stored both as svg and as png: the svg when mode is svg,
+// which viewers older than PowerPoint 2016 cannot display, or the png when mode is png, which loses the vector quality.
+// The medias no longer referenced are removed.
+func (p *PowerpointDoc) DropSVGAlternates(mode string) {
+	if p.xmlLocked("drop svg alternates") {
+		return
+	}
+	p.editMediaReferences("alternate of "+mode+" picture", func(doc *etree.Document) bool {
+		return dropBlipAlternates(doc, mode)
+	})
+}
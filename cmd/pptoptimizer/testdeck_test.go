@@ -0,0 +1,345 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/beevik/etree"
+)
+
+const testNamespaces = `xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" ` +
+	`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" ` +
+	`xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main"`
+
+// testDeck builds small presentations for the tests, the rels parts and the shape trees being rendered on write
+type testDeck struct {
+	parts  map[string][]byte
+	rels   map[string][]Relationship // by source part
+	shapes map[string][]string       // xml added to the shape tree of slides, layouts and masters
+	zeros  map[string]int64          // parts of zero bytes, written without holding them in memory
+	types  Types
+	strict bool // written with the relationship types and namespaces of the strict format
+}
+
+// transitional namespaces and relationship types, and their strict counterparts
+var strictReplacer = strings.NewReplacer(
+	relTypeTransitional, relTypeStrict,
+	"http://schemas.openxmlformats.org/officeDocument/2006/relationships", "http://purl.oclc.org/ooxml/officeDocument/relationships",
+	"http://schemas.openxmlformats.org/presentationml/2006/main", "http://purl.oclc.org/ooxml/presentationml/main",
+	"http://schemas.openxmlformats.org/drawingml/2006/main", "http://purl.oclc.org/ooxml/drawingml/main",
+)
+
+// newTestDeck returns a presentation of a master with one layout and theme, and slides using the layout
+func newTestDeck(slides int) *testDeck {
+	d := &testDeck{parts: make(map[string][]byte), rels: make(map[string][]Relationship), shapes: make(map[string][]string), zeros: make(map[string]int64)}
+	d.types.Default = []TypeDefault{
+		{Extension: "rels", ContentType: "application/vnd.openxmlformats-package.relationships+xml"},
+		{Extension: "xml", ContentType: "application/xml"},
+		{Extension: "png", ContentType: "image/png"},
+		{Extension: "jpeg", ContentType: "image/jpeg"},
+	}
+	d.rel("", "officeDocument", "ppt/presentation.xml")
+	d.add("ppt/theme/theme1.xml", relationshipContentTypes["theme"], `<a:theme `+testNamespaces+` name="Office"/>`)
+	d.add("ppt/slideMasters/slideMaster1.xml", relationshipContentTypes["slideMaster"], `<p:sldMaster `+testNamespaces+`><p:cSld><p:spTree>{shapes}</p:spTree></p:cSld>`+
+		`<p:sldLayoutIdLst><p:sldLayoutId id="2147483649" r:id="rId1"/></p:sldLayoutIdLst></p:sldMaster>`)
+	d.rel("ppt/slideMasters/slideMaster1.xml", "slideLayout", "../slideLayouts/slideLayout1.xml")
+	d.rel("ppt/slideMasters/slideMaster1.xml", "theme", "../theme/theme1.xml")
+	d.add("ppt/slideLayouts/slideLayout1.xml", relationshipContentTypes["slideLayout"], `<p:sldLayout `+testNamespaces+`><p:cSld><p:spTree>{shapes}</p:spTree></p:cSld></p:sldLayout>`)
+	d.rel("ppt/slideLayouts/slideLayout1.xml", "slideMaster", "../slideMasters/slideMaster1.xml")
+
+	d.rel("ppt/presentation.xml", "slideMaster", "slideMasters/slideMaster1.xml")
+	d.rel("ppt/presentation.xml", "theme", "theme/theme1.xml")
+	ids := ""
+	for i := 1; i <= slides; i++ {
+		name := fmt.Sprintf("ppt/slides/slide%d.xml", i)
+		d.add(name, relationshipContentTypes["slide"], `<p:sld `+testNamespaces+`><p:cSld><p:spTree>{shapes}</p:spTree></p:cSld></p:sld>`)
+		d.rel(name, "slideLayout", "../slideLayouts/slideLayout1.xml")
+		id := d.rel("ppt/presentation.xml", "slide", fmt.Sprintf("slides/slide%d.xml", i))
+		ids += fmt.Sprintf(`<p:sldId id="%d" r:id="%s"/>`, 255+i, id)
+	}
+	d.add("ppt/presentation.xml", mainContentTypes[".pptx"],
+		`<p:presentation `+testNamespaces+`><p:sldMasterIdLst><p:sldMasterId id="2147483648" r:id="rId1"/></p:sldMasterIdLst>`+
+			`<p:sldIdLst>`+ids+`</p:sldIdLst><p:sldSz cx="9144000" cy="6858000"/><p:notesSz cx="6858000" cy="9144000"/></p:presentation>`)
+	return d
+}
+
+// layout adds a layout to the master, with a relationship to it unless orphan, and returns its name
+func (d *testDeck) layout(orphan bool) string {
+	master := "ppt/slideMasters/slideMaster1.xml"
+	n := 1
+	for d.parts[fmt.Sprintf("ppt/slideLayouts/slideLayout%d.xml", n)] != nil {
+		n++
+	}
+	name := fmt.Sprintf("ppt/slideLayouts/slideLayout%d.xml", n)
+	d.add(name, relationshipContentTypes["slideLayout"], `<p:sldLayout `+testNamespaces+`><p:cSld name="Layout `+strconv.Itoa(n)+`"><p:spTree>{shapes}</p:spTree></p:cSld></p:sldLayout>`)
+	if !orphan {
+		d.rel(name, "slideMaster", "../slideMasters/slideMaster1.xml")
+	}
+	id := d.rel(master, "slideLayout", "../slideLayouts/"+path.Base(name))
+	d.parts[master] = []byte(strings.Replace(string(d.parts[master]), "</p:sldLayoutIdLst>",
+		fmt.Sprintf(`<p:sldLayoutId id="%d" r:id="%s"/></p:sldLayoutIdLst>`, 2147483648+n, id), 1))
+	return name
+}
+
+// master adds a master without layouts, using a theme, and returns its name
+func (d *testDeck) master(theme string) string {
+	n := 1
+	for d.parts[fmt.Sprintf("ppt/slideMasters/slideMaster%d.xml", n)] != nil {
+		n++
+	}
+	name := fmt.Sprintf("ppt/slideMasters/slideMaster%d.xml", n)
+	d.add(name, relationshipContentTypes["slideMaster"], `<p:sldMaster `+testNamespaces+`><p:cSld><p:spTree>{shapes}</p:spTree></p:cSld><p:sldLayoutIdLst></p:sldLayoutIdLst></p:sldMaster>`)
+	d.rel(name, "theme", "../theme/"+path.Base(theme))
+	presentation := "ppt/presentation.xml"
+	id := d.rel(presentation, "slideMaster", "slideMasters/"+path.Base(name))
+	d.parts[presentation] = []byte(strings.Replace(string(d.parts[presentation]), "</p:sldMasterIdLst>",
+		fmt.Sprintf(`<p:sldMasterId id="%d" r:id="%s"/></p:sldMasterIdLst>`, 2147483648+100*n, id), 1))
+	return name
+}
+
+// add sets the content of a part, with a content type override unless empty
+func (d *testDeck) add(name string, contentType string, content string) {
+	d.addBytes(name, contentType, []byte(content))
+}
+
+func (d *testDeck) addBytes(name string, contentType string, data []byte) {
+	d.parts[name] = data
+	if contentType != "" {
+		d.types.Override = append(d.types.Override, TypeOverride{PartName: "/" + name, ContentType: contentType})
+	}
+}
+
+// rel adds a relationship of a kind such as image to the source part, "" for the package, and returns its id
+func (d *testDeck) rel(source string, kind string, target string) string {
+	id := fmt.Sprintf("rId%d", len(d.rels[source])+1)
+	d.relWithId(source, id, kind, target)
+	return id
+}
+
+func (d *testDeck) relWithId(source string, id string, kind string, target string) {
+	r := Relationship{Id: id, Type: relTypeTransitional + kind, Target: target}
+	if strings.Contains(target, "://") {
+		r.TargetMode = "External"
+	}
+	d.rels[source] = append(d.rels[source], r)
+}
+
+// picture adds a picture shape to a slide, layout or master, embedding or linking a relationship
+func (d *testDeck) picture(part string, attr string, id string) {
+	d.shapes[part] = append(d.shapes[part], fmt.Sprintf(`<p:pic><p:nvPicPr><p:cNvPr id="%d" name="Picture"/><p:cNvPicPr/><p:nvPr/></p:nvPicPr>`+
+		`<p:blipFill><a:blip %s="%s"/></p:blipFill><p:spPr/></p:pic>`, len(d.shapes[part])+2, attr, id))
+}
+
+// image adds a media part and a picture of the source part showing it
+func (d *testDeck) image(source string, name string, data []byte) string {
+	d.addBytes(name, "", data)
+	target := name
+	if strings.HasPrefix(source, "ppt/") {
+		target = "../" + strings.TrimPrefix(name, "ppt/")
+	}
+	id := d.rel(source, "image", target)
+	d.picture(source, "r:embed", id)
+	return id
+}
+
+// bytes renders the package as a zip file
+func (d *testDeck) bytes(t *testing.T) []byte {
+	t.Helper()
+	buf := bytes.NewBuffer(nil)
+	z := zip.NewWriter(buf)
+	write := func(name string, data []byte) {
+		w, err := z.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ct, err := xml.Marshal(d.types)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write("[Content_Types].xml", append([]byte(xmlHeader), ct...))
+	sources := make([]string, 0, len(d.rels))
+	for source := range d.rels {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		rels, err := xml.Marshal(Relationships{Relationship: d.rels[source]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.strict {
+			rels = []byte(strictReplacer.Replace(string(rels)))
+		}
+		name := "_rels/.rels"
+		if source != "" {
+			name = relsPartName(source)
+		}
+		write(name, append([]byte(xmlHeader), rels...))
+	}
+	names := make([]string, 0, len(d.parts))
+	for name := range d.parts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		data := d.parts[name]
+		if path.Ext(name) == ".xml" {
+			data = []byte(xmlHeader + strings.Replace(string(data), "{shapes}", strings.Join(d.shapes[name], ""), 1))
+			if d.strict {
+				data = []byte(strictReplacer.Replace(string(data)))
+			}
+		}
+		write(name, data)
+	}
+	zero := make([]byte, 1<<20)
+	for name, size := range d.zeros {
+		w, err := z.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for n := int64(0); n < size; n += int64(len(zero)) {
+			if size-n < int64(len(zero)) {
+				zero = zero[:size-n]
+			}
+			if _, err := w.Write(zero); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// write saves the package in a temporary directory and returns its path
+func (d *testDeck) write(t *testing.T) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "deck.pptx")
+	if err := ioutil.WriteFile(name, d.bytes(t), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+// parse writes the package and parses it, the document being closed at the end of the test
+func (d *testDeck) parse(t *testing.T) *PowerpointDoc {
+	t.Helper()
+	return parseTestFile(t, d.write(t))
+}
+
+func parseTestFile(t *testing.T, name string) *PowerpointDoc {
+	t.Helper()
+	p := NewPowerpointDoc()
+	if err := p.ParseFile(name); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.Close)
+	return p
+}
+
+// saveTestFile saves a document in a temporary directory and returns the path and parts of the output
+func saveTestFile(t *testing.T, p *PowerpointDoc) (string, map[string][]byte) {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "out.pptx")
+	if err := p.SaveFile(name); err != nil {
+		t.Fatal(err)
+	}
+	return name, readTestZip(t, name)
+}
+
+func readTestZip(t *testing.T, name string) map[string][]byte {
+	t.Helper()
+	r, err := zip.OpenReader(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	parts := make(map[string][]byte, len(r.File))
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", f.Name, err)
+		}
+		parts[f.Name] = data
+	}
+	return parts
+}
+
+// assertReferencesResolve checks that every r:id, r:embed, r:link and other relationship attribute of the xml parts
+// names a relationship of the part, and that internal relationships target parts of the package
+func assertReferencesResolve(t *testing.T, parts map[string][]byte) {
+	t.Helper()
+	for name, data := range parts {
+		if path.Ext(name) != ".xml" && path.Ext(name) != ".rels" {
+			continue
+		}
+		rels := Relationships{}
+		if relsData, ok := parts[relsPartName(name)]; ok {
+			if err := xml.Unmarshal(relsData, &rels); err != nil {
+				t.Fatalf("%s: %v", relsPartName(name), err)
+			}
+		}
+		ids := make(map[string]bool, len(rels.Relationship))
+		for _, rel := range rels.Relationship {
+			if ids[rel.Id] {
+				t.Errorf("%s has the relationship id %s twice", relsPartName(name), rel.Id)
+			}
+			ids[rel.Id] = true
+			if rel.TargetMode == "External" {
+				continue
+			}
+			if target := resolveTarget(name, rel.Target); parts[target] == nil {
+				t.Errorf("%s: relationship %s targets the missing part %s", name, rel.Id, target)
+			}
+		}
+		if path.Ext(name) != ".xml" {
+			continue
+		}
+		doc := etree.NewDocument()
+		if err := doc.ReadFromBytes(data); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for _, e := range doc.FindElements("//*") {
+			for _, a := range e.Attr {
+				if a.Space == "r" && !ids[a.Value] {
+					t.Errorf("%s: %s r:%s=%q names no relationship", name, e.Tag, a.Key, a.Value)
+				}
+			}
+		}
+	}
+}
+
+// testPNG returns an opaque png of a size, with a pattern so that it compresses differently from other sizes
+func testPNG(w int, h int) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{uint8(x * 7), uint8(y * 13), uint8(x ^ y), 255})
+		}
+	}
+	buf := bytes.NewBuffer(nil)
+	png.Encode(buf, img)
+	return buf.Bytes()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"regexp"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var reThemePart = regexp.MustCompile(`^ppt/theme/theme[0-9]+\.xml$`)
+
+// FindUsedThemes counts the references to each theme, from the presentation, the masters that are not removed
+// and the notes and handout masters. Several masters may share a theme.
+func (p *PowerpointDoc) FindUsedThemes() map[string]int {
+	used := make(map[string]int)
+	count := func(source string, rels Relationships) {
+		for _, rel := range rels.Relationship {
+			if rel.Is("theme") && rel.TargetMode != "External" {
+				used[resolveTarget(source, rel.Target)]++
+			}
+		}
+	}
+	count("ppt/presentation.xml", p.presentationRels)
+	for i, rels := range p.slideMasterRels {
+		if !p.IsMasterRemoved(i) {
+			count(partName("slideMaster", i), rels)
+		}
+	}
+	for source, rels := range p.otherRels {
+		count(source, rels)
+	}
+	return used
+}
+
+// RemoveUnusedThemes removes the themes no longer referenced, such as those of removed masters
+func (p *PowerpointDoc) RemoveUnusedThemes() {
+	if p.xmlLocked("remove unused themes") {
+		return
+	}
+	used := p.FindUsedThemes()
+	for _, f := range p.sourceFileReader.File {
+		if !reThemePart.MatchString(f.Name) || p.removedParts[f.Name] {
+			continue
+		}
+		if used[f.Name] > 0 {
+			log.Debugln("theme", f.Name, "used", used[f.Name], "times")
+			continue
+		}
+		log.Infoln("remove unused theme", f.Name)
+		p.removeTheme(f.Name)
+	}
+}
+
+func (p *PowerpointDoc) removeTheme(name string) {
+	p.removedParts[name] = true
+	delete(p.otherRels, name) // its medias become unused
+	delete(p.parts, name)
+	p.contentTypes.RemoveOverride(name)
+}
@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestSharedThemeSurvivesMasterRemoval(t *testing.T) {
+	d := newTestDeck(1)
+	d.master("ppt/theme/theme1.xml") // shares the theme of the first master, unused
+	d.add("ppt/theme/theme2.xml", relationshipContentTypes["theme"], `<a:theme `+testNamespaces+` name="Other"/>`)
+	d.image("ppt/theme/theme2.xml", "ppt/media/image1.png", testPNG(10, 10))
+	d.master("ppt/theme/theme2.xml") // unused
+	p := d.parse(t)
+	if used := p.FindUsedThemes(); used["ppt/theme/theme1.xml"] != 3 || used["ppt/theme/theme2.xml"] != 1 {
+		t.Errorf("theme references %v, want theme1 from the presentation and 2 masters, theme2 from 1", used)
+	}
+	p.RemoveUnusedLayouts()
+	p.RemoveUnusedMasters()
+	if p.IsMasterRemoved(0) || !p.IsMasterRemoved(1) || !p.IsMasterRemoved(2) {
+		t.Fatalf("masters removed %v, want the second and third", p.removedMasters)
+	}
+	if used := p.FindUsedThemes(); used["ppt/theme/theme1.xml"] != 2 || used["ppt/theme/theme2.xml"] != 0 {
+		t.Errorf("theme references %v, want theme1 from the presentation and 1 master", used)
+	}
+	p.RemoveUnusedThemes()
+	p.RemoveUnusedMedias()
+
+	_, parts := saveTestFile(t, p)
+	assertReferencesResolve(t, parts)
+	for name, want := range map[string]bool{
+		"ppt/theme/theme1.xml":              true,
+		"ppt/theme/theme2.xml":              false,
+		"ppt/theme/_rels/theme2.xml.rels":   false,
+		"ppt/media/image1.png":              false,
+		"ppt/slideMasters/slideMaster2.xml": false,
+		"ppt/slideMasters/slideMaster3.xml": false,
+	} {
+		if got := parts[name] != nil; got != want {
+			t.Errorf("%s in output: %v, want %v", name, got, want)
+		}
+	}
+}
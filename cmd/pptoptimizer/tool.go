@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// toolOutput tells where an external tool writes its result
+type toolOutput int
+
+const (
+	outputInPlace toolOutput = iota // updates the file given as {}, or writes on stdout when reading stdin
+	outputStdout                    // writes on stdout, even when reading the file given as {}
+)
+
+// writeToolInput writes the input of an external tool to a temporary file, which the caller removes
+func writeToolInput(ext string, data []byte) (string, error) {
+	tmpf, err := ioutil.TempFile("", "pptoptimizer-*."+ext)
+	if err != nil {
+		return "", err
+	}
+	_, err = tmpf.Write(data)
+	tmpf.Close()
+	if err != nil {
+		os.Remove(tmpf.Name())
+		return "", err
+	}
+	return tmpf.Name(), nil
+}
+
+// runExternalTool pipes data through an external command. If the command contains {},
+// it is replaced with the path of a temporary file which the command must update in place,
+// unless output is outputStdout. If it contains {text}, it is replaced with the path of
+// a temporary file holding text.
+func runExternalTool(command string, ext string, data []byte, text string, output toolOutput) ([]byte, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, errors.New("empty command")
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return nil, err
+	}
+
+	var tmpname, textname string
+	for i, a := range args {
+		if strings.Contains(a, "{text}") {
+			if textname == "" {
+				name, err := writeToolInput("txt", []byte(text))
+				if err != nil {
+					return nil, err
+				}
+				textname = name
+				defer os.Remove(textname)
+			}
+			a = strings.Replace(a, "{text}", textname, -1)
+		}
+		if strings.Contains(a, "{}") {
+			if tmpname == "" {
+				name, err := writeToolInput(ext, data)
+				if err != nil {
+					return nil, err
+				}
+				tmpname = name
+				defer os.Remove(tmpname)
+			}
+			a = strings.Replace(a, "{}", tmpname, -1)
+		}
+		args[i] = a
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	stdout := bytes.NewBuffer(nil)
+	stderr := bytes.NewBuffer(nil)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if tmpname == "" {
+		cmd.Stdin = bytes.NewReader(data)
+	}
+	if err := cmd.Run(); err != nil {
+		return nil, errors.New(err.Error() + ": " + strings.TrimSpace(stderr.String()))
+	}
+	if tmpname != "" && output == outputInPlace {
+		return ioutil.ReadFile(tmpname)
+	}
+	return stdout.Bytes(), nil
+}
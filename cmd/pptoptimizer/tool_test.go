@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestRunExternalTool(t *testing.T) {
+	tests := []struct {
+		command string
+		output  toolOutput
+		want    string
+	}{
+		{"cat", outputInPlace, "data"},
+		{"cp {text} {}", outputInPlace, "text"},
+		{"cat {text} {}", outputStdout, "textdata"},
+	}
+	for _, tt := range tests {
+		out, err := runExternalTool(tt.command, "bin", []byte("data"), "text", tt.output)
+		if err != nil {
+			t.Errorf("%s: %v", tt.command, err)
+		} else if string(out) != tt.want {
+			t.Errorf("%s: %q, want %q", tt.command, out, tt.want)
+		}
+	}
+}
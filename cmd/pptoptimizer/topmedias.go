@@ -0,0 +1,43 @@
+package main
+
+import (
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SelectTopMedias restricts the media optimizations to the largest medias which together account for pct percent
+// of the media bytes, leaving the long tail of small ones, such as icons, untouched. 100 selects all medias.
+func (p *PowerpointDoc) SelectTopMedias(pct int) {
+	p.mediaTail = nil
+	if pct >= 100 {
+		return
+	}
+	names := p.MediaNames()
+	total := uint64(0)
+	for _, name := range names {
+		total += p.medias[name].size
+	}
+	// largest first, by name for equal sizes
+	sort.SliceStable(names, func(i, j int) bool { return p.medias[names[i]].size > p.medias[names[j]].size })
+
+	p.mediaTail = make(map[string]bool)
+	selected := uint64(0)
+	count := 0
+	for _, name := range names {
+		// a media is selected until the selected ones reach pct percent of the total
+		if selected*100 < total*uint64(pct) {
+			selected += p.medias[name].size
+			count++
+			continue
+		}
+		p.mediaTail[name] = true
+		log.Debugln("leave small media", name, p.medias[name].size, "untouched")
+	}
+	log.Infoln("optimize the", count, "largest medias of", len(names), ",", selected, "of", total, "bytes")
+}
+
+// inMediaTail tells whether a media is among the small ones left out by SelectTopMedias
+func (p *PowerpointDoc) inMediaTail(name string) bool {
+	return p.mediaTail[name]
+}
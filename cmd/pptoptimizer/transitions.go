@@ -0,0 +1,25 @@
+package main
+
+import (
+	"github.com/beevik/etree"
+)
+
+// removeTransitionSounds removes the sounds played by the transitions of a slide, layout or master,
+// in the PowerPoint 2010 alternate content as well, it returns whether the document changed
+func removeTransitionSounds(doc *etree.Document) bool {
+	changed := false
+	for _, snd := range doc.FindElements("//p:transition/p:sndAc") {
+		snd.Parent().RemoveChild(snd)
+		changed = true
+	}
+	return changed
+}
+
+// RemoveTransitionSounds silences the slide transitions, and removes the audio files they played
+// unless an animation or another slide still plays them
+func (p *PowerpointDoc) RemoveTransitionSounds() {
+	if p.xmlLocked("remove transition sounds") {
+		return
+	}
+	p.editMediaReferences("transition sound", removeTransitionSounds)
+}
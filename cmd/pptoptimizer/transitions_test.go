@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"path"
+	"strings"
+	"testing"
+)
+
+// transitionSound adds a transition to a slide playing a sound, with the alternate content of PowerPoint 2010,
+// and an animation playing it too if animated, it returns the relationship id of the sound
+func (d *testDeck) transitionSound(slide string, media string, data []byte, animated bool) string {
+	d.addBytes(media, "", data)
+	id := d.rel(slide, "audio", "../media/"+path.Base(media))
+	snd := `<p:sndAc><p:stSnd><p:snd r:embed="` + id + `" name="sound.wav"/></p:stSnd></p:sndAc>`
+	xml := `<mc:AlternateContent xmlns:mc="http://schemas.openxmlformats.org/markup-compatibility/2006">` +
+		`<mc:Choice xmlns:p14="http://schemas.microsoft.com/office/powerpoint/2010/main" Requires="p14"><p:transition spd="slow" p14:dur="2000"><p:fade/>` + snd + `</p:transition></mc:Choice>` +
+		`<mc:Fallback><p:transition spd="slow"><p:fade/>` + snd + `</p:transition></mc:Fallback></mc:AlternateContent>`
+	if animated {
+		xml += `<p:timing><p:tnLst><p:par><p:cTn id="1"><p:childTnLst><p:audio><p:cMediaNode><p:cTn id="2"/>` +
+			`<p:tgtEl><p:sndTgt r:embed="` + id + `" name="sound.wav"/></p:tgtEl></p:cMediaNode></p:audio></p:childTnLst></p:cTn></p:par></p:tnLst></p:timing>`
+	}
+	d.parts[slide] = []byte(strings.Replace(string(d.parts[slide]), "</p:sld>", xml+"</p:sld>", 1))
+	return id
+}
+
+func TestTransitionSounds(t *testing.T) {
+	chime := []byte("RIFF\x04\x00\x00\x00WAVEchime")
+	applause := []byte("RIFF\x04\x00\x00\x00WAVEapplause")
+	for _, remove := range []bool{false, true} {
+		d := newTestDeck(2)
+		d.transitionSound("ppt/slides/slide1.xml", "ppt/media/chime.wav", chime, false)
+		d.transitionSound("ppt/slides/slide2.xml", "ppt/media/applause.wav", applause, true)
+		p := d.parse(t)
+		if remove {
+			p.RemoveTransitionSounds()
+		}
+		p.RemoveUnusedMedias()
+		_, parts := saveTestFile(t, p)
+
+		assertReferencesResolve(t, parts)
+		if !bytes.Equal(parts["ppt/media/applause.wav"], applause) {
+			t.Errorf("remove %v: sound played by an animation removed", remove)
+		}
+		if kept := bytes.Equal(parts["ppt/media/chime.wav"], chime); kept == remove {
+			t.Errorf("remove %v: sound of a transition kept %v", remove, kept)
+		}
+		for _, slide := range []string{"ppt/slides/slide1.xml", "ppt/slides/slide2.xml"} {
+			if n := strings.Count(string(parts[slide]), "<p:sndAc>"); (n == 2) == remove {
+				t.Errorf("remove %v: %d transition sounds in %s", remove, n, slide)
+			}
+			if !strings.Contains(string(parts[slide]), "<p:fade/>") {
+				t.Errorf("remove %v: transition of %s removed", remove, slide)
+			}
+		}
+		if rels := string(parts["ppt/slides/_rels/slide1.xml.rels"]); strings.Contains(rels, "chime.wav") == remove {
+			t.Errorf("remove %v: relationships of the first slide:\n%s", remove, rels)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// warningCounter is a logrus hook counting the warnings logged, for -failonwarn
+type warningCounter struct {
+	mu    sync.Mutex
+	count int
+}
+
+func (w *warningCounter) Levels() []log.Level {
+	return []log.Level{log.WarnLevel}
+}
+
+func (w *warningCounter) Fire(*log.Entry) error {
+	w.mu.Lock()
+	w.count++
+	w.mu.Unlock()
+	return nil
+}
+
+func (w *warningCounter) Count() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.count
+}